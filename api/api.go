@@ -388,6 +388,7 @@ type OrbElementParameter struct {
 	Description string      `json:"-"`
 	Type        string      `json:"-"`
 	Default     interface{} `json:"-"`
+	Enum        []string    `json:"-"`
 }
 
 // RealOrbElement represents the yaml-unmarshled contents of
@@ -1550,6 +1551,64 @@ query namespaceOrbs ($namespace: String, $after: String!) {
 	return orbVersions, nil
 }
 
+// orbVersionsPageSize is the number of versions first asked for by OrbVersions.
+const orbVersionsPageSize = 100
+
+// OrbVersions gets every published version of an orb with its source, the
+// highest first. The registry only lists the given number of versions of an
+// orb, so the number asked for is doubled until fewer versions come back.
+func OrbVersions(cl *graphql.Client, name string) ([]OrbVersion, error) {
+	query := `query($name: String!, $count: Int!) {
+			    orb(name: $name) {
+			        id
+			        createdAt
+			        name
+			        namespace {
+			            name
+			        }
+			        versions(count: $count) {
+			            id
+			            version
+			            source
+			            createdAt
+			        }
+			    }
+		      }`
+
+	for count := orbVersionsPageSize; ; count *= 2 {
+		var response struct {
+			Orb Orb
+		}
+
+		request := graphql.NewRequest(query)
+		request.SetToken(cl.Token)
+		request.Var("name", name)
+		request.Var("count", count)
+
+		if err := cl.Run(request, &response); err != nil {
+			return nil, errors.Wrap(err, "GraphQL query failed")
+		}
+
+		if response.Orb.ID == "" {
+			return nil, fmt.Errorf("no Orb '%s' was found; please check that the Orb reference is correct", name)
+		}
+
+		if len(response.Orb.Versions) < count {
+			orb := Orb{
+				ID:        response.Orb.ID,
+				Name:      response.Orb.Name,
+				Namespace: response.Orb.Namespace,
+				CreatedAt: response.Orb.CreatedAt,
+			}
+			versions := response.Orb.Versions
+			for i := range versions {
+				versions[i].Orb = orb
+			}
+			return versions, nil
+		}
+	}
+}
+
 // ListNamespaceOrbs queries the API to find all orbs belonging to the given
 // namespace.
 // Returns a collection of Orb objects containing their relevant data.
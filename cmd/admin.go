@@ -19,16 +19,35 @@ func newAdminCommand(config *settings.Config) *cobra.Command {
 	importOrbCommand := &cobra.Command{
 		Use:   "import-orb <namespace>[/<orb>[@<version>]]",
 		Short: "Import an orb version from circleci.com into a CircleCI Server installation",
+		Long: `Import an orb version from circleci.com into a CircleCI Server installation.
+
+The latest version of each orb is imported, or every version with --all-versions.
+Without access to circleci.com, import the orbs of a bundle written by
+'circleci orb export' with --from-bundle.
+The plan of the import and its progress are saved while it runs, so that an
+interrupted import continues where it stopped with --resume. The actions that
+failed with --continue-on-error are retried by --resume as well.`,
 		RunE: func(_ *cobra.Command, _ []string) error {
 			return importOrb(orbOpts)
 		},
-		Args: cobra.MinimumNArgs(1),
+		Args: func(cmd *cobra.Command, args []string) error {
+			if orbOpts.importResume || orbOpts.importBundle != "" {
+				return cobra.NoArgs(cmd, args)
+			}
+			return cobra.MinimumNArgs(1)(cmd, args)
+		},
 	}
 	importOrbCommand.Flags().BoolVar(&orbOpts.integrationTesting, "integration-testing", false, "Enable test mode to bypass interactive UI.")
 	if err := importOrbCommand.Flags().MarkHidden("integration-testing"); err != nil {
 		panic(err)
 	}
 	importOrbCommand.Flags().BoolVar(&orbOpts.noPrompt, "no-prompt", false, "Disable prompt to bypass interactive UI.")
+	importOrbCommand.Flags().BoolVar(&orbOpts.allVersions, "all-versions", false, "Import every version of the orbs rather than the latest one.")
+	importOrbCommand.Flags().BoolVar(&orbOpts.importResume, "resume", false, "Continue the import saved by an interrupted run.")
+	importOrbCommand.Flags().BoolVar(&orbOpts.importContinueOnError, "continue-on-error", false, "Keep importing after an action fails, and report the failures at the end.")
+	importOrbCommand.Flags().StringVar(&orbOpts.importBundle, "from-bundle", "", "Import the orbs of a bundle written by 'circleci orb export' rather than from circleci.com.")
+	importOrbCommand.Flags().IntVar(&orbOpts.importConcurrency, "concurrency", 4, "Number of checks and orbs to import at a time. The versions of an orb are imported in order.")
+	importOrbCommand.Flags().StringVar(&orbOpts.importStateFile, "state-file", "", "File saving the progress of the import. (default \"~/.circleci/"+orbImportStateFile+"\")")
 
 	renameCommand := &cobra.Command{
 		Use:   "rename-namespace <old-name> <new-name>",
@@ -1,6 +1,9 @@
 package cmd
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/CircleCI-Public/circleci-cli/local"
 	"github.com/CircleCI-Public/circleci-cli/settings"
 	"github.com/spf13/cobra"
@@ -18,10 +21,44 @@ func newLocalExecuteCommand(config *settings.Config) *cobra.Command {
 	local.AddFlagsForDocumentation(buildCommand.Flags())
 	buildCommand.Flags().StringP("org-slug", "o", "", "organization slug (for example: github/example-org), used when a config depends on private orbs belonging to that org")
 	buildCommand.Flags().String("org-id", "", "organization id, used when a config depends on private orbs belonging to that org")
+	local.AddAgentImageFlags(buildCommand.Flags())
+	local.AddEnvironmentFlags(buildCommand.Flags())
+	buildCommand.Flags().String("runtime", "", fmt.Sprintf("container runtime to run the job with, one of: %s (detected when not set)", strings.Join(local.Runtimes, ", ")))
 
 	return buildCommand
 }
 
+func newLocalWorkflowCommand(config *settings.Config) *cobra.Command {
+	workflowCommand := &cobra.Command{
+		Use:   "workflow <name>",
+		Short: "Run the jobs of a workflow in containers on the local machine",
+		Long: `Run the jobs of a workflow in containers on the local machine.
+
+Jobs run once the jobs they require have succeeded, and the jobs depending on a
+failed job are skipped. Files persisted to the workspace by a job are available
+to the jobs attaching the workspace after it. Approval jobs are prompted for, or
+approved with --auto-approve.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return local.ExecuteWorkflow(args[0], cmd.Flags(), config)
+		},
+		Args: cobra.ExactArgs(1),
+	}
+
+	workflowCommand.Flags().StringP("config", "c", local.DefaultConfigPath, "config file")
+	workflowCommand.Flags().Int("max-parallel", 1, "maximum number of jobs to run at the same time")
+	workflowCommand.Flags().Bool("auto-approve", false, "approve approval jobs without prompting")
+	workflowCommand.Flags().Bool("no-cache", false, "skip the save_cache and restore_cache steps, instead of using the caches kept in ~/.circleci/local-cache")
+	workflowCommand.Flags().StringArrayP("volume", "v", nil, "Volume bind-mounting")
+	workflowCommand.Flags().StringArrayP("env", "e", nil, "Set environment variables, e.g. `-e VAR=VAL`")
+	workflowCommand.Flags().StringP("org-slug", "o", "", "organization slug (for example: github/example-org), used when a config depends on private orbs belonging to that org")
+	workflowCommand.Flags().String("org-id", "", "organization id, used when a config depends on private orbs belonging to that org")
+	local.AddAgentImageFlags(workflowCommand.Flags())
+	local.AddEnvironmentFlags(workflowCommand.Flags())
+	workflowCommand.Flags().String("runtime", "", fmt.Sprintf("container runtime to run the jobs with, one of: %s (detected when not set)", strings.Join(local.Runtimes, ", ")))
+
+	return workflowCommand
+}
+
 // hidden command for backwards compatibility
 func newBuildCommand(config *settings.Config) *cobra.Command {
 	cmd := newLocalExecuteCommand(config)
@@ -36,5 +73,7 @@ func newLocalCommand(config *settings.Config) *cobra.Command {
 		Short: "Debug jobs on the local machine",
 	}
 	cmd.AddCommand(newLocalExecuteCommand(config))
+	cmd.AddCommand(newLocalWorkflowCommand(config))
+	cmd.AddCommand(newLocalCacheCommand())
 	return cmd
 }
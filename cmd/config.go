@@ -6,8 +6,10 @@ import (
 	"net/url"
 	"strings"
 
+	"github.com/CircleCI-Public/circleci-cli/api/graphql"
 	"github.com/CircleCI-Public/circleci-cli/api/rest"
 	"github.com/CircleCI-Public/circleci-cli/config"
+	"github.com/CircleCI-Public/circleci-cli/convert"
 	"github.com/CircleCI-Public/circleci-cli/filetree"
 	"github.com/CircleCI-Public/circleci-cli/local"
 	"github.com/CircleCI-Public/circleci-cli/pipeline"
@@ -22,6 +24,7 @@ import (
 type configOptions struct {
 	cfg  *settings.Config
 	rest *rest.Client
+	cl   *graphql.Client
 	args []string
 }
 
@@ -29,6 +32,7 @@ type configOptions struct {
 // Used to for compatibility with `circleci config validate --path`
 var configPath string
 var ignoreDeprecatedImages bool // should we ignore deprecated images warning
+var ignoreMissingResources bool // should we skip checking that contexts and resource classes exist
 
 var configAnnotations = map[string]string{
 	"<path>": "The path to your config (use \"-\" for STDIN)",
@@ -44,19 +48,29 @@ func newConfigCommand(config *settings.Config) *cobra.Command {
 		Short: "Operate on build config files",
 	}
 
+	var overlays []string
 	packCommand := &cobra.Command{
 		Use:   "pack <path>",
 		Short: "Pack up your CircleCI configuration into a single file.",
+		Long: `Pack up your CircleCI configuration into a single file.
+
+Overlay directories, packed the same way, are deep-merged over the result in
+the order they are given: maps are merged key by key, while scalars and lists
+replace the base value. Add "$patch: replace" to a map of an overlay to replace
+the base map instead of merging into it, or "$patch: delete" to remove it.`,
 		PreRun: func(cmd *cobra.Command, args []string) {
 			opts.args = args
 		},
 		RunE: func(_ *cobra.Command, _ []string) error {
-			return packConfig(opts)
+			return packConfig(opts, overlays)
 		},
 		Args:        cobra.ExactArgs(1),
 		Annotations: make(map[string]string),
 	}
 	packCommand.Annotations["<path>"] = configAnnotations["<path>"]
+	packCommand.Example = `  circleci config pack base --overlay overlays/staging
+  circleci config pack base --overlay overlays/common --overlay overlays/production`
+	packCommand.Flags().StringArrayVar(&overlays, "overlay", nil, "directory to deep-merge over the packed config, may be repeated")
 
 	validateCommand := &cobra.Command{
 		Use:     "validate <path>",
@@ -75,6 +89,7 @@ func newConfigCommand(config *settings.Config) *cobra.Command {
 	validateCommand.Annotations["<path>"] = configAnnotations["<path>"]
 	validateCommand.PersistentFlags().StringVarP(&configPath, "config", "c", ".circleci/config.yml", "path to config file")
 	validateCommand.PersistentFlags().BoolVar(&ignoreDeprecatedImages, "ignore-deprecated-images", false, "ignores the deprecated images error")
+	validateCommand.PersistentFlags().BoolVar(&ignoreMissingResources, "ignore-missing-resources", false, "skip checking that the contexts and self-hosted resource classes used by the config exist")
 	if err := validateCommand.PersistentFlags().MarkHidden("config"); err != nil {
 		panic(err)
 	}
@@ -115,10 +130,102 @@ func newConfigCommand(config *settings.Config) *cobra.Command {
 	migrateCommand.PersistentFlags().StringP("config", "c", ".circleci/config.yml", "path to config file")
 	migrateCommand.PersistentFlags().BoolP("in-place", "i", false, "whether to update file in place.  If false, emits to stdout")
 
+	var vendorOutput string
+	vendorCommand := &cobra.Command{
+		Use:   "vendor-orbs <path>",
+		Short: "Replace the orbs referenced by a config with inline orb definitions.",
+		Long: `Replace the orbs referenced by a config with inline orb definitions.
+
+The source of every orb imported by the config, and of the orbs they import in
+turn, is fetched from the registry and written into the config, so that the
+result compiles without access to the orb registry.`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			opts.args = args
+			opts.cl = graphql.NewClient(config.HTTPClient, config.Host, config.Endpoint, config.Token, config.Debug)
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return vendorOrbs(opts, vendorOutput)
+		},
+		Args:        cobra.ExactArgs(1),
+		Annotations: make(map[string]string),
+	}
+	vendorCommand.Annotations["<path>"] = configAnnotations["<path>"]
+	vendorCommand.Example = `  circleci config vendor-orbs .circleci/config.yml > vendored.yml
+  circleci config vendor-orbs .circleci/config.yml -o .circleci/config.yml`
+	vendorCommand.Flags().StringVarP(&vendorOutput, "output", "o", "", "write the vendored config to this file instead of STDOUT")
+
+	initOpts := configInitOptions{
+		tty: configInitInteractiveUI{},
+	}
+	initCommand := &cobra.Command{
+		Use:   "init [<path>]",
+		Short: "Generate a starter config for the project in a directory.",
+		Long: `Generate a starter config for the project in a directory.
+
+The kind of project is detected from the files found in the directory
+(go.mod, package.json, pom.xml, Gemfile, requirements.txt or Dockerfile), and a
+config using the matching certified orbs is written to .circleci/config.yml.
+
+The built-in templates can be replaced by placing a <stack>.yml file in the
+directory given with --template-dir. Templates may use [[ .ProjectName ]] and
+[[ .Version ]].`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			opts.args = args
+			opts.rest = rest.New(config.Host, config)
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return initConfig(opts, initOpts)
+		},
+		Args:        cobra.MaximumNArgs(1),
+		Annotations: make(map[string]string),
+	}
+	initCommand.Annotations["<path>"] = "The directory of the project (defaults to the current directory)"
+	initCommand.Flags().StringVar(&initOpts.stack, "stack", "", "kind of project, one of: go, node, java, ruby, python, docker")
+	initCommand.Flags().StringVar(&initOpts.templateDir, "template-dir", "", "directory of templates overriding the built-in ones")
+	initCommand.Flags().StringVarP(&initOpts.output, "output", "o", local.DefaultConfigPath, "path of the generated config, relative to the project directory")
+	initCommand.Flags().BoolVarP(&initOpts.force, "force", "f", false, "overwrite an existing config")
+	initCommand.Flags().BoolVar(&initOpts.noPrompt, "no-prompt", false, "Disable prompt to bypass interactive UI.")
+	initCommand.Flags().BoolVar(&initOpts.skipValidation, "skip-validation", false, "do not validate the generated config")
+
+	convertOpts := configConvertOptions{}
+	convertCommand := &cobra.Command{
+		Use:   "convert <path>",
+		Short: "Convert a GitHub Actions or GitLab CI pipeline into a CircleCI config.",
+		Long: `Convert a GitHub Actions or GitLab CI pipeline into a CircleCI config.
+
+Jobs, steps, dependencies between jobs, matrices, services, caches, artifacts
+and environment variables are translated into a 2.1 config with executors and a
+workflow. Anything without a CircleCI equivalent is left as a TODO comment next
+to the closest matching part of the config.
+
+The converted config is then validated, like 'circleci config validate' would.`,
+		PreRun: func(cmd *cobra.Command, args []string) {
+			opts.args = args
+			opts.rest = rest.New(config.Host, config)
+		},
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return convertConfig(opts, convertOpts)
+		},
+		Args:        cobra.ExactArgs(1),
+		Annotations: make(map[string]string),
+	}
+	convertCommand.Annotations["<path>"] = "The path to the pipeline to convert (or \"-\" for STDIN)"
+	convertCommand.Example = `  circleci config convert --from github-actions .github/workflows/ci.yml -o .circleci/config.yml
+  circleci config convert --from gitlab-ci .gitlab-ci.yml`
+	convertCommand.Flags().StringVar(&convertOpts.from, "from", "", fmt.Sprintf("format of the pipeline, one of: %s", strings.Join(convert.Formats, ", ")))
+	convertCommand.Flags().StringVarP(&convertOpts.output, "output", "o", "", "write the converted config to this file instead of STDOUT")
+	convertCommand.Flags().BoolVar(&convertOpts.skipValidation, "skip-validation", false, "do not validate the converted config")
+	if err := convertCommand.MarkFlagRequired("from"); err != nil {
+		panic(err)
+	}
+
 	configCmd.AddCommand(packCommand)
 	configCmd.AddCommand(validateCommand)
 	configCmd.AddCommand(processCommand)
 	configCmd.AddCommand(migrateCommand)
+	configCmd.AddCommand(vendorCommand)
+	configCmd.AddCommand(initCommand)
+	configCmd.AddCommand(convertCommand)
 
 	return configCmd
 }
@@ -140,6 +247,8 @@ func validateConfig(opts configOptions, flags *pflag.FlagSet) error {
 
 	//if no orgId provided use org slug
 	var orgID string
+	var orgs []CollaborationResult
+	orgSlug, _ := flags.GetString("org-slug")
 	orgID, _ = flags.GetString("org-id")
 	if strings.TrimSpace(orgID) != "" {
 		orgID, _ = flags.GetString("org-id")
@@ -148,8 +257,7 @@ func validateConfig(opts configOptions, flags *pflag.FlagSet) error {
 			return err
 		}
 	} else {
-		orgSlug, _ := flags.GetString("org-slug")
-		orgs, err := GetOrgCollaborations(opts.rest)
+		orgs, err = GetOrgCollaborations(opts.rest)
 		if err != nil {
 			fmt.Println(err.Error())
 		}
@@ -170,6 +278,15 @@ func validateConfig(opts configOptions, flags *pflag.FlagSet) error {
 		}
 	}
 
+	// check that the contexts and self-hosted resource classes used by the
+	// config exist, as a typo in either only shows up when the job runs
+	if !ignoreMissingResources {
+		err := validateConfigReferences(opts, response.OutputYaml, orgSlug, orgID, orgs)
+		if err != nil {
+			return err
+		}
+	}
+
 	if path == "-" {
 		fmt.Printf("Config input is valid.\n")
 	} else {
@@ -223,13 +340,21 @@ func processConfig(opts configOptions, flags *pflag.FlagSet) error {
 	return nil
 }
 
-func packConfig(opts configOptions) error {
+func packConfig(opts configOptions, overlays []string) error {
 	tree, err := filetree.NewTree(opts.args[0])
 	if err != nil {
 		return errors.Wrap(err, "An error occurred trying to build the tree")
 	}
 
-	y, err := yaml.Marshal(&tree)
+	var packed interface{} = &tree
+	if len(overlays) > 0 {
+		packed, err = overlayTree(tree, overlays)
+		if err != nil {
+			return err
+		}
+	}
+
+	y, err := yaml.Marshal(packed)
 	if err != nil {
 		return errors.Wrap(err, "Failed trying to marshal the tree to YAML ")
 	}
@@ -237,6 +362,35 @@ func packConfig(opts configOptions) error {
 	return nil
 }
 
+// overlayTree merges the trees of the overlay directories over the base tree.
+func overlayTree(tree *filetree.Node, overlays []string) (interface{}, error) {
+	base, err := tree.MarshalYAML()
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed trying to marshal the tree to YAML ")
+	}
+
+	values := make([]interface{}, 0, len(overlays))
+	for _, dir := range overlays {
+		overlay, err := filetree.NewTree(dir)
+		if err != nil {
+			return nil, errors.Wrapf(err, "An error occurred trying to build the tree of overlay %s", dir)
+		}
+
+		value, err := overlay.MarshalYAML()
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed trying to marshal the overlay %s to YAML ", dir)
+		}
+		values = append(values, value)
+	}
+
+	merged, err := filetree.Overlay(base, values...)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to apply overlays")
+	}
+
+	return merged, nil
+}
+
 func migrateConfig(opts configOptions) error {
 	return proxy.Exec([]string{"config", "migrate"}, opts.args)
 }
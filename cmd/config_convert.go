@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/CircleCI-Public/circleci-cli/config"
+	"github.com/CircleCI-Public/circleci-cli/convert"
+	"github.com/CircleCI-Public/circleci-cli/pipeline"
+	"github.com/pkg/errors"
+)
+
+type configConvertOptions struct {
+	from           string
+	output         string
+	skipValidation bool
+}
+
+func convertConfig(opts configOptions, convertOpts configConvertOptions) error {
+	src, err := config.LoadYaml(opts.args[0])
+	if err != nil {
+		return err
+	}
+
+	result, err := convert.Convert(convertOpts.from, []byte(src))
+	if err != nil {
+		return err
+	}
+
+	output := convertOpts.output
+	if output == "" {
+		fmt.Print(result.Config)
+	} else if err := ioutil.WriteFile(output, []byte(result.Config), 0644); err != nil {
+		return errors.Wrap(err, "Unable to write config")
+	}
+
+	if len(result.TODOs) > 0 {
+		fmt.Fprintf(os.Stderr, "%d parts of the pipeline could not be translated, see the TODO comments in the config.\n", len(result.TODOs))
+	}
+
+	if convertOpts.skipValidation {
+		return nil
+	}
+
+	// Validation reads the config from a file, so when printing to STDOUT it
+	// is written to a temporary one.
+	if output == "" {
+		f, err := ioutil.TempFile("", "*_circleci_config.yml")
+		if err != nil {
+			return errors.Wrap(err, "Unable to create temporary file")
+		}
+		defer os.Remove(f.Name())
+
+		if _, err := f.WriteString(result.Config); err != nil {
+			return errors.Wrap(err, "Unable to write config")
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		output = f.Name()
+	}
+
+	if _, err := config.ConfigQuery(opts.rest, output, "", nil, pipeline.LocalPipelineValues()); err != nil {
+		return errors.Wrap(err, "The converted config is not valid")
+	}
+
+	fmt.Fprintln(os.Stderr, "The converted config is valid.")
+	return nil
+}
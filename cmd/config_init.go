@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/CircleCI-Public/circleci-cli/config"
+	"github.com/CircleCI-Public/circleci-cli/pipeline"
+	"github.com/CircleCI-Public/circleci-cli/prompt"
+	"github.com/CircleCI-Public/circleci-cli/scaffold"
+	"github.com/pkg/errors"
+)
+
+type configInitOptions struct {
+	stack          string
+	templateDir    string
+	output         string
+	force          bool
+	noPrompt       bool
+	skipValidation bool
+	// This lets us pass in our own interface for testing
+	tty configInitUserInterface
+}
+
+// configInitUserInterface is created to allow us to pass a mock user interface for testing.
+type configInitUserInterface interface {
+	selectStack(message string, options []string) (string, error)
+	askUserToConfirm(message string) bool
+}
+
+type configInitInteractiveUI struct{}
+
+func (configInitInteractiveUI) selectStack(message string, options []string) (string, error) {
+	return prompt.SelectFromList(message, options)
+}
+
+func (configInitInteractiveUI) askUserToConfirm(message string) bool {
+	return prompt.AskUserToConfirm(message)
+}
+
+func initConfig(opts configOptions, initOpts configInitOptions) error {
+	dir := "."
+	if len(opts.args) == 1 {
+		dir = opts.args[0]
+	}
+
+	stack, err := chooseStack(dir, initOpts)
+	if err != nil {
+		return err
+	}
+
+	output := initOpts.output
+	if !filepath.IsAbs(output) {
+		output = filepath.Join(dir, output)
+	}
+
+	if _, err := os.Stat(output); err == nil && !initOpts.force {
+		if initOpts.noPrompt || !initOpts.tty.askUserToConfirm(fmt.Sprintf("%s already exists. Do you want to overwrite it", output)) {
+			return fmt.Errorf("%s already exists, use --force to overwrite it", output)
+		}
+	}
+
+	generated, err := scaffold.Render(stack, scaffold.DefaultValues(stack, dir), initOpts.templateDir)
+	if err != nil {
+		return err
+	}
+
+	if !initOpts.skipValidation {
+		// Validated before it is written, so that an invalid config never
+		// replaces the one of the project.
+		if _, err := config.CompileConfig(opts.rest, generated, "", nil, pipeline.LocalPipelineValues()); err != nil {
+			return errors.Wrap(err, "The generated config is not valid")
+		}
+		fmt.Println("The generated config is valid.")
+	}
+
+	if err := os.MkdirAll(filepath.Dir(output), 0755); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(output, []byte(generated), 0644); err != nil {
+		return errors.Wrap(err, "Unable to write config")
+	}
+
+	fmt.Printf("A starter config for a %s project was written to %s.\n", stack.Description, output)
+	return nil
+}
+
+// chooseStack picks the stack from the --stack flag, from the files found in
+// dir, or by asking the user when the project is ambiguous.
+func chooseStack(dir string, initOpts configInitOptions) (scaffold.Stack, error) {
+	if initOpts.stack != "" {
+		return scaffold.FindStack(initOpts.stack)
+	}
+
+	candidates := scaffold.Detect(dir)
+
+	switch {
+	case len(candidates) == 1:
+		return candidates[0], nil
+	case initOpts.noPrompt && len(candidates) == 0:
+		return scaffold.Stack{}, errors.New("Unable to detect the kind of project, use --stack to choose one")
+	case initOpts.noPrompt:
+		fmt.Printf("Several kinds of project were detected, using %s. Use --stack to choose another one.\n", candidates[0].Name)
+		return candidates[0], nil
+	case len(candidates) == 0:
+		candidates = scaffold.Stacks
+	}
+
+	options := make([]string, 0, len(candidates))
+	byOption := map[string]scaffold.Stack{}
+	for _, stack := range candidates {
+		option := fmt.Sprintf("%s (%s)", stack.Name, stack.Description)
+		options = append(options, option)
+		byOption[option] = stack
+	}
+
+	choice, err := initOpts.tty.selectStack("Which kind of project is this?", options)
+	if err != nil {
+		return scaffold.Stack{}, err
+	}
+
+	return byOption[choice], nil
+}
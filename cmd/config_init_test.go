@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	"github.com/CircleCI-Public/circleci-cli/api/rest"
+	"github.com/CircleCI-Public/circleci-cli/settings"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type configInitTestUI struct {
+	choice  int
+	confirm bool
+	options *[]string
+}
+
+func (ui configInitTestUI) selectStack(message string, options []string) (string, error) {
+	fmt.Println(message)
+	*ui.options = options
+	return options[ui.choice], nil
+}
+
+func (ui configInitTestUI) askUserToConfirm(message string) bool {
+	fmt.Println(message)
+	return ui.confirm
+}
+
+var _ = Describe("Config init", func() {
+	var (
+		dir      string
+		options  []string
+		initOpts configInitOptions
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "circleci-config-init")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		options = nil
+		initOpts = configInitOptions{
+			output:         ".circleci/config.yml",
+			skipValidation: true,
+			tty:            configInitTestUI{options: &options},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	write := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600)).To(Succeed())
+	}
+
+	It("writes the config for the detected stack", func() {
+		write("go.mod", "module example.com/app\n\ngo 1.18\n")
+
+		Expect(initConfig(configOptions{args: []string{dir}}, initOpts)).To(Succeed())
+
+		generated, err := ioutil.ReadFile(filepath.Join(dir, ".circleci", "config.yml"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(generated)).To(ContainSubstring("go: circleci/go@"))
+		Expect(string(generated)).To(ContainSubstring(`tag: "1.18"`))
+		Expect(options).To(BeEmpty())
+	})
+
+	It("asks which stack to use when several are detected", func() {
+		write("go.mod", "module example.com/app\n")
+		write("Dockerfile", "FROM scratch\n")
+		initOpts.tty = configInitTestUI{options: &options, choice: 1}
+
+		stack, err := chooseStack(dir, initOpts)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(stack.Name).To(Equal("docker"))
+		Expect(options).To(Equal([]string{"go (Go modules)", "docker (Docker image)"}))
+	})
+
+	It("picks the first detected stack without prompting", func() {
+		write("go.mod", "module example.com/app\n")
+		write("Dockerfile", "FROM scratch\n")
+		initOpts.noPrompt = true
+
+		stack, err := chooseStack(dir, initOpts)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(stack.Name).To(Equal("go"))
+	})
+
+	It("requires a stack when none is detected without prompting", func() {
+		initOpts.noPrompt = true
+
+		_, err := chooseStack(dir, initOpts)
+		Expect(err).To(MatchError("Unable to detect the kind of project, use --stack to choose one"))
+	})
+
+	It("refuses to overwrite an existing config", func() {
+		write("Gemfile", "source 'https://rubygems.org'\n")
+		Expect(os.MkdirAll(filepath.Join(dir, ".circleci"), 0700)).To(Succeed())
+		write(".circleci/config.yml", "version: 2.1\n")
+		initOpts.noPrompt = true
+
+		err := initConfig(configOptions{args: []string{dir}}, initOpts)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("already exists, use --force to overwrite it"))
+
+		initOpts.force = true
+		Expect(initConfig(configOptions{args: []string{dir}}, initOpts)).To(Succeed())
+	})
+
+	It("does not write a config that fails validation", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = io.WriteString(w, `{"valid": false, "errors": [{"message": "invalid config"}]}`)
+		}))
+		defer server.Close()
+		client := rest.New(server.URL, &settings.Config{RestEndpoint: "api/v2", HTTPClient: http.DefaultClient})
+
+		write("Gemfile", "source 'https://rubygems.org'\n")
+		Expect(os.MkdirAll(filepath.Join(dir, ".circleci"), 0700)).To(Succeed())
+		write(".circleci/config.yml", "version: 2.1\n")
+		initOpts.force = true
+		initOpts.skipValidation = false
+
+		err := initConfig(configOptions{rest: client, args: []string{dir}}, initOpts)
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("The generated config is not valid"))
+
+		existing, err := ioutil.ReadFile(filepath.Join(dir, ".circleci/config.yml"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(existing)).To(Equal("version: 2.1\n"))
+	})
+})
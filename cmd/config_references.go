@@ -0,0 +1,338 @@
+package cmd
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/CircleCI-Public/circleci-cli/api"
+	"github.com/CircleCI-Public/circleci-cli/api/rest"
+	"github.com/CircleCI-Public/circleci-cli/api/runner"
+	"github.com/CircleCI-Public/circleci-cli/git"
+	"github.com/agnivade/levenshtein"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// configReferences are the organization resources a compiled config expects to exist.
+type configReferences struct {
+	Contexts        []string
+	ResourceClasses []string
+}
+
+type contextLister interface {
+	Contexts(vcs, org string) (*[]api.Context, error)
+}
+
+type resourceClassLister interface {
+	GetResourceClassesByNamespace(namespace string) ([]runner.ResourceClass, error)
+}
+
+// collectConfigReferences finds every context used in the workflows of a
+// compiled config, and every self-hosted (`namespace/name`) resource class.
+func collectConfigReferences(compiled string) (configReferences, error) {
+	var parsed struct {
+		Jobs      map[string]interface{} `yaml:"jobs"`
+		Workflows map[string]interface{} `yaml:"workflows"`
+	}
+
+	if err := yaml.Unmarshal([]byte(compiled), &parsed); err != nil {
+		return configReferences{}, errors.Wrap(err, "Unable to parse compiled config")
+	}
+
+	contexts := map[string]bool{}
+	for _, workflow := range parsed.Workflows {
+		workflow, ok := workflow.(map[string]interface{})
+		if !ok {
+			// The workflows `version` key
+			continue
+		}
+
+		jobs, _ := workflow["jobs"].([]interface{})
+		for _, job := range jobs {
+			// Jobs without any options are plain strings
+			job, ok := job.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			for _, options := range job {
+				options, ok := options.(map[string]interface{})
+				if !ok {
+					continue
+				}
+
+				switch context := options["context"].(type) {
+				case string:
+					contexts[context] = true
+				case []interface{}:
+					for _, c := range context {
+						if name, ok := c.(string); ok {
+							contexts[name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	resourceClasses := map[string]bool{}
+	for _, job := range parsed.Jobs {
+		job, ok := job.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if rc, ok := job["resource_class"].(string); ok && strings.Contains(rc, "/") {
+			resourceClasses[rc] = true
+		}
+	}
+
+	return configReferences{
+		Contexts:        sortedKeys(contexts),
+		ResourceClasses: sortedKeys(resourceClasses),
+	}, nil
+}
+
+// checkConfigReferences reports every context or resource class in refs that
+// does not exist, including those of a namespace the runner API does not
+// know. Contexts are only checked when the org slug is known.
+func checkConfigReferences(refs configReferences, orgSlug string, contexts contextLister, resourceClasses resourceClassLister) ([]string, error) {
+	var missing []string
+
+	if orgSlug != "" && len(refs.Contexts) > 0 {
+		vcs, org, err := splitOrgSlug(orgSlug)
+		if err != nil {
+			return nil, err
+		}
+
+		existing, err := contexts.Contexts(vcs, org)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to list the contexts of %s", orgSlug)
+		}
+
+		names := make([]string, 0, len(*existing))
+		for _, c := range *existing {
+			names = append(names, c.Name)
+		}
+
+		for _, name := range refs.Contexts {
+			if !contains(names, name) {
+				missing = append(missing, fmt.Sprintf("context `%s` does not exist in %s%s", name, orgSlug, suggestion(name, names)))
+			}
+		}
+	}
+
+	byNamespace := map[string][]string{}
+	for _, rc := range refs.ResourceClasses {
+		namespace := strings.SplitN(rc, "/", 2)[0]
+		byNamespace[namespace] = append(byNamespace[namespace], rc)
+	}
+
+	namespaces := make([]string, 0, len(byNamespace))
+	for namespace := range byNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	for _, namespace := range namespaces {
+		existing, err := resourceClasses.GetResourceClassesByNamespace(namespace)
+		if isUnknownNamespace(err) {
+			for _, rc := range byNamespace[namespace] {
+				missing = append(missing, fmt.Sprintf("resource class `%s` does not exist, as namespace `%s` has no resource classes", rc, namespace))
+			}
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to list the resource classes of namespace %s", namespace)
+		}
+
+		names := make([]string, 0, len(existing))
+		for _, rc := range existing {
+			names = append(names, rc.ResourceClass)
+		}
+
+		for _, rc := range byNamespace[namespace] {
+			if !contains(names, rc) {
+				missing = append(missing, fmt.Sprintf("resource class `%s` does not exist%s", rc, suggestion(rc, names)))
+			}
+		}
+	}
+
+	return missing, nil
+}
+
+// isUnknownNamespace tells whether the runner API rejected a namespace
+// because it does not exist, rather than because of the credentials or the
+// service being unavailable.
+func isUnknownNamespace(err error) bool {
+	httpErr, ok := errors.Cause(err).(*rest.HTTPError)
+	if !ok {
+		return false
+	}
+
+	switch httpErr.Code {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	}
+	return httpErr.Code >= 400 && httpErr.Code < 500
+}
+
+// validateConfigReferences checks the contexts and self-hosted resource
+// classes used by a compiled config. Failing to reach the APIs, or to be
+// authorized by them, is reported as a warning, since it says nothing about
+// whether the config is valid.
+func validateConfigReferences(opts configOptions, compiled string, orgSlug, orgID string, orgs []CollaborationResult) error {
+	cfg := opts.cfg
+	if cfg.Token == "" {
+		return nil
+	}
+
+	refs, err := collectConfigReferences(compiled)
+	if err != nil {
+		return err
+	}
+
+	if len(refs.Contexts) > 0 && orgSlug == "" {
+		if orgs == nil {
+			// A failed lookup leaves the org unknown, and the contexts unchecked
+			orgs, _ = GetOrgCollaborations(opts.rest)
+		}
+		orgSlug = orgSlugFromCollaborations(orgs, orgID, inferGitRemote())
+	}
+
+	if len(refs.ResourceClasses) == 0 && (orgSlug == "" || len(refs.Contexts) == 0) {
+		return nil
+	}
+
+	contexts, err := api.NewContextRestClient(*cfg)
+	if err != nil {
+		return err
+	}
+
+	missing, err := checkConfigReferences(refs, orgSlug, contexts, runner.New(rest.New(runnerHost(cfg.Host), cfg)))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: unable to check the contexts and resource classes used by this config: %s\n", err.Error())
+		return nil
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("config references resources that do not exist:\n  - %s", strings.Join(missing, "\n  - "))
+	}
+
+	return nil
+}
+
+// orgSlugFromCollaborations finds the organization a config is validated for
+// among those of the user: the org with the given ID, else the org of the git
+// remote of the project, else the only org of the user.
+func orgSlugFromCollaborations(orgs []CollaborationResult, orgID string, remote *git.Remote) string {
+	if strings.TrimSpace(orgID) != "" {
+		for _, org := range orgs {
+			if org.OrgId == orgID {
+				return org.OrgSlug
+			}
+		}
+		return ""
+	}
+
+	if remote != nil {
+		for _, org := range orgs {
+			if strings.EqualFold(org.VcsTye, string(remote.VcsType)) && strings.EqualFold(org.OrgName, remote.Organization) {
+				return org.OrgSlug
+			}
+		}
+	}
+
+	if len(orgs) == 1 {
+		return orgs[0].OrgSlug
+	}
+
+	return ""
+}
+
+func inferGitRemote() *git.Remote {
+	remote, err := git.InferProjectFromGitRemotes()
+	if err != nil {
+		return nil
+	}
+	return remote
+}
+
+// runnerHost is the host of the runner API, which circleci.com serves from a
+// host of its own.
+func runnerHost(host string) string {
+	u, err := url.Parse(host)
+	if err != nil {
+		return host
+	}
+
+	cloud, _ := url.Parse(defaultHost)
+	if strings.EqualFold(u.Hostname(), cloud.Hostname()) {
+		return "https://runner.circleci.com"
+	}
+	return host
+}
+
+// splitOrgSlug splits a slug such as `github/example-org` into its VCS and organization.
+func splitOrgSlug(slug string) (vcs, org string, err error) {
+	parts := strings.Split(slug, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("invalid org slug `%s`, expected the form vcs/org-name", slug)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// suggestion returns a "did you mean" hint for the closest of candidates to
+// name, or an empty string when none of them is a plausible typo.
+func suggestion(name string, candidates []string) string {
+	// Allow roughly one typo every three characters
+	threshold := len(name) / 3
+	if threshold < 2 {
+		threshold = 2
+	}
+
+	best, bestDistance := "", threshold+1
+	for _, candidate := range candidates {
+		a, b := strings.ToLower(name), strings.ToLower(candidate)
+		distance := levenshtein.ComputeDistance(a, b)
+
+		// A truncated name, such as `deploy-prod` for `deploy-production`,
+		// is as likely a mistake as a typo.
+		if strings.HasPrefix(a, b) || strings.HasPrefix(b, a) {
+			distance = 1
+		}
+
+		if distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+
+	if best == "" {
+		return ""
+	}
+
+	return fmt.Sprintf(" (did you mean `%s`?)", best)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
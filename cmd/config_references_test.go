@@ -0,0 +1,130 @@
+package cmd
+
+import (
+	"net/http"
+
+	"github.com/CircleCI-Public/circleci-cli/api"
+	"github.com/CircleCI-Public/circleci-cli/api/rest"
+	"github.com/CircleCI-Public/circleci-cli/api/runner"
+	"github.com/CircleCI-Public/circleci-cli/git"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type fakeContextLister struct {
+	contexts []api.Context
+	vcs, org string
+}
+
+func (f *fakeContextLister) Contexts(vcs, org string) (*[]api.Context, error) {
+	f.vcs, f.org = vcs, org
+	return &f.contexts, nil
+}
+
+type fakeResourceClassLister map[string][]runner.ResourceClass
+
+func (f fakeResourceClassLister) GetResourceClassesByNamespace(namespace string) ([]runner.ResourceClass, error) {
+	rcs, ok := f[namespace]
+	if !ok {
+		return nil, &rest.HTTPError{Code: http.StatusNotFound, Message: "namespace not found"}
+	}
+	return rcs, nil
+}
+
+var _ = Describe("Config references", func() {
+	compiled := `version: 2
+jobs:
+  build:
+    docker:
+      - image: cimg/base:stable
+    resource_class: large
+  deploy:
+    machine: true
+    resource_class: my-ns/deploy-runner
+workflows:
+  version: 2
+  main:
+    jobs:
+      - build
+      - deploy:
+          context:
+            - deploy-prod
+            - aws
+  nightly:
+    jobs:
+      - build:
+          context: aws
+`
+
+	It("collects contexts and self-hosted resource classes", func() {
+		refs, err := collectConfigReferences(compiled)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(refs.Contexts).To(Equal([]string{"aws", "deploy-prod"}))
+		Expect(refs.ResourceClasses).To(Equal([]string{"my-ns/deploy-runner"}))
+	})
+
+	It("reports missing contexts and resource classes with suggestions", func() {
+		refs, err := collectConfigReferences(compiled)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		contexts := &fakeContextLister{contexts: []api.Context{{Name: "aws"}, {Name: "deploy-production"}}}
+		resourceClasses := fakeResourceClassLister{
+			"my-ns": {{ResourceClass: "my-ns/deploy-runners"}},
+		}
+
+		missing, err := checkConfigReferences(refs, "github/example-org", contexts, resourceClasses)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(contexts.vcs).To(Equal("github"))
+		Expect(contexts.org).To(Equal("example-org"))
+		Expect(missing).To(Equal([]string{
+			"context `deploy-prod` does not exist in github/example-org (did you mean `deploy-production`?)",
+			"resource class `my-ns/deploy-runner` does not exist (did you mean `my-ns/deploy-runners`?)",
+		}))
+	})
+
+	It("skips contexts when no org slug is given", func() {
+		refs := configReferences{Contexts: []string{"aws"}}
+		missing, err := checkConfigReferences(refs, "", nil, fakeResourceClassLister{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(missing).To(BeEmpty())
+	})
+
+	It("reports the resource classes of an unknown namespace as missing", func() {
+		refs := configReferences{ResourceClasses: []string{"other-ns/runner"}}
+		missing, err := checkConfigReferences(refs, "", nil, fakeResourceClassLister{})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(missing).To(Equal([]string{
+			"resource class `other-ns/runner` does not exist, as namespace `other-ns` has no resource classes",
+		}))
+	})
+
+	It("fails rather than reporting missing resources when unauthorized", func() {
+		Expect(isUnknownNamespace(&rest.HTTPError{Code: http.StatusNotFound})).To(BeTrue())
+		Expect(isUnknownNamespace(&rest.HTTPError{Code: http.StatusUnauthorized})).To(BeFalse())
+		Expect(isUnknownNamespace(&rest.HTTPError{Code: http.StatusBadGateway})).To(BeFalse())
+	})
+
+	It("finds the org of the config among the collaborations", func() {
+		orgs := []CollaborationResult{
+			{VcsTye: "github", OrgSlug: "gh/example-org", OrgName: "example-org", OrgId: "1234"},
+			{VcsTye: "bitbucket", OrgSlug: "bb/other-org", OrgName: "other-org", OrgId: "5678"},
+		}
+		remote := &git.Remote{VcsType: git.Bitbucket, Organization: "Other-Org", Project: "app"}
+
+		Expect(orgSlugFromCollaborations(orgs, "1234", remote)).To(Equal("gh/example-org"))
+		Expect(orgSlugFromCollaborations(orgs, "", remote)).To(Equal("bb/other-org"))
+		Expect(orgSlugFromCollaborations(orgs, "", nil)).To(Equal(""))
+		Expect(orgSlugFromCollaborations(orgs[:1], "", nil)).To(Equal("gh/example-org"))
+	})
+
+	It("uses the runner host of circleci.com only for circleci.com", func() {
+		Expect(runnerHost("https://circleci.com")).To(Equal("https://runner.circleci.com"))
+		Expect(runnerHost("https://circleci.com/")).To(Equal("https://runner.circleci.com"))
+		Expect(runnerHost("https://circleci.com.example.org")).To(Equal("https://circleci.com.example.org"))
+	})
+
+	It("only suggests names that are close", func() {
+		Expect(suggestion("deploy", []string{"something-else"})).To(Equal(""))
+		Expect(suggestion("deploy", []string{"deplyo", "develop"})).To(Equal(" (did you mean `deplyo`?)"))
+	})
+})
@@ -102,6 +102,21 @@ var _ = Describe("Config", func() {
 			Eventually(session).Should(gexec.Exit(0))
 		})
 
+		It("merges overlays over the packed config", func() {
+			command = exec.Command(pathCLI,
+				"config", "pack",
+				"--skip-update-check",
+				"testdata/overlay-pack/base",
+				"--overlay", "testdata/overlay-pack/overlays/staging")
+			results = golden.Get(GinkgoT(), filepath.FromSlash("overlay-pack/result.yml"))
+			session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+			session.Wait()
+			Expect(err).ShouldNot(HaveOccurred())
+			Eventually(session.Err.Contents()).Should(BeEmpty())
+			Eventually(session.Out.Contents()).Should(MatchYAML(results))
+			Eventually(session).Should(gexec.Exit(0))
+		})
+
 		It("prints an error given a config which is a list and not a map", func() {
 			config := clitest.OpenTmpFile(filepath.Join(tempSettings.Home, "myorb"), "config.yaml")
 			command = exec.Command(pathCLI,
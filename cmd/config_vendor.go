@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/CircleCI-Public/circleci-cli/config"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// orbSourceFunc returns the source of the orb at the given reference.
+type orbSourceFunc func(ref string) (string, error)
+
+// orbVendor replaces registry orb references with inline orb definitions.
+// Sources are fetched at most once per reference.
+type orbVendor struct {
+	fetch   orbSourceFunc
+	sources map[string]*yaml.Node
+	// stack holds the references currently being vendored, so that an orb
+	// importing itself (directly or not) is reported instead of looping forever.
+	stack []string
+}
+
+func newOrbVendor(fetch orbSourceFunc) *orbVendor {
+	return &orbVendor{
+		fetch:   fetch,
+		sources: map[string]*yaml.Node{},
+	}
+}
+
+func vendorOrbs(opts configOptions, output string) error {
+	raw, err := config.LoadYaml(opts.args[0])
+	if err != nil {
+		return err
+	}
+
+	vendor := newOrbVendor(func(ref string) (string, error) {
+		return fetchOrbSource(opts.cfg, opts.cl, ref)
+	})
+
+	vendored, err := vendor.vendorConfig([]byte(raw))
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		fmt.Print(string(vendored))
+		return nil
+	}
+
+	return ioutil.WriteFile(output, vendored, 0644)
+}
+
+// vendorConfig rewrites every orb imported by the config, and by those orbs in
+// turn, into an inline orb definition.
+func (v *orbVendor) vendorConfig(raw []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(raw, &doc); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse config")
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, errors.New("config is empty")
+	}
+
+	if err := v.vendorOrbsOf(doc.Content[0]); err != nil {
+		return nil, err
+	}
+
+	return yaml.Marshal(&doc)
+}
+
+// vendorOrbsOf walks the `orbs` section of a config or orb mapping.
+func (v *orbVendor) vendorOrbsOf(node *yaml.Node) error {
+	orbs := mappingValue(node, "orbs")
+	if orbs == nil || orbs.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(orbs.Content); i += 2 {
+		name, value := orbs.Content[i].Value, orbs.Content[i+1]
+
+		switch value.Kind {
+		case yaml.ScalarNode:
+			inline, err := v.inlineOrb(value.Value)
+			if err != nil {
+				return errors.Wrapf(err, "Unable to vendor orb `%s`", name)
+			}
+			orbs.Content[i+1] = inline
+		case yaml.MappingNode:
+			// Already inline, but it may import orbs from the registry itself.
+			if err := v.vendorOrbsOf(value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (v *orbVendor) inlineOrb(ref string) (*yaml.Node, error) {
+	if source, ok := v.sources[ref]; ok {
+		return source, nil
+	}
+
+	for _, parent := range v.stack {
+		if parent == ref {
+			return nil, fmt.Errorf("orb `%s` imports itself", ref)
+		}
+	}
+	v.stack = append(v.stack, ref)
+	defer func() { v.stack = v.stack[:len(v.stack)-1] }()
+
+	source, err := v.fetch(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(source), &doc); err != nil {
+		return nil, errors.Wrapf(err, "Corrupt source for orb `%s`", ref)
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected the source of orb `%s` to be a map", ref)
+	}
+
+	orb := doc.Content[0]
+	if err := v.vendorOrbsOf(orb); err != nil {
+		return nil, err
+	}
+
+	v.sources[ref] = orb
+	return orb, nil
+}
+
+// mappingValue returns the value stored under key in a mapping node, or nil.
+func mappingValue(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+
+	return nil
+}
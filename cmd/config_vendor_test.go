@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Vendoring orbs", func() {
+	var (
+		sources map[string]string
+		fetched map[string]int
+		vendor  *orbVendor
+	)
+
+	BeforeEach(func() {
+		sources = map[string]string{}
+		fetched = map[string]int{}
+		vendor = newOrbVendor(func(ref string) (string, error) {
+			fetched[ref]++
+			source, ok := sources[ref]
+			if !ok {
+				return "", fmt.Errorf("no Orb '%s' was found; please check that the Orb reference is correct", ref)
+			}
+			return source, nil
+		})
+	})
+
+	It("inlines orbs and the orbs they import", func() {
+		sources["circleci/node@5.0.2"] = `version: 2.1
+orbs:
+  shared: circleci/shared@1.0.0
+commands:
+  install:
+    steps:
+      - run: npm ci
+`
+		sources["circleci/shared@1.0.0"] = `version: 2.1
+commands:
+  greet:
+    steps:
+      - run: echo hello
+`
+
+		vendored, err := vendor.vendorConfig([]byte(`version: 2.1
+orbs:
+  node: circleci/node@5.0.2
+  local:
+    orbs:
+      shared: circleci/shared@1.0.0
+    commands:
+      noop:
+        steps:
+          - run: "true"
+workflows:
+  main:
+    jobs: []
+`))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(vendored).To(MatchYAML(`version: 2.1
+orbs:
+  node:
+    version: 2.1
+    orbs:
+      shared:
+        version: 2.1
+        commands:
+          greet:
+            steps:
+              - run: echo hello
+    commands:
+      install:
+        steps:
+          - run: npm ci
+  local:
+    orbs:
+      shared:
+        version: 2.1
+        commands:
+          greet:
+            steps:
+              - run: echo hello
+    commands:
+      noop:
+        steps:
+          - run: "true"
+workflows:
+  main:
+    jobs: []
+`))
+		Expect(fetched["circleci/shared@1.0.0"]).To(Equal(1))
+	})
+
+	It("leaves a config without orbs untouched", func() {
+		vendored, err := vendor.vendorConfig([]byte("version: 2.1\njobs:\n  build:\n    docker:\n      - image: cimg/base:stable\n"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(vendored).To(MatchYAML("version: 2.1\njobs:\n  build:\n    docker:\n      - image: cimg/base:stable\n"))
+		Expect(fetched).To(BeEmpty())
+	})
+
+	It("reports orbs that import themselves", func() {
+		sources["ns/a@1.0.0"] = "orbs:\n  b: ns/b@1.0.0\n"
+		sources["ns/b@1.0.0"] = "orbs:\n  a: ns/a@1.0.0\n"
+
+		_, err := vendor.vendorConfig([]byte("orbs:\n  a: ns/a@1.0.0\n"))
+		Expect(err).Should(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring("orb `ns/a@1.0.0` imports itself"))
+	})
+
+	It("reports orbs that cannot be fetched", func() {
+		_, err := vendor.vendorConfig([]byte("orbs:\n  missing: ns/missing@1.0.0\n"))
+		Expect(err).To(MatchError("Unable to vendor orb `missing`: no Orb 'ns/missing@1.0.0' was found; please check that the Orb reference is correct"))
+	})
+})
@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/CircleCI-Public/circleci-cli/local"
+	"github.com/olekukonko/tablewriter"
+	"github.com/spf13/cobra"
+)
+
+type localCacheOptions struct {
+	dir       string
+	olderThan time.Duration
+	all       bool
+}
+
+func newLocalCacheCommand() *cobra.Command {
+	opts := localCacheOptions{dir: local.CacheDir()}
+
+	cacheCommand := &cobra.Command{
+		Use:   "cache",
+		Short: "Manage the caches saved by local builds",
+		Long: `Manage the caches saved by local builds.
+
+The save_cache and restore_cache steps of jobs run locally use the caches kept
+in ~/.circleci/local-cache, where they are stored by content.`,
+	}
+
+	listCommand := &cobra.Command{
+		Use:     "ls",
+		Aliases: []string{"list"},
+		Short:   "List the caches saved by local builds, the most recent first",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return listLocalCache(cmd.OutOrStdout(), opts)
+		},
+		Args: cobra.NoArgs,
+	}
+
+	pruneCommand := &cobra.Command{
+		Use:   "prune",
+		Short: "Remove the caches saved by local builds that were not saved recently",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return pruneLocalCache(cmd.OutOrStdout(), opts)
+		},
+		Args: cobra.NoArgs,
+	}
+	pruneCommand.Flags().DurationVar(&opts.olderThan, "older-than", 30*24*time.Hour, "remove the caches saved longer ago than this")
+	pruneCommand.Flags().BoolVar(&opts.all, "all", false, "remove all the caches")
+
+	cacheCommand.AddCommand(listCommand)
+	cacheCommand.AddCommand(pruneCommand)
+
+	return cacheCommand
+}
+
+func listLocalCache(w io.Writer, opts localCacheOptions) error {
+	entries, err := local.ListCache(opts.dir)
+	if err != nil {
+		return err
+	}
+
+	if len(entries) == 0 {
+		fmt.Fprintln(w, "No caches were saved by local builds.")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Key", "Size", "Saved"})
+	for _, entry := range entries {
+		table.Append([]string{entry.Key, formatBytes(entry.Size), entry.Saved.Format(time.RFC3339)})
+	}
+	table.Render()
+
+	return nil
+}
+
+func pruneLocalCache(w io.Writer, opts localCacheOptions) error {
+	before := time.Now().Add(-opts.olderThan)
+	if opts.all {
+		before = time.Now().Add(time.Minute)
+	}
+
+	removed, freed, err := local.PruneCache(opts.dir, before)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "Removed %d caches, freeing %s\n", removed, formatBytes(freed))
+	return nil
+}
+
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
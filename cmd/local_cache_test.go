@@ -0,0 +1,74 @@
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/CircleCI-Public/circleci-cli/clitest"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/gbytes"
+	"github.com/onsi/gomega/gexec"
+)
+
+var _ = Describe("local cache", func() {
+	var (
+		tempSettings *clitest.TempSettings
+		cache        string
+	)
+
+	BeforeEach(func() {
+		tempSettings = clitest.WithTempSettings()
+
+		cache = filepath.Join(tempSettings.Home, ".circleci", "local-cache")
+		Expect(os.MkdirAll(filepath.Join(cache, "objects"), 0700)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(cache, "keys"), 0700)).To(Succeed())
+
+		write := func(name, content string, age time.Duration) {
+			path := filepath.Join(cache, name)
+			Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+			modified := time.Now().Add(-age)
+			Expect(os.Chtimes(path, modified, modified)).To(Succeed())
+		}
+		write("objects/aaa.tar", "archive", 0)
+		write("objects/bbb.tar", "newer archive", 0)
+		write("keys/1", "aaa\nv1-deps-main\n", 60*24*time.Hour)
+		write("keys/2", "bbb\nv1-deps-feature\n", time.Hour)
+	})
+
+	AfterEach(func() {
+		tempSettings.Close()
+	})
+
+	It("lists the caches, the most recent first", func() {
+		command := commandWithHome(pathCLI, tempSettings.Home, "local", "cache", "ls", "--skip-update-check")
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say(`v1-deps-feature\s+\|\s+13 B`))
+		Expect(session.Out).To(gbytes.Say(`v1-deps-main\s+\|\s+7 B`))
+	})
+
+	It("prunes the caches older than a month by default", func() {
+		command := commandWithHome(pathCLI, tempSettings.Home, "local", "cache", "prune", "--skip-update-check")
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("Removed 1 caches, freeing 7 B"))
+		Expect(filepath.Join(cache, "objects", "aaa.tar")).NotTo(BeAnExistingFile())
+		Expect(filepath.Join(cache, "objects", "bbb.tar")).To(BeAnExistingFile())
+	})
+
+	It("prunes all the caches", func() {
+		command := commandWithHome(pathCLI, tempSettings.Home, "local", "cache", "prune", "--all", "--skip-update-check")
+		session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(session).Should(gexec.Exit(0))
+		Expect(session.Out).To(gbytes.Say("Removed 2 caches, freeing 20 B"))
+	})
+})
@@ -52,6 +52,18 @@ type orbOptions struct {
 	tty createOrbUserInterface
 	// Linked with --integration-testing flag for stubbing UI in gexec tests
 	integrationTesting bool
+	// Pick or check the segment of `orb publish increment` from the changes
+	// since the latest released version
+	incrementAuto   bool
+	incrementStrict bool
+	// Options of `admin import-orb` and `orb export`
+	allVersions           bool
+	importResume          bool
+	importContinueOnError bool
+	importStateFile       string
+	importBundle          string
+	importConcurrency     int
+	exportOutput          string
 }
 
 var orbAnnotations = map[string]string{
@@ -179,11 +191,17 @@ Example: 'circleci orb publish promote foo/bar@dev:master major' => foo/bar@1.0.
 	promoteCommand.Annotations["<segment>"] = `"major"|"minor"|"patch"`
 
 	incrementCommand := &cobra.Command{
-		Use:   "increment <path> <namespace>/<orb> <segment>",
+		Use:   "increment <path> <namespace>/<orb> [<segment>]",
 		Short: "Increment a released version of an orb",
 		Long: `Increment a released version of an orb.
 Please note that at this time all orbs incremented within the registry are world-readable.
 
+With --auto, the segment is picked from the changes to the commands, jobs and
+executors of the orb since its latest released version, like 'circleci orb diff'
+would classify them: major for breaking changes, minor for features, and patch
+otherwise. With --strict, a patch or minor release containing breaking changes
+is refused.
+
 Example: 'circleci orb publish increment foo/orb.yml foo/bar minor' => foo/bar@1.1.0`,
 		RunE: func(_ *cobra.Command, _ []string) error {
 			return incrementOrb(opts)
@@ -191,12 +209,14 @@ Example: 'circleci orb publish increment foo/orb.yml foo/bar minor' => foo/bar@1
 		PreRunE: func(_ *cobra.Command, _ []string) error {
 			return validateToken(opts.cfg)
 		},
-		Args:        cobra.ExactArgs(3),
+		Args:        cobra.RangeArgs(2, 3),
 		Annotations: make(map[string]string),
 		Aliases:     []string{"inc"},
 	}
 	incrementCommand.Annotations["<path>"] = orbAnnotations["<path>"]
-	incrementCommand.Annotations["<segment>"] = `"major"|"minor"|"patch"`
+	incrementCommand.Annotations["<segment>"] = `"major"|"minor"|"patch" (Optional with --auto)`
+	incrementCommand.Flags().BoolVar(&opts.incrementAuto, "auto", false, "pick the segment from the changes since the latest released version")
+	incrementCommand.Flags().BoolVar(&opts.incrementStrict, "strict", false, "refuse a patch or minor release containing breaking changes")
 
 	publishCommand.AddCommand(promoteCommand)
 	publishCommand.AddCommand(incrementCommand)
@@ -233,6 +253,32 @@ listing of the orb in the registry.`,
 	sourceCommand.Example = `  circleci orb source circleci/python@0.1.4 # grab the source at version 0.1.4
   circleci orb source my-ns/foo-orb@dev:latest # grab the source of dev release "latest"`
 
+	mirrorOpts := orbMirrorOptions{}
+	orbMirrorCommand := &cobra.Command{
+		Use:   "mirror <namespace|orb>",
+		Short: "Save orbs to a local directory, to use them without the registry",
+		Long: `Save the source and the meta-data of orbs to a local directory.
+
+Mirror a single orb with namespace/orb, or every orb of a namespace. Only the
+latest version of each orb is saved, unless --all-versions is given. Versions
+already in the directory are not fetched again.
+
+When the orb_mirror_dir setting, or the CIRCLECI_CLI_ORB_MIRROR_DIR environment
+variable, names a mirror, 'orb source', 'orb info', 'orb diff', 'orb docs',
+'orb unpack', 'orb publish increment' and 'config vendor-orbs' read the orbs it
+holds from it rather than from the registry.`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return mirrorOrbsCommand(opts, mirrorOpts)
+		},
+		Args:        cobra.ExactArgs(1),
+		Annotations: make(map[string]string),
+	}
+	orbMirrorCommand.Annotations["<namespace|orb>"] = "A namespace, or an orb in the form namespace/orb"
+	orbMirrorCommand.Example = `  circleci orb mirror circleci/node --dir ./orb-mirror
+  circleci orb mirror my-ns --dir ./orb-mirror --all-versions`
+	orbMirrorCommand.Flags().StringVar(&mirrorOpts.dir, "dir", "", "directory of the mirror, defaults to the orb_mirror_dir setting")
+	orbMirrorCommand.Flags().BoolVar(&mirrorOpts.allVersions, "all-versions", false, "save every published version rather than the latest one")
+
 	orbInfoCmd := &cobra.Command{
 		Use:   "info <orb>",
 		Short: "Show the meta-data of an orb",
@@ -277,6 +323,177 @@ Please note that at this time all orbs created in the registry are world-readabl
 		Args: cobra.ExactArgs(1),
 	}
 
+	var diffJSON bool
+	orbDiffCommand := &cobra.Command{
+		Use:   "diff <orb> <orb|path>",
+		Short: "Show the changes to the interface of an orb between two versions",
+		Long: `Show the changes to the interface of an orb between two versions.
+
+Each version is either a reference to a version in the registry, the path to
+an orb source directory to pack, or the path to an orb.yml. The commands, jobs
+and executors of both versions are compared by their parameters, and every
+change is classified as:
+
+  breaking  an element or a parameter was removed, a required parameter was
+            added, an optional parameter became required, or the type of a
+            parameter changed or its enum values were narrowed
+  feature   an element or an optional parameter was added, a parameter became
+            optional, or its enum values were widened
+  fix       a default value, a description or the implementation of an
+            element changed`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return diffOrbCommand(opts, diffJSON)
+		},
+		Args:        cobra.ExactArgs(2),
+		Annotations: make(map[string]string),
+	}
+	orbDiffCommand.Annotations["<orb>"] = orbAnnotations["<orb>"]
+	orbDiffCommand.Annotations["<path>"] = "The path to the source of your orb, or to an orb.yml"
+	orbDiffCommand.Example = `  circleci orb diff my-ns/my-orb@1.2.0 my-ns/my-orb@2.0.0
+  circleci orb diff my-ns/my-orb@volatile src --json`
+	orbDiffCommand.Flags().BoolVar(&diffJSON, "json", false, "print the changes as JSON instead of human-readable")
+
+	lintOpts := orbLintOptions{}
+	orbLint := &cobra.Command{
+		Use:   "lint <path>",
+		Short: "Check the source of an orb against the orb-tools review rules",
+		Long: fmt.Sprintf(`Check the source of an orb against the orb-tools review rules.
+
+The rules are:
+%s
+A rule is skipped for the whole orb with --skip, or with a comment in @orb.yml,
+and for a single command, job, executor or example with a comment in its file:
+
+  # orb-lint-skip: job-examples, parameterized-image-tags`, orbLintRulesHelp()),
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return lintOrbCommand(opts, lintOpts)
+		},
+		Args:        cobra.ExactArgs(1),
+		Annotations: make(map[string]string),
+	}
+	orbLint.Annotations["<path>"] = "The path to the source of your orb, the directory holding @orb.yml"
+	orbLint.Example = `  circleci orb lint src
+  circleci orb lint src --skip job-examples --format junit -o test-results/lint.xml`
+	orbLint.Flags().StringSliceVar(&lintOpts.skip, "skip", nil, "rules to skip, may be repeated")
+	orbLint.Flags().StringVar(&lintOpts.format, "format", orbLintFormatText, fmt.Sprintf("format of the findings, one of: %s, %s, %s", orbLintFormatText, orbLintFormatJSON, orbLintFormatJUnit))
+	orbLint.Flags().StringVarP(&lintOpts.output, "output", "o", "", "write the findings to this file instead of STDOUT")
+
+	orbUnpack := &cobra.Command{
+		Use:   "unpack <orb> <path>",
+		Short: "Unpack a published orb into a source tree",
+		Long: `Unpack a published orb into a source tree, the inverse of 'circleci orb pack'.
+
+The source is written to the given directory, which must be empty: @orb.yml,
+and a file per command, job, executor and example. The long commands of run
+steps are moved to scripts/, included back with <<include(scripts/...)>>, unless
+they use parameters. Packing the directory again gives back the same orb.`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return unpackOrbCommand(opts)
+		},
+		Args:        cobra.ExactArgs(2),
+		Annotations: make(map[string]string),
+	}
+	orbUnpack.Annotations["<orb>"] = "A fully-qualified reference to an orb, or the path to an orb.yml"
+	orbUnpack.Annotations["<path>"] = "The directory to write the source of the orb to"
+	orbUnpack.Example = `  circleci orb unpack my-ns/my-orb@1.2.0 src
+  circleci orb unpack orb.yml src`
+
+	orbExport := &cobra.Command{
+		Use:   "export <namespace|orb>...",
+		Short: "Export orbs to a bundle to import into a CircleCI Server installation",
+		Long: `Export orbs to a bundle, to import them into a CircleCI Server installation
+without access to circleci.com with 'circleci admin import-orb --from-bundle'.
+
+The bundle is a gzipped tarball holding the source of every orb version, and a
+manifest with their metadata and the SHA-256 checksum of their sources.`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return exportOrbsCommand(opts)
+		},
+		Args:        cobra.MinimumNArgs(1),
+		Annotations: make(map[string]string),
+	}
+	orbExport.Annotations["<namespace|orb>"] = "A namespace, an orb in the form namespace/orb, or an orb version in the form namespace/orb@version"
+	orbExport.Example = `  circleci orb export circleci/node circleci/python@2.1.1 -o orbs.tar.gz
+  circleci orb export my-ns --all-versions -o my-ns.tar.gz`
+	orbExport.Flags().StringVarP(&opts.exportOutput, "output", "o", "", "file to write the bundle to")
+	orbExport.Flags().BoolVar(&opts.allVersions, "all-versions", false, "export every version of the orbs rather than the latest one")
+	if err := orbExport.MarkFlagRequired("output"); err != nil {
+		panic(err)
+	}
+
+	docsOpts := orbDocsOptions{}
+	orbDocs := &cobra.Command{
+		Use:   "docs <orb>",
+		Short: "Generate the documentation of an orb",
+		Long: `Generate the documentation of an orb as Markdown or HTML.
+
+The documentation holds the description of the orb, a table of the parameters
+of every command, job and executor, and the examples of the orb. It is useful
+for private orbs, which have no page in the orb registry.`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return orbDocsCommand(opts, docsOpts)
+		},
+		Args:        cobra.ExactArgs(1),
+		Annotations: make(map[string]string),
+	}
+	orbDocs.Annotations["<orb>"] = "A fully-qualified reference to an orb, the path to its source or to an orb.yml"
+	orbDocs.Example = `  circleci orb docs my-ns/my-orb@1.2.0
+  circleci orb docs src --format html -o docs`
+	orbDocs.Flags().StringVar(&docsOpts.format, "format", "md", "format of the documentation, one of: md, html")
+	orbDocs.Flags().StringVarP(&docsOpts.output, "output", "o", "", "write README.md or index.html to this directory instead of STDOUT")
+
+	testOpts := orbTestOptions{}
+	orbTest := &cobra.Command{
+		Use:   "test <path>",
+		Short: "Test an orb from its source, without publishing it",
+		Long: `Test an orb from its source, without publishing it.
+
+The orb is packed like 'circleci orb pack' would, then every example of the orb
+and every config of the tests directory is compiled with the packed orb inline.
+It replaces the orb imported under the name given with --name, or imported from
+the registry under that name, like 'node: circleci/node@5'; configs without
+orbs get it under that name. A test fails when its config imports other orbs
+but not this one, when its config does not compile, or when its compiled form
+does not meet the expectations of the test:
+
+  description: Runs the tests with the given command
+  config:
+    version: 2.1
+    workflows:
+      main:
+        jobs:
+          - my-orb/test:
+              command: make test
+  expect:
+    - path: jobs.my-orb/test.steps[1].run.command
+      contains: make test
+    - path: jobs.my-orb/test.docker[0].image
+      matches: ^cimg/
+    - path: jobs.my-orb/test.resource_class
+      exists: false
+
+An expectation checks the value at its path with equals, contains, matches (a
+regular expression) or exists. A test may instead expect the config to fail to
+compile with an error containing the given text:
+
+  error: Missing required argument
+
+The results are printed in the TAP format, or as JUnit XML.`,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return testOrb(opts, testOpts)
+		},
+		Args:        cobra.ExactArgs(1),
+		Annotations: make(map[string]string),
+	}
+	orbTest.Annotations["<path>"] = "The path to the source of your orb, the directory holding @orb.yml"
+	orbTest.Example = `  circleci orb test src
+  circleci orb test src --format junit -o test-results/orb.xml`
+	orbTest.Flags().StringVar(&testOpts.name, "name", "", "name the examples and tests import the orb under (defaults to the name of the orb project directory)")
+	orbTest.Flags().StringVar(&testOpts.tests, "tests", "", "directory of the test configs (defaults to the tests directory next to the orb source)")
+	orbTest.Flags().StringVar(&testOpts.format, "format", orbTestFormatTAP, fmt.Sprintf("format of the results, one of: %s, %s", orbTestFormatTAP, orbTestFormatJUnit))
+	orbTest.Flags().StringVarP(&testOpts.output, "output", "o", "", "write the results to this file instead of STDOUT")
+	orbTest.Flags().StringVar(&testOpts.orgID, "org-id", "", "organization id used when the orb depends on private orbs belonging to that org")
+
 	listCategoriesCommand := &cobra.Command{
 		Use:   "list-categories",
 		Short: "List orb categories",
@@ -349,7 +566,14 @@ Please note that at this time all orbs created in the registry are world-readabl
 	orbCommand.AddCommand(unlistCmd)
 	orbCommand.AddCommand(sourceCommand)
 	orbCommand.AddCommand(orbInfoCmd)
+	orbCommand.AddCommand(orbMirrorCommand)
+	orbCommand.AddCommand(orbExport)
 	orbCommand.AddCommand(orbPack)
+	orbCommand.AddCommand(orbUnpack)
+	orbCommand.AddCommand(orbTest)
+	orbCommand.AddCommand(orbDiffCommand)
+	orbCommand.AddCommand(orbLint)
+	orbCommand.AddCommand(orbDocs)
 	orbCommand.AddCommand(addCategorizationToOrbCommand)
 	orbCommand.AddCommand(removeCategorizationFromOrbCommand)
 	orbCommand.AddCommand(listCategoriesCommand)
@@ -370,27 +594,25 @@ See a full explanation and documentation on orbs here: %s`, config.Data.Links.Or
 }
 
 func parameterDefaultToString(parameter api.OrbElementParameter) string {
-	defaultValue := " (default: '"
+	value, ok := parameterDefaultValue(parameter)
+	if !ok {
+		return ""
+	}
+
+	return " (default: '" + value + "')"
+}
 
+// parameterDefaultValue returns the default value of a parameter, if it has
+// one worth showing.
+func parameterDefaultValue(parameter api.OrbElementParameter) (string, bool) {
 	// If there isn't a default or the default value is for a steps parameter
 	// then just ignore the value.
 	// It's possible to have a very large list of steps that pollutes the output.
 	if parameter.Default == nil || parameter.Type == "steps" {
-		return ""
-	}
-
-	switch parameter.Type {
-	case "enum":
-		defaultValue += parameter.Default.(string)
-	case "string":
-		defaultValue += parameter.Default.(string)
-	case "boolean":
-		defaultValue += fmt.Sprintf("%t", parameter.Default.(bool))
-	default:
-		defaultValue += ""
+		return "", false
 	}
 
-	return defaultValue + "')"
+	return fmt.Sprint(parameter.Default), true
 }
 
 // nolint: errcheck, gosec
@@ -752,10 +974,20 @@ func validateSegmentArg(label string) error {
 
 func incrementOrb(opts orbOptions) error {
 	ref := opts.args[1]
-	segment := opts.args[2]
+	segment := ""
+	if len(opts.args) > 2 {
+		segment = opts.args[2]
+	}
 
-	if err := validateSegmentArg(segment); err != nil {
-		return err
+	switch {
+	case opts.incrementAuto && segment != "":
+		return errors.New("--auto picks the segment, it cannot be given too")
+	case !opts.incrementAuto && segment == "":
+		return errors.New("the segment to increment is required, unless --auto is used")
+	case segment != "":
+		if err := validateSegmentArg(segment); err != nil {
+			return err
+		}
 	}
 
 	namespace, orb, err := references.SplitIntoOrbAndNamespace(ref)
@@ -763,6 +995,13 @@ func incrementOrb(opts orbOptions) error {
 		return err
 	}
 
+	if opts.incrementAuto || opts.incrementStrict {
+		segment, err = analyzeIncrement(opts, opts.args[0], namespace, orb, segment)
+		if err != nil {
+			return err
+		}
+	}
+
 	response, err := api.OrbIncrementVersion(opts.cl, opts.args[0], namespace, orb, segment)
 
 	if err != nil {
@@ -778,6 +1017,51 @@ func incrementOrb(opts orbOptions) error {
 	return nil
 }
 
+// analyzeIncrement compares the orb with its latest released version, to
+// pick the segment to increment when none is given, or to check the one given
+// is allowed.
+func analyzeIncrement(opts orbOptions, path, namespace, orb, segment string) (string, error) {
+	if path == "-" {
+		return "", errors.New("--auto and --strict require the path of the orb, instead of STDIN")
+	}
+
+	latest, err := api.OrbLatestVersion(opts.cl, namespace, orb)
+	if err != nil {
+		return "", err
+	}
+	if latest == "0.0.0" {
+		if segment == "" {
+			return "", fmt.Errorf("`%s/%s` has no released version to compare with, please give the segment to increment", namespace, orb)
+		}
+		return segment, nil
+	}
+
+	diff, err := diffOrbs(opts, fmt.Sprintf("%s/%s@%s", namespace, orb, latest), path)
+	if err != nil {
+		return "", err
+	}
+	printOrbDiff(os.Stdout, diff)
+	fmt.Println()
+
+	return pickIncrementSegment(diff, segment, opts.incrementStrict)
+}
+
+// pickIncrementSegment returns the segment the changes call for when none is
+// given, or the given one unless it hides breaking changes in strict mode.
+func pickIncrementSegment(diff orbDiff, segment string, strict bool) (string, error) {
+	if segment == "" {
+		if diff.Release == "none" {
+			return "patch", nil
+		}
+		return diff.Release, nil
+	}
+
+	if strict && diff.Release == "major" && segment != "major" {
+		return "", fmt.Errorf("refusing to publish a %s release with breaking changes, which call for a major release", segment)
+	}
+	return segment, nil
+}
+
 func promoteOrb(opts orbOptions) error {
 	ref := opts.args[0]
 	segment := opts.args[1]
@@ -852,7 +1136,7 @@ If you change your mind about the name, you will have to create a new orb with t
 func showSource(opts orbOptions) error {
 	ref := opts.args[0]
 
-	source, err := api.OrbSource(opts.cl, ref)
+	source, err := fetchOrbSource(opts.cfg, opts.cl, ref)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to get source for '%s'", ref)
 	}
@@ -863,7 +1147,7 @@ func showSource(opts orbOptions) error {
 func orbInfo(opts orbOptions) error {
 	ref := opts.args[0]
 
-	info, err := api.OrbInfo(opts.cl, ref)
+	info, err := fetchOrbInfo(opts.cfg, opts.cl, ref)
 	if err != nil {
 		return errors.Wrapf(err, "Failed to get info for '%s'", ref)
 	}
@@ -984,27 +1268,9 @@ func packOrbCommand(opts orbOptions) error {
 }
 
 func packOrb(path string) (string, error) {
-	// Travel our Orb and build a tree from the YAML files.
-	// Non-YAML files will be ignored here.
-	_, err := os.Stat(filepath.Join(path, "@orb.yml"))
-	if err != nil {
-		return "", errors.New("@orb.yml file not found, are you sure this is the Orb root?")
-	}
-
-	tree, err := filetree.NewTree(path, "executors", "jobs", "commands", "examples")
+	orbSchema, err := loadOrbSchema(path)
 	if err != nil {
-		return "", errors.Wrap(err, "An unexpected error occurred")
-	}
-
-	y, err := yaml.Marshal(&tree)
-	if err != nil {
-		return "", errors.Wrap(err, "An unexpected error occurred")
-	}
-
-	var orbSchema OrbSchema
-	err = yaml.Unmarshal(y, &orbSchema)
-	if err != nil {
-		return "", errors.Wrap(err, "An unexpected error occurred")
+		return "", err
 	}
 
 	err = func(nodes ...*yaml.Node) error {
@@ -1020,7 +1286,7 @@ func packOrb(path string) (string, error) {
 		return "", err
 	}
 
-	final, err := yaml.Marshal(&orbSchema)
+	final, err := yaml.Marshal(orbSchema)
 	if err != nil {
 		return "", errors.Wrap(err, "Failed trying to marshal Orb YAML")
 	}
@@ -1028,6 +1294,34 @@ func packOrb(path string) (string, error) {
 	return string(final), nil
 }
 
+// loadOrbSchema reads the source of an orb, without inlining its includes.
+func loadOrbSchema(path string) (*OrbSchema, error) {
+	// Travel our Orb and build a tree from the YAML files.
+	// Non-YAML files will be ignored here.
+	_, err := os.Stat(filepath.Join(path, "@orb.yml"))
+	if err != nil {
+		return nil, errors.New("@orb.yml file not found, are you sure this is the Orb root?")
+	}
+
+	tree, err := filetree.NewTree(path, "executors", "jobs", "commands", "examples")
+	if err != nil {
+		return nil, errors.Wrap(err, "An unexpected error occurred")
+	}
+
+	y, err := yaml.Marshal(&tree)
+	if err != nil {
+		return nil, errors.Wrap(err, "An unexpected error occurred")
+	}
+
+	var orbSchema OrbSchema
+	err = yaml.Unmarshal(y, &orbSchema)
+	if err != nil {
+		return nil, errors.Wrap(err, "An unexpected error occurred")
+	}
+
+	return &orbSchema, nil
+}
+
 // Travel down a YAML node, replacing values as we go.
 func inlineIncludes(node *yaml.Node, orbRoot string) error {
 	// If we're dealing with a ScalarNode, we can replace the contents.
@@ -0,0 +1,178 @@
+package cmd
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/CircleCI-Public/circleci-cli/api"
+	"github.com/pkg/errors"
+)
+
+// orbBundleManifest is the file of a bundle listing the orb versions it
+// carries, with the checksum of their sources.
+const orbBundleManifest = "manifest.json"
+
+// orbBundleVersion is an orb version in the manifest of a bundle. Its source
+// is the file at Path in the bundle.
+type orbBundleVersion struct {
+	Orb       string `json:"orb"`
+	Namespace string `json:"namespace"`
+	Version   string `json:"version"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	Path      string `json:"path"`
+	SHA256    string `json:"sha256"`
+}
+
+type orbBundle struct {
+	Versions []orbBundleVersion `json:"versions"`
+}
+
+func exportOrbsCommand(opts orbOptions) error {
+	versions, err := fetchOrbVersions(opts.cl, opts.args, opts.allVersions)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(opts.exportOutput)
+	if err != nil {
+		return errors.Wrap(err, "Unable to create the bundle")
+	}
+	defer file.Close()
+
+	if err := writeOrbBundle(file, versions); err != nil {
+		return err
+	}
+
+	fmt.Printf("Exported %d orb version(s) to %s\n", len(versions), opts.exportOutput)
+	fmt.Printf("Import them with `circleci admin import-orb --from-bundle %s`.\n", opts.exportOutput)
+	return nil
+}
+
+// writeOrbBundle writes the sources of the versions to a gzipped tarball, as
+// <namespace>/<orb>/<version>.yml, followed by the manifest.
+func writeOrbBundle(w io.Writer, versions []api.OrbVersion) error {
+	gz := gzip.NewWriter(w)
+	archive := tar.NewWriter(gz)
+
+	write := func(name string, contents []byte) error {
+		header := &tar.Header{
+			Name:     name,
+			Mode:     0644,
+			Size:     int64(len(contents)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			return errors.Wrap(err, "Unable to write the bundle")
+		}
+		_, err := archive.Write(contents)
+		return errors.Wrap(err, "Unable to write the bundle")
+	}
+
+	var bundle orbBundle
+	for _, v := range versions {
+		name := path.Join(v.Orb.Name, v.Version+".yml")
+		sum := sha256.Sum256([]byte(v.Source))
+		bundle.Versions = append(bundle.Versions, orbBundleVersion{
+			Orb:       v.Orb.Name,
+			Namespace: v.Orb.Namespace.Name,
+			Version:   v.Version,
+			CreatedAt: v.CreatedAt,
+			Path:      name,
+			SHA256:    hex.EncodeToString(sum[:]),
+		})
+
+		if err := write(name, []byte(v.Source)); err != nil {
+			return err
+		}
+	}
+
+	manifest, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to convert to JSON")
+	}
+	if err := write(orbBundleManifest, manifest); err != nil {
+		return err
+	}
+
+	if err := archive.Close(); err != nil {
+		return errors.Wrap(err, "Unable to write the bundle")
+	}
+	return errors.Wrap(gz.Close(), "Unable to write the bundle")
+}
+
+// readOrbBundle reads the orb versions of a bundle written by `orb export`,
+// checking their sources against the checksums of the manifest.
+func readOrbBundle(bundlePath string) ([]api.OrbVersion, error) {
+	file, err := os.Open(bundlePath) // #nosec
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the bundle: %s", err.Error())
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the bundle: %s", err.Error())
+	}
+	archive := tar.NewReader(gz)
+
+	files := map[string][]byte{}
+	for {
+		header, nextErr := archive.Next()
+		if nextErr == io.EOF {
+			break
+		}
+		if nextErr != nil {
+			return nil, fmt.Errorf("unable to read the bundle: %s", nextErr.Error())
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		contents, readErr := ioutil.ReadAll(archive)
+		if readErr != nil {
+			return nil, fmt.Errorf("unable to read the bundle: %s", readErr.Error())
+		}
+		files[header.Name] = contents
+	}
+
+	manifest, ok := files[orbBundleManifest]
+	if !ok {
+		return nil, fmt.Errorf("the bundle has no %s", orbBundleManifest)
+	}
+	var bundle orbBundle
+	if err := json.Unmarshal(manifest, &bundle); err != nil {
+		return nil, fmt.Errorf("unable to read the manifest of the bundle: %s", err.Error())
+	}
+
+	var versions []api.OrbVersion
+	for _, v := range bundle.Versions {
+		source, found := files[v.Path]
+		if !found {
+			return nil, fmt.Errorf("the bundle has no source for '%s@%s'", v.Orb, v.Version)
+		}
+		sum := sha256.Sum256(source)
+		if hex.EncodeToString(sum[:]) != v.SHA256 {
+			return nil, fmt.Errorf("the source of '%s@%s' does not match its checksum in the manifest", v.Orb, v.Version)
+		}
+
+		versions = append(versions, api.OrbVersion{
+			Version:   v.Version,
+			Source:    string(source),
+			CreatedAt: v.CreatedAt,
+			Orb: api.Orb{
+				Name:      v.Orb,
+				Namespace: api.Namespace{Name: v.Namespace},
+			},
+		})
+	}
+
+	return versions, nil
+}
@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/CircleCI-Public/circleci-cli/api"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Orb bundles", func() {
+	var (
+		dir      string
+		versions []api.OrbVersion
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "circleci-orb-bundle")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		orb := api.Orb{Name: "namespace1/orb", Namespace: api.Namespace{Name: "namespace1"}}
+		versions = []api.OrbVersion{
+			{Version: "0.0.1", Source: "version: 2.1\n", CreatedAt: "2018-09-24T08:53:37.086Z", Orb: orb},
+			{Version: "0.0.2", Source: "version: 2.1\ndescription: An orb\n", CreatedAt: "2018-10-11T22:12:19.477Z", Orb: orb},
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	// rewrite copies a bundle, replacing the contents of the given files.
+	rewrite := func(bundle []byte, replace map[string]string) []byte {
+		gz, err := gzip.NewReader(bytes.NewReader(bundle))
+		Expect(err).ShouldNot(HaveOccurred())
+		in := tar.NewReader(gz)
+
+		var out bytes.Buffer
+		outGz := gzip.NewWriter(&out)
+		archive := tar.NewWriter(outGz)
+		for {
+			header, nextErr := in.Next()
+			if nextErr != nil {
+				break
+			}
+			contents, readErr := ioutil.ReadAll(in)
+			Expect(readErr).ShouldNot(HaveOccurred())
+
+			if replacement, ok := replace[header.Name]; ok {
+				if replacement == "" {
+					continue
+				}
+				contents = []byte(replacement)
+				header.Size = int64(len(contents))
+			}
+			Expect(archive.WriteHeader(header)).To(Succeed())
+			_, err = archive.Write(contents)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+		Expect(archive.Close()).To(Succeed())
+		Expect(outGz.Close()).To(Succeed())
+		return out.Bytes()
+	}
+
+	write := func(bundle []byte) string {
+		path := filepath.Join(dir, "bundle.tar.gz")
+		Expect(ioutil.WriteFile(path, bundle, 0600)).To(Succeed())
+		return path
+	}
+
+	It("reads back the versions it exported", func() {
+		var bundle bytes.Buffer
+		Expect(writeOrbBundle(&bundle, versions)).To(Succeed())
+
+		read, err := readOrbBundle(write(bundle.Bytes()))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(read).To(Equal(versions))
+	})
+
+	It("rejects sources that do not match the manifest", func() {
+		var bundle bytes.Buffer
+		Expect(writeOrbBundle(&bundle, versions)).To(Succeed())
+
+		_, err := readOrbBundle(write(rewrite(bundle.Bytes(), map[string]string{
+			"namespace1/orb/0.0.2.yml": "version: 2.1\ndescription: Tampered\n",
+		})))
+		Expect(err).To(MatchError("the source of 'namespace1/orb@0.0.2' does not match its checksum in the manifest"))
+	})
+
+	It("rejects incomplete bundles", func() {
+		var bundle bytes.Buffer
+		Expect(writeOrbBundle(&bundle, versions)).To(Succeed())
+
+		_, err := readOrbBundle(write(rewrite(bundle.Bytes(), map[string]string{
+			"namespace1/orb/0.0.1.yml": "",
+		})))
+		Expect(err).To(MatchError("the bundle has no source for 'namespace1/orb@0.0.1'"))
+
+		_, err = readOrbBundle(write(rewrite(bundle.Bytes(), map[string]string{
+			"manifest.json": "",
+		})))
+		Expect(err).To(MatchError("the bundle has no manifest.json"))
+	})
+
+	It("is imported instead of fetching from circleci.com", func() {
+		var bundle bytes.Buffer
+		Expect(writeOrbBundle(&bundle, versions)).To(Succeed())
+
+		read, err := versionsToImport(orbOptions{importBundle: write(bundle.Bytes())})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(read).To(HaveLen(2))
+	})
+})
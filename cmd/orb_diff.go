@@ -0,0 +1,362 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"sort"
+
+	"github.com/CircleCI-Public/circleci-cli/api"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Kinds of changes between two versions of an orb, from the most to the
+// least significant.
+const (
+	orbChangeBreaking = "breaking"
+	orbChangeFeature  = "feature"
+	orbChangeFix      = "fix"
+)
+
+// orbChange is a change to the interface of an orb.
+type orbChange struct {
+	Kind string `json:"kind"`
+	// Element is like `jobs/test`.
+	Element   string `json:"element"`
+	Parameter string `json:"parameter,omitempty"`
+	Message   string `json:"message"`
+}
+
+// orbDiff holds the changes between two versions of an orb, and the
+// segment of the version to increment for them.
+type orbDiff struct {
+	From    string      `json:"from"`
+	To      string      `json:"to"`
+	Release string      `json:"release"`
+	Changes []orbChange `json:"changes"`
+}
+
+// orbInterface is what other configs rely on in an orb: its elements and
+// their parameters. The raw elements tell implementation changes apart.
+type orbInterface struct {
+	Commands  map[string]api.OrbElement `yaml:"commands"`
+	Jobs      map[string]api.OrbElement `yaml:"jobs"`
+	Executors map[string]api.OrbElement `yaml:"executors"`
+
+	raw map[string]interface{}
+}
+
+func diffOrbCommand(opts orbOptions, asJSON bool) error {
+	diff, err := diffOrbs(opts, opts.args[0], opts.args[1])
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return printOrbDiffJSON(os.Stdout, diff)
+	}
+	printOrbDiff(os.Stdout, diff)
+	return nil
+}
+
+func diffOrbs(opts orbOptions, from, to string) (orbDiff, error) {
+	fromSource, err := loadOrbSource(opts, from)
+	if err != nil {
+		return orbDiff{}, err
+	}
+	toSource, err := loadOrbSource(opts, to)
+	if err != nil {
+		return orbDiff{}, err
+	}
+
+	changes, err := diffOrbSources(fromSource, toSource)
+	if err != nil {
+		return orbDiff{}, err
+	}
+
+	return orbDiff{
+		From:    from,
+		To:      to,
+		Release: orbReleaseSegment(changes),
+		Changes: changes,
+	}, nil
+}
+
+// loadOrbSource returns the source of an orb given as a directory to pack,
+// as an orb.yml file, or as a reference to a version in the mirror or the
+// registry.
+func loadOrbSource(opts orbOptions, orb string) (string, error) {
+	info, err := os.Stat(orb)
+	switch {
+	case err == nil && info.IsDir():
+		return packOrb(orb)
+	case err == nil:
+		source, readErr := ioutil.ReadFile(orb) // #nosec
+		if readErr != nil {
+			return "", errors.Wrapf(readErr, "Unable to read the orb at %s", orb)
+		}
+		return string(source), nil
+	}
+
+	version, err := fetchOrbInfo(opts.cfg, opts.cl, orb)
+	if err != nil {
+		return "", errors.Wrapf(err, "Failed to get the orb '%s'", orb)
+	}
+	return version.Source, nil
+}
+
+func parseOrbInterface(source string) (*orbInterface, error) {
+	var orb orbInterface
+	if err := yaml.Unmarshal([]byte(source), &orb); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the orb")
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal([]byte(source), &raw); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the orb")
+	}
+	orb.raw = raw
+
+	return &orb, nil
+}
+
+// diffOrbSources compares the commands, jobs and executors of two versions
+// of an orb.
+func diffOrbSources(from, to string) ([]orbChange, error) {
+	before, err := parseOrbInterface(from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := parseOrbInterface(to)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []orbChange
+	changes = append(changes, diffOrbElements("commands", before.Commands, after.Commands, before.raw, after.raw)...)
+	changes = append(changes, diffOrbElements("executors", before.Executors, after.Executors, before.raw, after.raw)...)
+	changes = append(changes, diffOrbElements("jobs", before.Jobs, after.Jobs, before.raw, after.raw)...)
+	return changes, nil
+}
+
+func diffOrbElements(kind string, before, after map[string]api.OrbElement, beforeRaw, afterRaw map[string]interface{}) []orbChange {
+	var changes []orbChange
+
+	for _, name := range orbElementNames(before, after) {
+		element := kind + "/" + name
+		prev, hadElement := before[name]
+		next, hasElement := after[name]
+
+		switch {
+		case !hasElement:
+			changes = append(changes, orbChange{orbChangeBreaking, element, "", "removed"})
+			continue
+		case !hadElement:
+			changes = append(changes, orbChange{orbChangeFeature, element, "", "added"})
+			continue
+		}
+
+		elementChanges := diffOrbParameters(element, prev.Parameters, next.Parameters)
+		if prev.Description != next.Description {
+			elementChanges = append(elementChanges, orbChange{orbChangeFix, element, "", "description changed"})
+		}
+		if len(elementChanges) == 0 && !reflect.DeepEqual(rawOrbElement(beforeRaw, kind, name), rawOrbElement(afterRaw, kind, name)) {
+			elementChanges = append(elementChanges, orbChange{orbChangeFix, element, "", "implementation changed"})
+		}
+		changes = append(changes, elementChanges...)
+	}
+
+	return changes
+}
+
+func rawOrbElement(raw map[string]interface{}, kind, name string) interface{} {
+	elements, _ := raw[kind].(map[string]interface{})
+	return elements[name]
+}
+
+func diffOrbParameters(element string, before, after map[string]api.OrbElementParameter) []orbChange {
+	var changes []orbChange
+	change := func(kind, parameter, format string, args ...interface{}) {
+		changes = append(changes, orbChange{kind, element, parameter, fmt.Sprintf(format, args...)})
+	}
+
+	for _, name := range orbParameterNames(before, after) {
+		prev, hadParameter := before[name]
+		next, hasParameter := after[name]
+
+		switch {
+		case !hasParameter:
+			change(orbChangeBreaking, name, "parameter removed")
+			continue
+		case !hadParameter && next.Default == nil:
+			change(orbChangeBreaking, name, "required parameter added")
+			continue
+		case !hadParameter:
+			change(orbChangeFeature, name, "optional parameter added")
+			continue
+		}
+
+		switch {
+		case prev.Type == "enum" && next.Type == "string":
+			change(orbChangeFeature, name, "type widened from enum to string")
+		case prev.Type != next.Type:
+			change(orbChangeBreaking, name, "type changed from %s to %s", prev.Type, next.Type)
+		case prev.Type == "enum":
+			removed, added := diffStrings(prev.Enum, next.Enum)
+			if len(removed) > 0 {
+				change(orbChangeBreaking, name, "enum values removed: %v", removed)
+			}
+			if len(added) > 0 {
+				change(orbChangeFeature, name, "enum values added: %v", added)
+			}
+		}
+
+		switch {
+		case prev.Default != nil && next.Default == nil:
+			change(orbChangeBreaking, name, "parameter became required")
+		case prev.Default == nil && next.Default != nil:
+			change(orbChangeFeature, name, "parameter became optional")
+		case prev.Type == next.Type && !reflect.DeepEqual(prev.Default, next.Default):
+			change(orbChangeFix, name, "default changed from %v to %v", prev.Default, next.Default)
+		}
+
+		if prev.Description != next.Description {
+			change(orbChangeFix, name, "description changed")
+		}
+	}
+
+	return changes
+}
+
+func orbElementNames(maps ...map[string]api.OrbElement) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range maps {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func orbParameterNames(maps ...map[string]api.OrbElementParameter) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, m := range maps {
+		for name := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// diffStrings returns the values only found in before, and those only found
+// in after.
+func diffStrings(before, after []string) ([]string, []string) {
+	in := func(values []string, value string) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	var removed, added []string
+	for _, value := range before {
+		if !in(after, value) {
+			removed = append(removed, value)
+		}
+	}
+	for _, value := range after {
+		if !in(before, value) {
+			added = append(added, value)
+		}
+	}
+	return removed, added
+}
+
+// orbReleaseSegment is the segment of the version to increment for the
+// changes, or "none" when there are none.
+func orbReleaseSegment(changes []orbChange) string {
+	segment := "none"
+	for _, change := range changes {
+		switch change.Kind {
+		case orbChangeBreaking:
+			return "major"
+		case orbChangeFeature:
+			segment = "minor"
+		case orbChangeFix:
+			if segment == "none" {
+				segment = "patch"
+			}
+		}
+	}
+	return segment
+}
+
+func printOrbDiff(w io.Writer, diff orbDiff) {
+	fmt.Fprintf(w, "Comparing %s with %s\n", diff.From, diff.To)
+
+	if len(diff.Changes) == 0 {
+		fmt.Fprintln(w, "\nNo changes to the commands, jobs and executors of the orb.")
+		return
+	}
+
+	sections := []struct {
+		kind  string
+		title string
+	}{
+		{orbChangeBreaking, "Breaking changes"},
+		{orbChangeFeature, "Features"},
+		{orbChangeFix, "Fixes"},
+	}
+	for _, section := range sections {
+		var lines []string
+		for _, change := range diff.Changes {
+			if change.Kind != section.kind {
+				continue
+			}
+			if change.Parameter != "" {
+				lines = append(lines, fmt.Sprintf("  - %s: parameter `%s`: %s", change.Element, change.Parameter, change.Message))
+			} else {
+				lines = append(lines, fmt.Sprintf("  - %s: %s", change.Element, change.Message))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(w, "\n%s:\n", section.title)
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	}
+
+	fmt.Fprintf(w, "\nThese changes call for a %s release.\n", diff.Release)
+}
+
+func printOrbDiffJSON(w io.Writer, diff orbDiff) error {
+	if diff.Changes == nil {
+		diff.Changes = []orbChange{}
+	}
+
+	out, err := json.MarshalIndent(diff, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to convert to JSON")
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
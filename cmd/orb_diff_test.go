@@ -0,0 +1,192 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/CircleCI-Public/circleci-cli/api"
+	"gopkg.in/yaml.v3"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func parseParameters(source string) map[string]api.OrbElementParameter {
+	var parameters map[string]api.OrbElementParameter
+	Expect(yaml.Unmarshal([]byte(source), &parameters)).To(Succeed())
+	return parameters
+}
+
+var _ = Describe("Orb diff", func() {
+	const base = `version: 2.1
+commands:
+  install:
+    description: Installs the tools
+    parameters:
+      version:
+        type: string
+        default: "1.0"
+      flavor:
+        type: enum
+        enum: [slim, full]
+        default: slim
+    steps:
+      - run: install.sh
+  cleanup:
+    steps:
+      - run: rm -rf tmp
+executors:
+  default:
+    docker:
+      - image: cimg/base:stable
+jobs:
+  test:
+    parameters:
+      command:
+        type: string
+    executor: default
+    steps:
+      - run: << parameters.command >>
+`
+
+	diff := func(to string) []orbChange {
+		changes, err := diffOrbSources(base, to)
+		Expect(err).ShouldNot(HaveOccurred())
+		return changes
+	}
+
+	It("finds no changes between identical versions", func() {
+		changes := diff(base)
+		Expect(changes).To(BeEmpty())
+		Expect(orbReleaseSegment(changes)).To(Equal("none"))
+	})
+
+	It("classifies removed elements and parameters as breaking", func() {
+		changes := diff(`version: 2.1
+commands:
+  install:
+    description: Installs the tools
+    parameters:
+      version:
+        type: string
+        default: "1.0"
+    steps:
+      - run: install.sh
+executors:
+  default:
+    docker:
+      - image: cimg/base:stable
+jobs:
+  test:
+    parameters:
+      command:
+        type: string
+    executor: default
+    steps:
+      - run: << parameters.command >>
+`)
+		Expect(changes).To(Equal([]orbChange{
+			{orbChangeBreaking, "commands/cleanup", "", "removed"},
+			{orbChangeBreaking, "commands/install", "flavor", "parameter removed"},
+		}))
+		Expect(orbReleaseSegment(changes)).To(Equal("major"))
+	})
+
+	It("classifies the changes of parameters", func() {
+		changes := diffOrbParameters("jobs/test", parseParameters(`
+narrowed: {type: enum, enum: [a, b, c], default: a}
+widened: {type: enum, enum: [a], default: a}
+retyped: {type: string, default: "1"}
+required: {type: string, default: x}
+optional: {type: string}
+defaulted: {type: boolean, default: false}
+`), parseParameters(`
+narrowed: {type: enum, enum: [a, b, d], default: a}
+widened: {type: string, default: a}
+retyped: {type: integer, default: 1}
+required: {type: string}
+optional: {type: string, default: x}
+defaulted: {type: boolean, default: true}
+added-required: {type: string}
+added-optional: {type: string, default: x}
+`))
+		Expect(changes).To(Equal([]orbChange{
+			{orbChangeFeature, "jobs/test", "added-optional", "optional parameter added"},
+			{orbChangeBreaking, "jobs/test", "added-required", "required parameter added"},
+			{orbChangeFix, "jobs/test", "defaulted", "default changed from false to true"},
+			{orbChangeBreaking, "jobs/test", "narrowed", "enum values removed: [c]"},
+			{orbChangeFeature, "jobs/test", "narrowed", "enum values added: [d]"},
+			{orbChangeFeature, "jobs/test", "optional", "parameter became optional"},
+			{orbChangeBreaking, "jobs/test", "required", "parameter became required"},
+			{orbChangeBreaking, "jobs/test", "retyped", "type changed from string to integer"},
+			{orbChangeFeature, "jobs/test", "widened", "type widened from enum to string"},
+		}))
+	})
+
+	It("classifies additions as features and other changes as fixes", func() {
+		changes := diff(base + `  build:
+    executor: default
+    steps:
+      - checkout
+`)
+		Expect(changes).To(Equal([]orbChange{
+			{orbChangeFeature, "jobs/build", "", "added"},
+		}))
+		Expect(orbReleaseSegment(changes)).To(Equal("minor"))
+
+		changes = diff(base[:len(base)-len("      - run: << parameters.command >>\n")] + "      - run: make << parameters.command >>\n")
+		Expect(changes).To(Equal([]orbChange{
+			{orbChangeFix, "jobs/test", "", "implementation changed"},
+		}))
+		Expect(orbReleaseSegment(changes)).To(Equal("patch"))
+	})
+
+	It("prints the changes by kind", func() {
+		var out bytes.Buffer
+		printOrbDiff(&out, orbDiff{
+			From:    "my-ns/my-orb@1.0.0",
+			To:      "src",
+			Release: "major",
+			Changes: []orbChange{
+				{orbChangeBreaking, "commands/install", "flavor", "parameter removed"},
+				{orbChangeFix, "jobs/test", "", "implementation changed"},
+			},
+		})
+		Expect(out.String()).To(Equal("Comparing my-ns/my-orb@1.0.0 with src\n" +
+			"\nBreaking changes:\n  - commands/install: parameter `flavor`: parameter removed\n" +
+			"\nFixes:\n  - jobs/test: implementation changed\n" +
+			"\nThese changes call for a major release.\n"))
+	})
+
+	It("prints the changes as JSON", func() {
+		var out bytes.Buffer
+		Expect(printOrbDiffJSON(&out, orbDiff{From: "a", To: "b", Release: "none"})).To(Succeed())
+
+		var decoded map[string]interface{}
+		Expect(json.Unmarshal(out.Bytes(), &decoded)).To(Succeed())
+		Expect(decoded).To(Equal(map[string]interface{}{
+			"from":    "a",
+			"to":      "b",
+			"release": "none",
+			"changes": []interface{}{},
+		}))
+	})
+
+	Describe("picking the segment to increment", func() {
+		It("picks the segment the changes call for", func() {
+			Expect(pickIncrementSegment(orbDiff{Release: "minor"}, "", false)).To(Equal("minor"))
+			Expect(pickIncrementSegment(orbDiff{Release: "none"}, "", true)).To(Equal("patch"))
+		})
+
+		It("keeps the given segment", func() {
+			Expect(pickIncrementSegment(orbDiff{Release: "major"}, "patch", false)).To(Equal("patch"))
+			Expect(pickIncrementSegment(orbDiff{Release: "minor"}, "patch", true)).To(Equal("patch"))
+			Expect(pickIncrementSegment(orbDiff{Release: "major"}, "major", true)).To(Equal("major"))
+		})
+
+		It("refuses to hide breaking changes in strict mode", func() {
+			_, err := pickIncrementSegment(orbDiff{Release: "major"}, "minor", true)
+			Expect(err).To(MatchError("refusing to publish a minor release with breaking changes, which call for a major release"))
+		})
+	})
+})
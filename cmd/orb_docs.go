@@ -0,0 +1,350 @@
+package cmd
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/CircleCI-Public/circleci-cli/api"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of `orb docs`, and the file each is written to.
+var orbDocFiles = map[string]string{
+	"md":   "README.md",
+	"html": "index.html",
+}
+
+type orbDocsOptions struct {
+	format string
+	output string
+}
+
+// orbDoc is the documentation of an orb, as rendered by the templates.
+type orbDoc struct {
+	Title       string
+	Description string
+	SourceURL   string
+	HomeURL     string
+	Sections    []orbDocSection
+	Examples    []orbDocExample
+}
+
+type orbDocSection struct {
+	Title    string
+	Elements []orbDocElement
+}
+
+type orbDocElement struct {
+	Name        string
+	Description string
+	Parameters  []orbDocParameter
+}
+
+type orbDocParameter struct {
+	Name        string
+	Type        string
+	Default     string
+	Required    bool
+	Enum        []string
+	Description string
+}
+
+type orbDocExample struct {
+	Name        string
+	Description string
+	Usage       string
+}
+
+// orbDocSource holds the parts of an orb source that are documented, beside
+// its elements.
+type orbDocSource struct {
+	Description string `yaml:"description"`
+	Display     struct {
+		SourceURL string `yaml:"source_url"`
+		HomeURL   string `yaml:"home_url"`
+	} `yaml:"display"`
+	Commands  map[string]api.OrbElement `yaml:"commands"`
+	Jobs      map[string]api.OrbElement `yaml:"jobs"`
+	Executors map[string]api.OrbElement `yaml:"executors"`
+	Examples  map[string]struct {
+		Description string    `yaml:"description"`
+		Usage       yaml.Node `yaml:"usage"`
+	} `yaml:"examples"`
+}
+
+func orbDocsCommand(opts orbOptions, docsOpts orbDocsOptions) error {
+	file, ok := orbDocFiles[docsOpts.format]
+	if !ok {
+		return fmt.Errorf("unknown format `%s`, expected md or html", docsOpts.format)
+	}
+
+	doc, err := loadOrbDoc(opts, opts.args[0])
+	if err != nil {
+		return err
+	}
+
+	if docsOpts.output == "" {
+		return renderOrbDoc(os.Stdout, doc, docsOpts.format)
+	}
+
+	if err := os.MkdirAll(docsOpts.output, 0755); err != nil {
+		return errors.Wrap(err, "Unable to create the output directory")
+	}
+	path := filepath.Join(docsOpts.output, file)
+	out, err := os.Create(path)
+	if err != nil {
+		return errors.Wrap(err, "Unable to write the documentation")
+	}
+	defer out.Close()
+
+	if err := renderOrbDoc(out, doc, docsOpts.format); err != nil {
+		return err
+	}
+	fmt.Printf("Documentation written to %s\n", path)
+	return nil
+}
+
+// loadOrbDoc reads the documentation of an orb given as a reference to the
+// registry, a source directory or an orb.yml.
+func loadOrbDoc(opts orbOptions, orb string) (*orbDoc, error) {
+	source, err := loadOrbSource(opts, orb)
+	if err != nil {
+		return nil, err
+	}
+
+	title := orb
+	if info, statErr := os.Stat(orb); statErr == nil {
+		if info.IsDir() {
+			title = orbProjectName(orb)
+		} else {
+			title = strings.TrimSuffix(filepath.Base(orb), filepath.Ext(orb))
+		}
+	}
+
+	return newOrbDoc(title, source)
+}
+
+func newOrbDoc(title, source string) (*orbDoc, error) {
+	var parsed orbDocSource
+	if err := yaml.Unmarshal([]byte(source), &parsed); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the orb")
+	}
+
+	doc := &orbDoc{
+		Title:       title,
+		Description: strings.TrimSpace(parsed.Description),
+		SourceURL:   parsed.Display.SourceURL,
+		HomeURL:     parsed.Display.HomeURL,
+	}
+
+	for _, section := range []struct {
+		title    string
+		elements map[string]api.OrbElement
+	}{
+		{"Commands", parsed.Commands},
+		{"Jobs", parsed.Jobs},
+		{"Executors", parsed.Executors},
+	} {
+		if len(section.elements) > 0 {
+			doc.Sections = append(doc.Sections, orbDocSection{
+				Title:    section.title,
+				Elements: orbDocElements(section.elements),
+			})
+		}
+	}
+
+	names := make([]string, 0, len(parsed.Examples))
+	for name := range parsed.Examples {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		example := parsed.Examples[name]
+		usage, err := yaml.Marshal(&example.Usage)
+		if err != nil {
+			return nil, errors.Wrapf(err, "Unable to render the example %s", name)
+		}
+		doc.Examples = append(doc.Examples, orbDocExample{
+			Name:        name,
+			Description: strings.TrimSpace(example.Description),
+			Usage:       strings.TrimSpace(string(usage)),
+		})
+	}
+
+	return doc, nil
+}
+
+func orbDocElements(elements map[string]api.OrbElement) []orbDocElement {
+	names := make([]string, 0, len(elements))
+	for name := range elements {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	docs := make([]orbDocElement, 0, len(names))
+	for _, name := range names {
+		element := elements[name]
+		doc := orbDocElement{
+			Name:        name,
+			Description: strings.TrimSpace(element.Description),
+		}
+
+		parameters := make([]string, 0, len(element.Parameters))
+		for parameter := range element.Parameters {
+			parameters = append(parameters, parameter)
+		}
+		sort.Strings(parameters)
+
+		for _, parameter := range parameters {
+			definition := element.Parameters[parameter]
+			value, _ := parameterDefaultValue(definition)
+			doc.Parameters = append(doc.Parameters, orbDocParameter{
+				Name:        parameter,
+				Type:        definition.Type,
+				Default:     value,
+				Required:    definition.Default == nil,
+				Enum:        definition.Enum,
+				Description: strings.TrimSpace(definition.Description),
+			})
+		}
+		docs = append(docs, doc)
+	}
+	return docs
+}
+
+func renderOrbDoc(w io.Writer, doc *orbDoc, format string) error {
+	var err error
+	if format == "html" {
+		err = orbDocHTML.Execute(w, doc)
+	} else {
+		err = orbDocMarkdown.Execute(w, doc)
+	}
+	return errors.Wrap(err, "Unable to render the documentation")
+}
+
+// markdownCell escapes a value for a cell of a Markdown table.
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.ReplaceAll(s, "\n", "<br>")
+}
+
+var orbDocMarkdown = template.Must(template.New("md").Funcs(template.FuncMap{
+	"cell": markdownCell,
+	"join": strings.Join,
+}).Parse(`# {{ .Title }}
+{{- if .Description }}
+
+{{ .Description }}
+{{- end }}
+{{- if or .SourceURL .HomeURL }}
+{{ if .SourceURL }}
+- Source: {{ .SourceURL }}
+{{- end }}
+{{- if .HomeURL }}
+- Home: {{ .HomeURL }}
+{{- end }}
+{{- end }}
+{{- range .Sections }}
+
+## {{ .Title }}
+{{- range .Elements }}
+
+### ` + "`{{ .Name }}`" + `
+{{- if .Description }}
+
+{{ .Description }}
+{{- end }}
+{{- if .Parameters }}
+
+| Parameter | Type | Default | Description |
+| --- | --- | --- | --- |
+{{- range .Parameters }}
+| ` + "`{{ .Name }}`" + ` | {{ .Type }}{{ if .Enum }} ({{ cell (join .Enum ", ") }}){{ end }} | {{ if .Required }}required{{ else if .Default }}` + "`{{ cell .Default }}`" + `{{ end }} | {{ cell .Description }} |
+{{- end }}
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if .Examples }}
+
+## Examples
+{{- range .Examples }}
+
+### {{ .Name }}
+{{- if .Description }}
+
+{{ .Description }}
+{{- end }}
+
+` + "```yaml" + `
+{{ .Usage }}
+` + "```" + `
+{{- end }}
+{{- end }}
+`))
+
+var orbDocHTML = htmltemplate.Must(htmltemplate.New("html").Funcs(htmltemplate.FuncMap{
+	"join": strings.Join,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+body { font-family: sans-serif; max-width: 60em; margin: auto; padding: 1em; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.6em; text-align: left; vertical-align: top; }
+pre { background: #f5f5f5; padding: 1em; overflow: auto; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+{{- if .Description }}
+<p>{{ .Description }}</p>
+{{- end }}
+{{- if or .SourceURL .HomeURL }}
+<ul>
+{{- if .SourceURL }}
+<li>Source: <a href="{{ .SourceURL }}">{{ .SourceURL }}</a></li>
+{{- end }}
+{{- if .HomeURL }}
+<li>Home: <a href="{{ .HomeURL }}">{{ .HomeURL }}</a></li>
+{{- end }}
+</ul>
+{{- end }}
+{{- range .Sections }}
+<h2>{{ .Title }}</h2>
+{{- range .Elements }}
+<h3 id="{{ .Name }}"><code>{{ .Name }}</code></h3>
+{{- if .Description }}
+<p>{{ .Description }}</p>
+{{- end }}
+{{- if .Parameters }}
+<table>
+<tr><th>Parameter</th><th>Type</th><th>Default</th><th>Description</th></tr>
+{{- range .Parameters }}
+<tr><td><code>{{ .Name }}</code></td><td>{{ .Type }}{{ if .Enum }} ({{ join .Enum ", " }}){{ end }}</td><td>{{ if .Required }}required{{ else if .Default }}<code>{{ .Default }}</code>{{ end }}</td><td>{{ .Description }}</td></tr>
+{{- end }}
+</table>
+{{- end }}
+{{- end }}
+{{- end }}
+{{- if .Examples }}
+<h2>Examples</h2>
+{{- range .Examples }}
+<h3>{{ .Name }}</h3>
+{{- if .Description }}
+<p>{{ .Description }}</p>
+{{- end }}
+<pre><code>{{ .Usage }}</code></pre>
+{{- end }}
+{{- end }}
+</body>
+</html>
+`))
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Orb docs", func() {
+	const source = `version: 2.1
+description: Tools for testing
+display:
+  source_url: https://github.com/example/my-orb
+commands:
+  install:
+    description: Installs the tools
+    parameters:
+      version:
+        type: string
+        default: "1.0"
+        description: The version | or a range
+      flavor:
+        type: enum
+        enum: [slim, full]
+        default: slim
+      token:
+        type: env_var_name
+    steps:
+      - run: install.sh
+jobs:
+  test:
+    parameters:
+      steps:
+        type: steps
+        default: []
+    docker:
+      - image: cimg/base:stable
+    steps:
+      - steps: << parameters.steps >>
+examples:
+  run-tests:
+    description: Runs the tests
+    usage:
+      version: 2.1
+      orbs:
+        my-orb: example/my-orb@1.0.0
+      workflows:
+        main:
+          jobs:
+            - my-orb/test
+`
+
+	var doc *orbDoc
+
+	BeforeEach(func() {
+		var err error
+		doc, err = newOrbDoc("my-orb", source)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	It("documents the elements and their parameters", func() {
+		Expect(doc.Sections).To(Equal([]orbDocSection{
+			{"Commands", []orbDocElement{{"install", "Installs the tools", []orbDocParameter{
+				{"flavor", "enum", "slim", false, []string{"slim", "full"}, ""},
+				{"token", "env_var_name", "", true, nil, ""},
+				{"version", "string", "1.0", false, nil, "The version | or a range"},
+			}}}},
+			{"Jobs", []orbDocElement{{"test", "", []orbDocParameter{
+				{"steps", "steps", "", false, nil, ""},
+			}}}},
+		}))
+		Expect(doc.Examples).To(Equal([]orbDocExample{{
+			Name:        "run-tests",
+			Description: "Runs the tests",
+			Usage:       "version: 2.1\norbs:\n    my-orb: example/my-orb@1.0.0\nworkflows:\n    main:\n        jobs:\n            - my-orb/test",
+		}}))
+	})
+
+	It("renders Markdown", func() {
+		var out bytes.Buffer
+		Expect(renderOrbDoc(&out, doc, "md")).To(Succeed())
+		Expect(out.String()).To(HavePrefix("# my-orb\n\nTools for testing\n\n- Source: https://github.com/example/my-orb\n\n## Commands\n"))
+		Expect(out.String()).To(ContainSubstring("| `flavor` | enum (slim, full) | `slim` |  |\n"))
+		Expect(out.String()).To(ContainSubstring("| `token` | env_var_name | required |  |\n"))
+		Expect(out.String()).To(ContainSubstring("| `version` | string | `1.0` | The version \\| or a range |\n"))
+		Expect(out.String()).To(ContainSubstring("## Examples\n\n### run-tests\n\nRuns the tests\n\n```yaml\nversion: 2.1\n"))
+	})
+
+	It("renders HTML", func() {
+		var out bytes.Buffer
+		Expect(renderOrbDoc(&out, doc, "html")).To(Succeed())
+		Expect(out.String()).To(ContainSubstring("<h1>my-orb</h1>"))
+		Expect(out.String()).To(ContainSubstring("<tr><td><code>token</code></td><td>env_var_name</td><td>required</td><td></td></tr>"))
+		Expect(out.String()).To(ContainSubstring("<pre><code>version: 2.1\n"))
+	})
+})
@@ -1,14 +1,22 @@
 package cmd
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/CircleCI-Public/circleci-cli/api"
 	"github.com/CircleCI-Public/circleci-cli/api/graphql"
+	"github.com/CircleCI-Public/circleci-cli/settings"
+	"github.com/briandowns/spinner"
 )
 
 type orbImportPlan struct {
@@ -25,6 +33,10 @@ func (o orbImportPlan) isEmpty() bool {
 	return n == 0
 }
 
+// orbImportStateFile is where the progress of `admin import-orb` is saved
+// by default, in the settings directory.
+const orbImportStateFile = "import-orb-state.jsonl"
+
 func importOrb(opts orbOptions) error {
 	defer func() {
 		if r := recover(); r != nil {
@@ -32,35 +44,86 @@ func importOrb(opts orbOptions) error {
 		}
 	}()
 
-	vs, err := versionsToImport(opts)
-	if err != nil {
-		return err
+	if opts.importConcurrency < 1 {
+		return fmt.Errorf("--concurrency must be at least 1, got %d", opts.importConcurrency)
 	}
 
-	plan, err := generateImportPlan(opts, vs)
-	if err != nil {
-		return err
+	path := opts.importStateFile
+	if path == "" {
+		path = filepath.Join(settings.SettingsPath(), orbImportStateFile)
 	}
 
-	displayPlan(os.Stdout, plan)
-	if !opts.noPrompt && !plan.isEmpty() && !opts.tty.askUserToConfirm("Are you sure you would like to proceed?") {
+	var state *orbImportState
+	if opts.importResume {
+		var err error
+		state, err = loadOrbImportState(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Resuming the import saved at %s\n\n", path)
+	} else {
+		if _, err := os.Stat(path); err == nil {
+			return fmt.Errorf("an interrupted import was saved at %s, continue it with --resume or remove the file", path)
+		}
+
+		vs, err := versionsToImport(opts)
+		if err != nil {
+			return err
+		}
+
+		plan, err := generateImportPlan(opts, vs)
+		if err != nil {
+			return err
+		}
+		state = &orbImportState{Plan: plan, done: map[string]bool{}}
+	}
+
+	remaining := state.remaining()
+	displayPlan(os.Stdout, remaining)
+	if !opts.noPrompt && !remaining.isEmpty() && !opts.tty.askUserToConfirm("Are you sure you would like to proceed?") {
 		return nil
 	}
 
-	return applyPlan(opts, plan)
+	if !opts.importResume && !remaining.isEmpty() {
+		if err := state.save(path); err != nil {
+			return err
+		}
+	}
+
+	return applyImport(opts, state)
 }
 
 func versionsToImport(opts orbOptions) ([]api.OrbVersion, error) {
+	if opts.importBundle != "" {
+		return readOrbBundle(opts.importBundle)
+	}
+
 	cloudClient := graphql.NewClient(opts.cfg.HTTPClient, "https://circleci.com", "graphql-unstable", "", opts.cfg.Debug)
 
 	if opts.integrationTesting {
 		cloudClient = opts.cl
 	}
 
+	return fetchOrbVersions(cloudClient, opts.args, opts.allVersions)
+}
+
+// fetchOrbVersions gets the versions of orbs given as references to a
+// namespace, an orb or an orb version: the latest version of each orb, or
+// all of them.
+func fetchOrbVersions(cl *graphql.Client, refs []string, allVersions bool) ([]api.OrbVersion, error) {
 	var orbVersions []api.OrbVersion
-	for _, ref := range opts.args {
+	for _, ref := range refs {
 		if !isNamespace(ref) {
-			version, err := api.OrbInfo(cloudClient, ref)
+			if allVersions && !strings.Contains(ref, "@") {
+				versions, err := allVersionsToImport(cl, ref)
+				if err != nil {
+					return nil, err
+				}
+				orbVersions = append(orbVersions, versions...)
+				continue
+			}
+
+			version, err := api.OrbInfo(cl, ref)
 			if err != nil {
 				return nil, fmt.Errorf("orb info: %s", err.Error())
 			}
@@ -69,118 +132,539 @@ func versionsToImport(opts orbOptions) ([]api.OrbVersion, error) {
 			continue
 		}
 
-		// TODO: support an `--all-versions` flag that gets all versions instead of latest version per orb?
-		// Note: fetching all orb versions may not be possible. The best we could do is fetch an arbitrarily large number.
-		// Otherwise, do some other operation that grabs orb source data from a single namespace.
-		obv, err := api.ListNamespaceOrbVersions(cloudClient, ref)
+		obv, err := api.ListNamespaceOrbVersions(cl, ref)
 		if err != nil {
 			return nil, fmt.Errorf("list namespace orb versions: %s", err.Error())
 		}
 
-		orbVersions = append(orbVersions, obv...)
+		if !allVersions {
+			orbVersions = append(orbVersions, obv...)
+			continue
+		}
+
+		for _, latest := range obv {
+			versions, err := allVersionsToImport(cl, latest.Orb.Name)
+			if err != nil {
+				return nil, err
+			}
+			orbVersions = append(orbVersions, versions...)
+		}
 	}
 
 	return orbVersions, nil
 }
 
+// allVersionsToImport lists every version of an orb, the oldest first so
+// that they are imported in the order they were published.
+func allVersionsToImport(cl *graphql.Client, name string) ([]api.OrbVersion, error) {
+	versions, err := api.OrbVersions(cl, name)
+	if err != nil {
+		return nil, fmt.Errorf("orb versions: %s", err.Error())
+	}
+
+	for i, j := 0, len(versions)-1; i < j; i, j = i+1, j-1 {
+		versions[i], versions[j] = versions[j], versions[i]
+	}
+	return versions, nil
+}
+
 func generateImportPlan(opts orbOptions, orbVersions []api.OrbVersion) (orbImportPlan, error) {
-	uniqueNamespaces := map[string]bool{}
-	uniqueOrbs := map[string]api.Orb{}
+	var namespaces []string
+	var orbs []api.Orb
+	seen := map[string]bool{}
 
 	// Dedupe namespaces and orbs.
 	for _, o := range orbVersions {
 		ns, orbName := o.Orb.Namespace.Name, o.Orb.Name
-		uniqueNamespaces[ns] = true
-		uniqueOrbs[orbName] = o.Orb
+		if !seen["namespace "+ns] {
+			seen["namespace "+ns] = true
+			namespaces = append(namespaces, ns)
+		}
+		if !seen["orb "+orbName] {
+			seen["orb "+orbName] = true
+			orbs = append(orbs, o.Orb)
+		}
 	}
 
-	var plan orbImportPlan
-	for ns := range uniqueNamespaces {
-		ok, err := api.NamespaceExists(opts.cl, ns)
+	progress := startOrbImportProgress(opts, "Checking what to import...", len(namespaces)+len(orbs)+len(orbVersions))
+	defer progress.stop()
+
+	namespaceExists := make([]bool, len(namespaces))
+	err := runConcurrently(opts.importConcurrency, len(namespaces), func(i int) error {
+		ok, err := api.NamespaceExists(opts.cl, namespaces[i])
 		if err != nil {
-			return orbImportPlan{}, fmt.Errorf("namespace check failed: %s", err.Error())
+			return fmt.Errorf("namespace check failed: %s", err.Error())
 		}
+		namespaceExists[i] = ok
+		progress.inc()
+		return nil
+	})
+	if err != nil {
+		return orbImportPlan{}, err
+	}
 
-		if !ok {
-			plan.NewNamespaces = append(plan.NewNamespaces, ns)
+	orbExists := make([]bool, len(orbs))
+	err = runConcurrently(opts.importConcurrency, len(orbs), func(i int) error {
+		ok, _, err := api.OrbExists(opts.cl, orbs[i].Namespace.Name, orbs[i].Shortname())
+		if err != nil {
+			return fmt.Errorf("orb id check failed: %s", err.Error())
 		}
+		orbExists[i] = ok
+		progress.inc()
+		return nil
+	})
+	if err != nil {
+		return orbImportPlan{}, err
 	}
 
-	for _, orb := range uniqueOrbs {
-		ok, _, err := api.OrbExists(opts.cl, orb.Namespace.Name, orb.Shortname())
+	versionExists := make([]bool, len(orbVersions))
+	err = runConcurrently(opts.importConcurrency, len(orbVersions), func(i int) error {
+		o := orbVersions[i]
+		_, err := api.OrbInfo(opts.cl, fmt.Sprintf("%s@%s", o.Orb.Name, o.Version))
+		if _, ok := err.(*api.ErrOrbVersionNotExists); ok {
+			progress.inc()
+			return nil
+		}
 		if err != nil {
-			return orbImportPlan{}, fmt.Errorf("orb id check failed: %s", err.Error())
+			return fmt.Errorf("orb info check failed: %s", err.Error())
 		}
+		versionExists[i] = true
+		progress.inc()
+		return nil
+	})
+	if err != nil {
+		return orbImportPlan{}, err
+	}
 
-		if !ok {
+	var plan orbImportPlan
+	for i, ns := range namespaces {
+		if !namespaceExists[i] {
+			plan.NewNamespaces = append(plan.NewNamespaces, ns)
+		}
+	}
+	for i, orb := range orbs {
+		if !orbExists[i] {
 			plan.NewOrbs = append(plan.NewOrbs, orb)
 		}
 	}
-
-	for _, o := range orbVersions {
-		_, err := api.OrbInfo(opts.cl, fmt.Sprintf("%s@%s", o.Orb.Name, o.Version))
-		if _, ok := err.(*api.ErrOrbVersionNotExists); ok {
+	for i, o := range orbVersions {
+		if versionExists[i] {
+			plan.AlreadyExistingVersions = append(plan.AlreadyExistingVersions, o)
+		} else {
 			plan.NewVersions = append(plan.NewVersions, o)
-			continue
 		}
+	}
+
+	return plan, nil
+}
+
+// runConcurrently calls fn with every index below n, on at most concurrency
+// goroutines at a time. Once an index fails no other one is started, and the
+// error of the lowest failed index is returned.
+func runConcurrently(concurrency, n int, fn func(i int) error) error {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		next   int
+		failed bool
+		errs   = make([]error, n)
+	)
+
+	worker := func() {
+		defer wg.Done()
+		for {
+			mu.Lock()
+			if failed || next >= n {
+				mu.Unlock()
+				return
+			}
+			i := next
+			next++
+			mu.Unlock()
+
+			if err := fn(i); err != nil {
+				mu.Lock()
+				errs[i] = err
+				failed = true
+				mu.Unlock()
+			}
+		}
+	}
+
+	for w := 0; w < concurrency && w < n; w++ {
+		wg.Add(1)
+		go worker()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
 		if err != nil {
-			return orbImportPlan{}, fmt.Errorf("orb info check failed: %s", err.Error())
+			return err
 		}
+	}
+	return nil
+}
 
-		plan.AlreadyExistingVersions = append(plan.AlreadyExistingVersions, o)
+// orbImportProgress shows how many of the checks or actions of an import are
+// done. It is not shown in integration tests.
+type orbImportProgress struct {
+	spr   *spinner.Spinner
+	done  int64
+	total int
+}
+
+func startOrbImportProgress(opts orbOptions, label string, total int) *orbImportProgress {
+	if opts.integrationTesting || total == 0 {
+		return nil
 	}
 
-	return plan, nil
+	p := &orbImportProgress{total: total}
+	p.spr = spinner.New(spinner.CharSets[14], 100*time.Millisecond, spinner.WithWriter(os.Stderr))
+	p.spr.PostUpdate = func(s *spinner.Spinner) {
+		s.Suffix = fmt.Sprintf(" %s %d/%d", label, atomic.LoadInt64(&p.done), p.total)
+	}
+	p.spr.Start()
+	return p
 }
 
-func applyPlan(opts orbOptions, plan orbImportPlan) error {
-	for _, ns := range plan.NewNamespaces {
-		_, err := api.CreateImportedNamespace(opts.cl, ns)
+func (p *orbImportProgress) inc() {
+	if p != nil {
+		atomic.AddInt64(&p.done, 1)
+	}
+}
+
+func (p *orbImportProgress) stop() {
+	if p != nil {
+		p.spr.Stop()
+	}
+}
+
+// orbImportStep is an action of an import plan. Its name tells it apart in
+// the saved state of the import.
+type orbImportStep struct {
+	name string
+	// The namespaces are created first, then the orbs, then the versions.
+	// The steps of a group are applied in order, one at a time.
+	stage int
+	group string
+	apply func(opts orbOptions) error
+}
+
+func namespaceStepName(ns string) string {
+	return fmt.Sprintf("Create namespace '%s'", ns)
+}
+
+func orbStepName(o api.Orb) string {
+	return fmt.Sprintf("Create orb '%s'", o.Name)
+}
+
+func versionStepName(v api.OrbVersion) string {
+	return fmt.Sprintf("Import version '%s@%s'", v.Orb.Name, v.Version)
+}
+
+// steps are the actions of the plan, in the order they are applied.
+func (o orbImportPlan) steps() []orbImportStep {
+	var steps []orbImportStep
+
+	for _, ns := range o.NewNamespaces {
+		ns := ns
+		steps = append(steps, orbImportStep{namespaceStepName(ns), 0, ns, func(opts orbOptions) error {
+			_, err := api.CreateImportedNamespace(opts.cl, ns)
+			if err != nil {
+				return fmt.Errorf("unable to create '%s' namespace: %s", ns, err.Error())
+			}
+			return nil
+		}})
+	}
+
+	for _, orb := range o.NewOrbs {
+		orb := orb
+		steps = append(steps, orbImportStep{orbStepName(orb), 1, orb.Name, func(opts orbOptions) error {
+			_, err := api.CreateImportedOrb(opts.cl, orb.Namespace.Name, orb.Shortname())
+			if err != nil {
+				return fmt.Errorf("unable to create '%s' orb: %s", orb.Name, err.Error())
+			}
+			return nil
+		}})
+	}
+
+	for _, v := range o.NewVersions {
+		v := v
+		steps = append(steps, orbImportStep{versionStepName(v), 2, v.Orb.Name, func(opts orbOptions) error {
+			resp, err := api.OrbID(opts.cl, v.Orb.Namespace.Name, v.Orb.Shortname())
+			if err != nil {
+				return fmt.Errorf("unable to get orb info at %s: %s", v.Orb.Name, err.Error())
+			}
+
+			_, err = api.OrbImportVersion(opts.cl, v.Source, resp.Orb.ID, v.Version)
+			if err != nil {
+				additionalMessage := ""
+				if strings.HasPrefix(err.Error(), "ERROR IN CONFIG FILE") {
+					additionalMessage = "\nThis can be caused by an orb using syntax that is not supported on your server version."
+				}
+				return fmt.Errorf("unable to publish '%s@%s': %s%s", v.Orb.Name, v.Version, err.Error(), additionalMessage)
+			}
+			return nil
+		}})
+	}
+
+	return steps
+}
+
+// orbImportState is the progress of applying an import plan. It is saved as
+// JSON lines: the plan first, then the name of every step once it is done,
+// so that an interrupted import can resume where it stopped.
+type orbImportState struct {
+	Plan orbImportPlan
+	done map[string]bool
+	// path is where the state is saved, if anywhere.
+	path string
+	mu   sync.Mutex
+}
+
+func loadOrbImportState(path string) (*orbImportState, error) {
+	file, err := os.Open(path) // #nosec
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no interrupted import was saved at %s", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the saved import: %s", err.Error())
+	}
+	defer file.Close()
+
+	state := &orbImportState{done: map[string]bool{}, path: path}
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&state.Plan); err != nil {
+		return nil, fmt.Errorf("unable to read the saved import: %s", err.Error())
+	}
+	for {
+		var step string
+		err := decoder.Decode(&step)
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			return fmt.Errorf("unable to create '%s' namespace: %s", ns, err.Error())
+			return nil, fmt.Errorf("unable to read the saved import: %s", err.Error())
 		}
+		state.done[step] = true
 	}
 
-	for _, o := range plan.NewOrbs {
-		_, err := api.CreateImportedOrb(opts.cl, o.Namespace.Name, o.Shortname())
-		if err != nil {
-			return fmt.Errorf("unable to create '%s' orb: %s", o.Name, err.Error())
+	return state, nil
+}
+
+// save writes the plan to the file, where the steps are then recorded.
+func (s *orbImportState) save(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("unable to save the import: %s", err.Error())
+	}
+
+	line, err := json.Marshal(s.Plan)
+	if err != nil {
+		return fmt.Errorf("unable to save the import: %s", err.Error())
+	}
+	if err := ioutil.WriteFile(path, append(line, '\n'), 0600); err != nil {
+		return fmt.Errorf("unable to save the import: %s", err.Error())
+	}
+
+	s.path = path
+	return nil
+}
+
+func (s *orbImportState) markDone(step string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.done[step] = true
+	if s.path == "" {
+		return nil
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("unable to save the import: %s", err.Error())
+	}
+	defer file.Close()
+
+	line, err := json.Marshal(step)
+	if err != nil {
+		return fmt.Errorf("unable to save the import: %s", err.Error())
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("unable to save the import: %s", err.Error())
+	}
+	return nil
+}
+
+// remaining is the part of the plan that is not done yet.
+func (s *orbImportState) remaining() orbImportPlan {
+	plan := orbImportPlan{AlreadyExistingVersions: s.Plan.AlreadyExistingVersions}
+	for _, ns := range s.Plan.NewNamespaces {
+		if !s.done[namespaceStepName(ns)] {
+			plan.NewNamespaces = append(plan.NewNamespaces, ns)
+		}
+	}
+	for _, o := range s.Plan.NewOrbs {
+		if !s.done[orbStepName(o)] {
+			plan.NewOrbs = append(plan.NewOrbs, o)
 		}
 	}
+	for _, v := range s.Plan.NewVersions {
+		if !s.done[versionStepName(v)] {
+			plan.NewVersions = append(plan.NewVersions, v)
+		}
+	}
+	return plan
+}
 
-	for _, v := range plan.NewVersions {
-		resp, err := api.OrbID(opts.cl, v.Orb.Namespace.Name, v.Orb.Shortname())
-		if err != nil {
-			return fmt.Errorf("unable to get orb info at %s: %s", v.Orb.Name, err.Error())
+func applyPlan(opts orbOptions, plan orbImportPlan) error {
+	return applyImport(opts, &orbImportState{Plan: plan, done: map[string]bool{}})
+}
+
+// applyImport applies the steps of the plan that are not done yet, recording
+// each of them in the saved state. The versions of different orbs are
+// imported concurrently, those of an orb in the order of the plan. With
+// --continue-on-error, the steps that fail, and those skipped because of
+// them, are reported together at the end, and are retried by --resume.
+func applyImport(opts orbOptions, state *orbImportState) error {
+	resumeHint := ""
+	if state.path != "" {
+		resumeHint = "\nContinue the import with `circleci admin import-orb --resume`."
+	}
+
+	steps := state.Plan.steps()
+	var pending []int
+	for i, step := range steps {
+		if !state.done[step.name] {
+			pending = append(pending, i)
 		}
+	}
 
-		_, err = api.OrbImportVersion(opts.cl, v.Source, resp.Orb.ID, v.Version)
-		if err != nil {
-			additionalMessage := ""
-			if strings.HasPrefix(err.Error(), "ERROR IN CONFIG FILE") {
-				additionalMessage = "\nThis can be caused by an orb using syntax that is not supported on your server version."
-			}
-			return fmt.Errorf("unable to publish '%s@%s': %s%s", v.Orb.Name, v.Version, err.Error(), additionalMessage)
+	progress := startOrbImportProgress(opts, "Importing...", len(pending))
+	failed, err := applyImportSteps(opts, steps, pending, func(step string) error {
+		if err := state.markDone(step); err != nil {
+			return err
 		}
+		progress.inc()
+		return nil
+	})
+	progress.stop()
+	if err != nil {
+		return fmt.Errorf("%s%s", err.Error(), resumeHint)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d action(s) failed:\n%s%s", len(failed), strings.Join(failed, "\n"), resumeHint)
 	}
 
+	if state.path != "" {
+		if err := os.Remove(state.path); err != nil {
+			return fmt.Errorf("unable to remove the saved import: %s", err.Error())
+		}
+	}
 	return nil
 }
 
-func displayPlan(w io.Writer, plan orbImportPlan) {
-	var b strings.Builder
-	b.WriteString("The following actions will be performed:\n")
+// applyImportSteps applies the pending steps stage by stage, calling done
+// after each one that succeeds. Once a step of an orb or a namespace fails,
+// the remaining steps of the orb, or of the orbs of the namespace, are
+// skipped, so that versions are never imported out of order. With
+// --continue-on-error, the failed and skipped steps are returned in the order
+// of the plan; otherwise the first failure is.
+func applyImportSteps(opts orbOptions, steps []orbImportStep, pending []int, done func(step string) error) ([]string, error) {
+	var mu sync.Mutex
+	failures := make([]string, len(steps))
+	// failedGroups holds the name of the first failed step of a group.
+	failedGroups := map[string]string{}
+
+	fail := func(i int, message string) {
+		mu.Lock()
+		defer mu.Unlock()
+		failures[i] = fmt.Sprintf("  %s: %s", steps[i].name, message)
+		if _, ok := failedGroups[steps[i].group]; !ok {
+			failedGroups[steps[i].group] = steps[i].name
+		}
+	}
+
+	// blockedBy returns the failed step preventing a step of the group, the
+	// orb itself or its namespace.
+	blockedBy := func(group string) (string, bool) {
+		mu.Lock()
+		defer mu.Unlock()
+		if failed, ok := failedGroups[group]; ok {
+			return failed, true
+		}
+		failed, ok := failedGroups[strings.SplitN(group, "/", 2)[0]]
+		return failed, ok
+	}
+
+	for stage := 0; stage <= 2; stage++ {
+		groups := groupImportSteps(steps, pending, stage)
+		err := runConcurrently(opts.importConcurrency, len(groups), func(g int) error {
+			for _, i := range groups[g] {
+				step := steps[i]
+				if failed, blocked := blockedBy(step.group); blocked {
+					fail(i, fmt.Sprintf("skipped, since %q failed", failed))
+					continue
+				}
+
+				if err := step.apply(opts); err != nil {
+					if !opts.importContinueOnError {
+						return err
+					}
+					fail(i, err.Error())
+					continue
+				}
+
+				if err := done(step.name); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	for _, ns := range plan.NewNamespaces {
-		b.WriteString(fmt.Sprintf("  Create namespace '%s'\n", ns))
+	var failed []string
+	for _, failure := range failures {
+		if failure != "" {
+			failed = append(failed, failure)
+		}
 	}
+	return failed, nil
+}
 
-	for _, o := range plan.NewOrbs {
-		b.WriteString(fmt.Sprintf("  Create orb '%s'\n", o.Name))
+// groupImportSteps splits the pending steps of a stage by their group, the
+// steps of each group in the order of the plan.
+func groupImportSteps(steps []orbImportStep, pending []int, stage int) [][]int {
+	var groups [][]int
+	index := map[string]int{}
+	for _, i := range pending {
+		if steps[i].stage != stage {
+			continue
+		}
+		g, ok := index[steps[i].group]
+		if !ok {
+			g = len(groups)
+			index[steps[i].group] = g
+			groups = append(groups, nil)
+		}
+		groups[g] = append(groups[g], i)
 	}
+	return groups
+}
+
+func displayPlan(w io.Writer, plan orbImportPlan) {
+	var b strings.Builder
+	b.WriteString("The following actions will be performed:\n")
 
-	for _, v := range plan.NewVersions {
-		b.WriteString(fmt.Sprintf("  Import version '%s@%s'\n", v.Orb.Name, v.Version))
+	for _, step := range plan.steps() {
+		b.WriteString(fmt.Sprintf("  %s\n", step.name))
 	}
 
 	for i, e := range plan.AlreadyExistingVersions {
@@ -5,6 +5,11 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/CircleCI-Public/circleci-cli/api"
 	"github.com/CircleCI-Public/circleci-cli/api/graphql"
@@ -978,4 +983,276 @@ The following orb versions already exist:
 			Expect(err).ShouldNot(HaveOccurred())
 		})
 	})
+
+	Describe("When importing all versions and resuming", func() {
+		const createNSReq = `{
+				"query": "\n\t\t\tmutation($name: String!) {\n\t\t\t\timportNamespace(\n\t\t\t\t\tname: $name,\n\t\t\t\t) {\n\t\t\t\t\tnamespace {\n\t\t\t\t\t\tid\n\t\t\t\t\t}\n\t\t\t\t\terrors {\n\t\t\t\t\t\tmessage\n\t\t\t\t\t\ttype\n\t\t\t\t\t}\n\t\t\t\t}\n\t\t\t}",
+				"variables": {
+				  "name": "%s"
+				}
+			  }`
+
+		var (
+			opts orbOptions
+			plan orbImportPlan
+			dir  string
+		)
+
+		expectCreateNamespace := func(name, response string) {
+			cli.AppendPostHandler("", clitest.MockRequestResponse{
+				Status:   http.StatusOK,
+				Request:  fmt.Sprintf(createNSReq, name),
+				Response: response,
+			})
+		}
+
+		BeforeEach(func() {
+			opts = orbOptions{
+				cl:                 client,
+				cfg:                &settings.Config{},
+				integrationTesting: true,
+			}
+			plan = orbImportPlan{
+				NewNamespaces: []string{"namespace1", "namespace2"},
+			}
+
+			var err error
+			dir, err = ioutil.TempDir("", "circleci-import-orb")
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("fetches every version of an orb, the oldest first", func() {
+			opts.args = []string{"namespace1/orb"}
+			opts.allVersions = true
+
+			request := graphql.NewRequest(`query($name: String!, $count: Int!) {
+			    orb(name: $name) {
+			        id
+			        createdAt
+			        name
+			        namespace {
+			            name
+			        }
+			        versions(count: $count) {
+			            id
+			            version
+			            source
+			            createdAt
+			        }
+			    }
+		      }`)
+			request.Var("name", "namespace1/orb")
+			request.Var("count", 100)
+			encoded, err := request.Encode()
+			Expect(err).ShouldNot(HaveOccurred())
+
+			cli.AppendPostHandler("", clitest.MockRequestResponse{
+				Status:  http.StatusOK,
+				Request: encoded.String(),
+				Response: `{
+					"orb": {
+						"id": "orbid1",
+						"name": "namespace1/orb",
+						"namespace": {"name": "namespace1"},
+						"versions": [
+							{"id": "v2", "version": "0.0.2", "source": "version: 2.1\n"},
+							{"id": "v1", "version": "0.0.1", "source": "version: 2.1\n"}
+						]
+					}
+				}`,
+			})
+
+			vs, err := versionsToImport(opts)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(vs).To(HaveLen(2))
+			Expect(vs[0].Version).To(Equal("0.0.1"))
+			Expect(vs[1].Version).To(Equal("0.0.2"))
+			Expect(vs[1].Orb.Name).To(Equal("namespace1/orb"))
+			Expect(vs[1].Orb.Namespace.Name).To(Equal("namespace1"))
+		})
+
+		It("reports the actions that failed at the end", func() {
+			opts.importContinueOnError = true
+			expectCreateNamespace("namespace1", `{"importNamespace": {"errors": [{"message": "testerror"}]}}`)
+			expectCreateNamespace("namespace2", `{}`)
+
+			err := applyPlan(opts, plan)
+			Expect(err).To(MatchError("1 action(s) failed:\n  Create namespace 'namespace1': unable to create 'namespace1' namespace: testerror"))
+		})
+
+		It("resumes an interrupted import where it stopped", func() {
+			path := filepath.Join(dir, "state.jsonl")
+			state := &orbImportState{Plan: plan, done: map[string]bool{}}
+			Expect(state.save(path)).To(Succeed())
+
+			expectCreateNamespace("namespace1", `{}`)
+			expectCreateNamespace("namespace2", `{"importNamespace": {"errors": [{"message": "testerror"}]}}`)
+			err := applyImport(opts, state)
+			Expect(err).To(MatchError("unable to create 'namespace2' namespace: testerror\nContinue the import with `circleci admin import-orb --resume`."))
+
+			resumed, err := loadOrbImportState(path)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(resumed.remaining()).To(Equal(orbImportPlan{NewNamespaces: []string{"namespace2"}}))
+
+			expectCreateNamespace("namespace2", `{}`)
+			Expect(applyImport(opts, resumed)).To(Succeed())
+			Expect(path).NotTo(BeAnExistingFile())
+
+			_, err = loadOrbImportState(path)
+			Expect(err).To(MatchError(fmt.Sprintf("no interrupted import was saved at %s", path)))
+		})
+	})
+
+	Describe("When importing concurrently", func() {
+		It("runs at most the given number of calls at a time", func() {
+			var active, most int64
+			called := make([]bool, 20)
+			err := runConcurrently(3, len(called), func(i int) error {
+				n := atomic.AddInt64(&active, 1)
+				for {
+					m := atomic.LoadInt64(&most)
+					if n <= m || atomic.CompareAndSwapInt64(&most, m, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				called[i] = true
+				atomic.AddInt64(&active, -1)
+				return nil
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(called).NotTo(ContainElement(false))
+			Expect(most).To(BeNumerically("<=", 3))
+		})
+
+		It("stops starting calls after an error", func() {
+			var calls int64
+			err := runConcurrently(1, 5, func(i int) error {
+				atomic.AddInt64(&calls, 1)
+				if i == 1 {
+					return fmt.Errorf("call %d failed", i)
+				}
+				return nil
+			})
+			Expect(err).To(MatchError("call 1 failed"))
+			Expect(calls).To(Equal(int64(2)))
+		})
+
+		It("imports the versions of an orb in order, one at a time", func() {
+			orb1 := api.Orb{Name: "namespace1/orb1", Namespace: api.Namespace{Name: "namespace1"}}
+			orb2 := api.Orb{Name: "namespace1/orb2", Namespace: api.Namespace{Name: "namespace1"}}
+			plan := orbImportPlan{
+				NewNamespaces: []string{"namespace1"},
+				NewOrbs:       []api.Orb{orb1, orb2},
+				NewVersions: []api.OrbVersion{
+					{Version: "0.0.1", Orb: orb1},
+					{Version: "0.0.1", Orb: orb2},
+					{Version: "0.0.2", Orb: orb1},
+					{Version: "0.0.2", Orb: orb2},
+					{Version: "0.0.3", Orb: orb1},
+				},
+			}
+			steps := plan.steps()
+			pending := []int{0, 1, 2, 3, 4, 5, 6, 7}
+
+			Expect(groupImportSteps(steps, pending, 0)).To(Equal([][]int{{0}}))
+			Expect(groupImportSteps(steps, pending, 1)).To(Equal([][]int{{1}, {2}}))
+			Expect(groupImportSteps(steps, pending, 2)).To(Equal([][]int{{3, 5, 7}, {4, 6}}))
+			Expect(groupImportSteps(steps, []int{5, 6, 7}, 2)).To(Equal([][]int{{5, 7}, {6}}))
+		})
+
+		Describe("when a step fails with --continue-on-error", func() {
+			orb1 := api.Orb{Name: "namespace1/orb1", Namespace: api.Namespace{Name: "namespace1"}}
+			orb2 := api.Orb{Name: "namespace1/orb2", Namespace: api.Namespace{Name: "namespace1"}}
+			opts := orbOptions{importContinueOnError: true, importConcurrency: 2}
+
+			// apply replaces the actions of the steps, failing those named in
+			// fails, and returns the steps applied in order.
+			apply := func(plan orbImportPlan, fails ...string) ([]string, []string, error) {
+				var mu sync.Mutex
+				var applied []string
+				steps := plan.steps()
+				pending := make([]int, len(steps))
+				for i := range steps {
+					i := i
+					pending[i] = i
+					steps[i].apply = func(orbOptions) error {
+						for _, name := range fails {
+							if steps[i].name == name {
+								return fmt.Errorf("boom")
+							}
+						}
+						mu.Lock()
+						defer mu.Unlock()
+						applied = append(applied, steps[i].name)
+						return nil
+					}
+				}
+
+				var done []string
+				failed, err := applyImportSteps(opts, steps, pending, func(step string) error {
+					mu.Lock()
+					defer mu.Unlock()
+					done = append(done, step)
+					return nil
+				})
+				Expect(done).To(ConsistOf(applied))
+				return applied, failed, err
+			}
+
+			It("skips the later versions of the orb", func() {
+				applied, failed, err := apply(orbImportPlan{
+					NewVersions: []api.OrbVersion{
+						{Version: "0.0.1", Orb: orb1},
+						{Version: "0.0.1", Orb: orb2},
+						{Version: "0.0.2", Orb: orb1},
+						{Version: "0.0.3", Orb: orb1},
+					},
+				}, "Import version 'namespace1/orb1@0.0.2'")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(applied).To(ConsistOf(
+					"Import version 'namespace1/orb1@0.0.1'",
+					"Import version 'namespace1/orb2@0.0.1'",
+				))
+				Expect(failed).To(Equal([]string{
+					"  Import version 'namespace1/orb1@0.0.2': boom",
+					`  Import version 'namespace1/orb1@0.0.3': skipped, since "Import version 'namespace1/orb1@0.0.2'" failed`,
+				}))
+			})
+
+			It("skips the versions of an orb it failed to create", func() {
+				applied, failed, err := apply(orbImportPlan{
+					NewOrbs: []api.Orb{orb1, orb2},
+					NewVersions: []api.OrbVersion{
+						{Version: "0.0.1", Orb: orb1},
+						{Version: "0.0.1", Orb: orb2},
+					},
+				}, "Create orb 'namespace1/orb1'")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(applied).To(ConsistOf(
+					"Create orb 'namespace1/orb2'",
+					"Import version 'namespace1/orb2@0.0.1'",
+				))
+				Expect(failed).To(Equal([]string{
+					"  Create orb 'namespace1/orb1': boom",
+					`  Import version 'namespace1/orb1@0.0.1': skipped, since "Create orb 'namespace1/orb1'" failed`,
+				}))
+			})
+
+			It("skips the orbs of a namespace it failed to create", func() {
+				applied, failed, err := apply(orbImportPlan{
+					NewNamespaces: []string{"namespace1"},
+					NewOrbs:       []api.Orb{orb1},
+					NewVersions:   []api.OrbVersion{{Version: "0.0.1", Orb: orb1}},
+				}, "Create namespace 'namespace1'")
+				Expect(err).ShouldNot(HaveOccurred())
+				Expect(applied).To(BeEmpty())
+				Expect(failed).To(HaveLen(3))
+			})
+		})
+	})
 })
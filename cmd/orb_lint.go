@@ -0,0 +1,470 @@
+package cmd
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the findings of `orb lint`.
+const (
+	orbLintFormatText  = "text"
+	orbLintFormatJSON  = "json"
+	orbLintFormatJUnit = "junit"
+)
+
+// orbLintRule is a check of the orb-tools review, run on the source of an
+// orb before its includes are inlined.
+type orbLintRule struct {
+	name        string
+	description string
+	check       func(orb *orbLintSource) []orbLintFinding
+}
+
+// orbLintFinding is a place in the orb breaking a rule. Locations are like
+// `jobs/test` or `jobs/test/parameters/command`.
+type orbLintFinding struct {
+	Rule     string `json:"rule"`
+	Location string `json:"location"`
+	Message  string `json:"message"`
+}
+
+type orbLintOptions struct {
+	skip   []string
+	format string
+	output string
+}
+
+// orbLintSource is the source of an orb, as read from its directory.
+type orbLintSource struct {
+	dir     string
+	orb     map[string]interface{}
+	display map[string]interface{}
+}
+
+// orbLintMaxScriptLength is the length above which a run step should include
+// its command from a script file.
+const orbLintMaxScriptLength = 64
+
+var orbLintRules = []orbLintRule{
+	{"display-metadata", "@orb.yml sets display.source_url", lintDisplayMetadata},
+	{"element-description", "commands, jobs and executors have a description", lintElementDescriptions},
+	{"parameter-description", "parameters have a description", lintParameterDescriptions},
+	{"kebab-case-names", "commands, jobs, executors, examples and parameters are named in kebab-case", lintKebabCaseNames},
+	{"include-long-scripts", fmt.Sprintf("run commands longer than %d characters use <<include()>>", orbLintMaxScriptLength), lintLongScripts},
+	{"job-examples", "every job is used by an example", lintJobExamples},
+	{"parameterized-image-tags", "docker image tags are set by a parameter", lintImageTags},
+}
+
+// orbLintSkip is the comment suppressing rules, for the whole orb in
+// @orb.yml, or for the element defined by a file.
+var orbLintSkip = regexp.MustCompile(`(?m)^\s*#\s*orb-lint-skip:\s*(.+)$`)
+
+var kebabCase = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+var includeStatement = regexp.MustCompile(`^<<[\s]*include\(([-\w\/\.]+)\)?[\s]*>>$`)
+
+var orbElementKinds = []string{"commands", "executors", "jobs"}
+
+func orbLintRulesHelp() string {
+	var help strings.Builder
+	for _, rule := range orbLintRules {
+		fmt.Fprintf(&help, "  %-26s %s\n", rule.name, rule.description)
+	}
+	return help.String()
+}
+
+func lintOrbCommand(opts orbOptions, lintOpts orbLintOptions) error {
+	findings, err := lintOrb(opts.args[0], lintOpts.skip)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if lintOpts.output != "" {
+		file, createErr := os.Create(lintOpts.output)
+		if createErr != nil {
+			return errors.Wrap(createErr, "Unable to write the findings")
+		}
+		defer file.Close()
+		w = file
+	}
+
+	switch lintOpts.format {
+	case orbLintFormatText:
+		printOrbLint(w, findings)
+	case orbLintFormatJSON:
+		err = printOrbLintJSON(w, findings)
+	case orbLintFormatJUnit:
+		err = printOrbLintJUnit(w, filepath.Base(opts.args[0]), findings, lintOpts.skip)
+	default:
+		return fmt.Errorf("unknown format `%s`, expected one of: %s, %s, %s", lintOpts.format, orbLintFormatText, orbLintFormatJSON, orbLintFormatJUnit)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(findings) > 0 {
+		return fmt.Errorf("the orb breaks %d lint rules", len(findings))
+	}
+	return nil
+}
+
+// lintOrb runs every rule but those skipped on the orb source in dir.
+func lintOrb(dir string, skip []string) ([]orbLintFinding, error) {
+	for _, rule := range skip {
+		if findOrbLintRule(rule) == nil {
+			return nil, fmt.Errorf("unknown lint rule `%s`", rule)
+		}
+	}
+
+	orbSchema, err := loadOrbSchema(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := yaml.Marshal(orbSchema)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed trying to marshal Orb YAML")
+	}
+
+	source := &orbLintSource{dir: dir}
+	if err := yaml.Unmarshal(out, &source.orb); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the orb")
+	}
+	source.display, _ = source.orb["display"].(map[string]interface{})
+
+	skipped := map[string]bool{}
+	for _, rule := range skip {
+		skipped[rule] = true
+	}
+	for _, rule := range readOrbLintSkip(filepath.Join(dir, "@orb.yml")) {
+		skipped[rule] = true
+	}
+
+	var findings []orbLintFinding
+	for _, rule := range orbLintRules {
+		if skipped[rule.name] {
+			continue
+		}
+
+		for _, finding := range rule.check(source) {
+			finding.Rule = rule.name
+			if !source.skippedFor(finding) {
+				findings = append(findings, finding)
+			}
+		}
+	}
+
+	sort.SliceStable(findings, func(i, j int) bool {
+		return findings[i].Location < findings[j].Location
+	})
+	return findings, nil
+}
+
+func findOrbLintRule(name string) *orbLintRule {
+	for i := range orbLintRules {
+		if orbLintRules[i].name == name {
+			return &orbLintRules[i]
+		}
+	}
+	return nil
+}
+
+// skippedFor reports whether the file defining the element of a finding
+// suppresses its rule.
+func (o *orbLintSource) skippedFor(finding orbLintFinding) bool {
+	parts := strings.SplitN(finding.Location, "/", 3)
+	if len(parts) < 2 {
+		return false
+	}
+
+	for _, ext := range []string{".yml", ".yaml"} {
+		for _, rule := range readOrbLintSkip(filepath.Join(o.dir, parts[0], parts[1]+ext)) {
+			if rule == finding.Rule {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func readOrbLintSkip(path string) []string {
+	content, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return nil
+	}
+
+	var rules []string
+	for _, match := range orbLintSkip.FindAllStringSubmatch(string(content), -1) {
+		for _, rule := range strings.Split(match[1], ",") {
+			rules = append(rules, strings.TrimSpace(rule))
+		}
+	}
+	return rules
+}
+
+// elements calls fn with every command, executor and job of the orb, in
+// order.
+func (o *orbLintSource) elements(fn func(kind, name string, element map[string]interface{})) {
+	for _, kind := range orbElementKinds {
+		elements, _ := o.orb[kind].(map[string]interface{})
+		for _, name := range sortedMapKeys(elements) {
+			element, _ := elements[name].(map[string]interface{})
+			fn(kind, name, element)
+		}
+	}
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// singular turns `jobs` into `job`, for messages.
+func singular(kind string) string {
+	return strings.TrimSuffix(kind, "s")
+}
+
+func lintDisplayMetadata(o *orbLintSource) []orbLintFinding {
+	if url, _ := o.display["source_url"].(string); url != "" {
+		return nil
+	}
+	return []orbLintFinding{{Location: "@orb.yml", Message: "display.source_url is not set"}}
+}
+
+func lintElementDescriptions(o *orbLintSource) []orbLintFinding {
+	var findings []orbLintFinding
+	o.elements(func(kind, name string, element map[string]interface{}) {
+		if description, _ := element["description"].(string); strings.TrimSpace(description) == "" {
+			findings = append(findings, orbLintFinding{
+				Location: kind + "/" + name,
+				Message:  fmt.Sprintf("the %s has no description", singular(kind)),
+			})
+		}
+	})
+	return findings
+}
+
+func lintParameterDescriptions(o *orbLintSource) []orbLintFinding {
+	var findings []orbLintFinding
+	o.elements(func(kind, name string, element map[string]interface{}) {
+		parameters, _ := element["parameters"].(map[string]interface{})
+		for _, parameter := range sortedMapKeys(parameters) {
+			definition, _ := parameters[parameter].(map[string]interface{})
+			if description, _ := definition["description"].(string); strings.TrimSpace(description) == "" {
+				findings = append(findings, orbLintFinding{
+					Location: fmt.Sprintf("%s/%s/parameters/%s", kind, name, parameter),
+					Message:  "the parameter has no description",
+				})
+			}
+		}
+	})
+	return findings
+}
+
+func lintKebabCaseNames(o *orbLintSource) []orbLintFinding {
+	var findings []orbLintFinding
+	check := func(location, name string) {
+		if !kebabCase.MatchString(name) {
+			findings = append(findings, orbLintFinding{
+				Location: location,
+				Message:  fmt.Sprintf("`%s` is not in kebab-case", name),
+			})
+		}
+	}
+
+	o.elements(func(kind, name string, element map[string]interface{}) {
+		check(kind+"/"+name, name)
+		parameters, _ := element["parameters"].(map[string]interface{})
+		for _, parameter := range sortedMapKeys(parameters) {
+			check(fmt.Sprintf("%s/%s/parameters/%s", kind, name, parameter), parameter)
+		}
+	})
+
+	examples, _ := o.orb["examples"].(map[string]interface{})
+	for _, name := range sortedMapKeys(examples) {
+		check("examples/"+name, name)
+	}
+	return findings
+}
+
+func lintLongScripts(o *orbLintSource) []orbLintFinding {
+	var findings []orbLintFinding
+	o.elements(func(kind, name string, element map[string]interface{}) {
+		steps, _ := element["steps"].([]interface{})
+		for i, step := range steps {
+			command := runCommand(step)
+			if len(strings.TrimSpace(command)) <= orbLintMaxScriptLength || includeStatement.MatchString(strings.TrimSpace(command)) {
+				continue
+			}
+			findings = append(findings, orbLintFinding{
+				Location: fmt.Sprintf("%s/%s/steps/%d", kind, name, i),
+				Message:  fmt.Sprintf("the run command is %d characters long, move it to a script included with <<include(scripts/...)>>", len(command)),
+			})
+		}
+	})
+	return findings
+}
+
+// runCommand returns the command of a run step, or nothing for other steps.
+func runCommand(step interface{}) string {
+	m, ok := step.(map[string]interface{})
+	if !ok {
+		return ""
+	}
+	switch run := m["run"].(type) {
+	case string:
+		return run
+	case map[string]interface{}:
+		command, _ := run["command"].(string)
+		return command
+	}
+	return ""
+}
+
+func lintJobExamples(o *orbLintSource) []orbLintFinding {
+	used := map[string]bool{}
+	examples, _ := o.orb["examples"].(map[string]interface{})
+	for _, value := range examples {
+		example, _ := value.(map[string]interface{})
+		usage, _ := example["usage"].(map[string]interface{})
+		workflows, _ := usage["workflows"].(map[string]interface{})
+		for _, value := range workflows {
+			workflow, _ := value.(map[string]interface{})
+			jobs, _ := workflow["jobs"].([]interface{})
+			for _, job := range jobs {
+				for _, name := range workflowJobNames(job) {
+					if i := strings.Index(name, "/"); i >= 0 {
+						used[name[i+1:]] = true
+					}
+				}
+			}
+		}
+	}
+
+	var findings []orbLintFinding
+	jobs, _ := o.orb["jobs"].(map[string]interface{})
+	for _, name := range sortedMapKeys(jobs) {
+		if !used[name] {
+			findings = append(findings, orbLintFinding{
+				Location: "jobs/" + name,
+				Message:  "no example uses the job",
+			})
+		}
+	}
+	return findings
+}
+
+// workflowJobNames returns the name of a job of a workflow, given as a string
+// or as a map with its parameters.
+func workflowJobNames(job interface{}) []string {
+	switch job := job.(type) {
+	case string:
+		return []string{job}
+	case map[string]interface{}:
+		return sortedMapKeys(job)
+	}
+	return nil
+}
+
+func lintImageTags(o *orbLintSource) []orbLintFinding {
+	var findings []orbLintFinding
+	o.elements(func(kind, name string, element map[string]interface{}) {
+		if kind == "commands" {
+			return
+		}
+		images, _ := element["docker"].([]interface{})
+		for i, value := range images {
+			image, _ := value.(map[string]interface{})
+			ref, _ := image["image"].(string)
+			if ref == "" || strings.Contains(ref, "<<") {
+				continue
+			}
+			findings = append(findings, orbLintFinding{
+				Location: fmt.Sprintf("%s/%s/docker/%d", kind, name, i),
+				Message:  fmt.Sprintf("the tag of `%s` is hard-coded, set it with a parameter", ref),
+			})
+		}
+	})
+	return findings
+}
+
+func printOrbLint(w io.Writer, findings []orbLintFinding) {
+	if len(findings) == 0 {
+		fmt.Fprintln(w, "The orb follows every lint rule.")
+		return
+	}
+
+	for _, finding := range findings {
+		fmt.Fprintf(w, "%s: %s (%s)\n", finding.Location, finding.Message, finding.Rule)
+	}
+	fmt.Fprintf(w, "\nSkip a rule with --skip <rule>, or for one element with a `# orb-lint-skip: <rule>` comment in its file.\n")
+}
+
+func printOrbLintJSON(w io.Writer, findings []orbLintFinding) error {
+	if findings == nil {
+		findings = []orbLintFinding{}
+	}
+
+	out, err := json.MarshalIndent(findings, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to convert to JSON")
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// printOrbLintJUnit writes a test case per rule, failing with the findings
+// breaking it.
+func printOrbLintJUnit(w io.Writer, name string, findings []orbLintFinding, skip []string) error {
+	suite := junitTestSuite{Name: name, Time: formatSeconds(0)}
+
+	for _, rule := range orbLintRules {
+		testCase := junitTestCase{Name: rule.name, ClassName: name, Time: formatSeconds(0)}
+
+		var lines []string
+		for _, finding := range findings {
+			if finding.Rule == rule.name {
+				lines = append(lines, fmt.Sprintf("%s: %s", finding.Location, finding.Message))
+			}
+		}
+		if len(lines) > 0 {
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				Message: rule.description,
+				Text:    strings.Join(lines, "\n"),
+			}
+		}
+
+		for _, skipped := range skip {
+			if skipped == rule.name {
+				testCase.Skipped = &struct{}{}
+			}
+		}
+
+		suite.Tests++
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	out, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
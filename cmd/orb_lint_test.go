@@ -0,0 +1,144 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Orb lint", func() {
+	var dir string
+
+	write := func(name, contents string) {
+		path := filepath.Join(dir, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "circleci-orb-lint")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		write("@orb.yml", `version: 2.1
+description: An orb
+display:
+  source_url: https://github.com/example/my-orb
+`)
+		write("executors/default.yml", `description: The default executor
+parameters:
+  tag:
+    description: The tag of the image
+    type: string
+    default: stable
+docker:
+  - image: cimg/base:<< parameters.tag >>
+`)
+		write("jobs/test.yml", `description: Runs the tests
+executor: default
+steps:
+  - run:
+      name: Test
+      command: <<include(scripts/test.sh)>>
+`)
+		write("scripts/test.sh", "make test\n")
+		write("examples/run-tests.yml", `description: Runs the tests
+usage:
+  version: 2.1
+  orbs:
+    my-orb: example/my-orb@1.0.0
+  workflows:
+    main:
+      jobs:
+        - my-orb/test:
+            context: ci
+`)
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("finds nothing in an orb following the rules", func() {
+		findings, err := lintOrb(dir, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(findings).To(BeEmpty())
+	})
+
+	It("reports the findings of every rule", func() {
+		write("@orb.yml", "version: 2.1\ndescription: An orb\n")
+		write("commands/install_tools.yml", `parameters:
+  Version:
+    type: string
+    default: "1.0"
+steps:
+  - run: curl -fsSL https://example.com/install.sh | sh -s -- --version << parameters.Version >>
+`)
+		write("jobs/build.yml", `description: Builds
+docker:
+  - image: cimg/go:1.19
+steps:
+  - checkout
+`)
+
+		findings, err := lintOrb(dir, nil)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(findings).To(Equal([]orbLintFinding{
+			{"display-metadata", "@orb.yml", "display.source_url is not set"},
+			{"element-description", "commands/install_tools", "the command has no description"},
+			{"kebab-case-names", "commands/install_tools", "`install_tools` is not in kebab-case"},
+			{"parameter-description", "commands/install_tools/parameters/Version", "the parameter has no description"},
+			{"kebab-case-names", "commands/install_tools/parameters/Version", "`Version` is not in kebab-case"},
+			{"include-long-scripts", "commands/install_tools/steps/0", "the run command is 87 characters long, move it to a script included with <<include(scripts/...)>>"},
+			{"job-examples", "jobs/build", "no example uses the job"},
+			{"parameterized-image-tags", "jobs/build/docker/0", "the tag of `cimg/go:1.19` is hard-coded, set it with a parameter"},
+		}))
+	})
+
+	It("skips rules given on the command line or in comments", func() {
+		write("@orb.yml", "# orb-lint-skip: display-metadata\nversion: 2.1\n")
+		write("jobs/build.yml", `# orb-lint-skip: job-examples, parameterized-image-tags
+description: Builds
+docker:
+  - image: cimg/go:1.19
+steps:
+  - checkout
+`)
+		write("jobs/deploy.yml", "description: Deploys\nsteps:\n  - checkout\n")
+
+		findings, err := lintOrb(dir, []string{"element-description"})
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(findings).To(Equal([]orbLintFinding{
+			{"job-examples", "jobs/deploy", "no example uses the job"},
+		}))
+	})
+
+	It("rejects unknown rules", func() {
+		_, err := lintOrb(dir, []string{"no-such-rule"})
+		Expect(err).To(MatchError("unknown lint rule `no-such-rule`"))
+	})
+
+	It("writes the findings as JUnit, a test case per rule", func() {
+		var out bytes.Buffer
+		Expect(printOrbLintJUnit(&out, "src", []orbLintFinding{
+			{"job-examples", "jobs/deploy", "no example uses the job"},
+		}, []string{"display-metadata"})).To(Succeed())
+
+		Expect(strings.Count(out.String(), "<testcase ")).To(Equal(len(orbLintRules)))
+		Expect(out.String()).To(ContainSubstring(`<testsuite name="src" tests="7" failures="1" time="0.000">`))
+		Expect(out.String()).To(ContainSubstring(`<failure message="every job is used by an example">jobs/deploy: no example uses the job</failure>`))
+		Expect(out.String()).To(ContainSubstring(`<testcase name="display-metadata" classname="src" time="0.000">
+      <skipped></skipped>`))
+	})
+
+	It("writes the findings as JSON", func() {
+		var out bytes.Buffer
+		Expect(printOrbLintJSON(&out, nil)).To(Succeed())
+		Expect(out.String()).To(Equal("[]\n"))
+	})
+})
@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CircleCI-Public/circleci-cli/api"
+	"github.com/CircleCI-Public/circleci-cli/api/graphql"
+	"github.com/CircleCI-Public/circleci-cli/references"
+	"github.com/CircleCI-Public/circleci-cli/settings"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// orbMirrorMetadataFile is saved beside the sources of every version of an
+// orb in a mirror.
+const orbMirrorMetadataFile = "orb.json"
+
+// orbMirrorMetadata is what `orb info` shows about an orb, beside what it
+// reads from the source of a version.
+type orbMirrorMetadata struct {
+	Name       string            `json:"name"`
+	CreatedAt  string            `json:"createdAt"`
+	Statistics api.OrbStatistics `json:"statistics"`
+	Categories []api.OrbCategory `json:"categories"`
+	// Versions are the published versions of the orb, the highest first,
+	// whether their source was mirrored or not.
+	Versions []orbMirrorVersion `json:"versions"`
+}
+
+type orbMirrorVersion struct {
+	Version   string `json:"version"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// orbMirror is a directory holding orbs saved by `orb mirror`, laid out as
+// <namespace>/<orb>/<version>.yml and <namespace>/<orb>/orb.json.
+type orbMirror struct {
+	dir string
+}
+
+type orbMirrorOptions struct {
+	dir         string
+	allVersions bool
+}
+
+func mirrorOrbsCommand(opts orbOptions, mirrorOpts orbMirrorOptions) error {
+	dir := mirrorOpts.dir
+	if dir == "" && opts.cfg != nil {
+		dir = opts.cfg.OrbMirrorDir
+	}
+	if dir == "" {
+		return errors.New("Set the directory of the mirror with --dir, or with the orb_mirror_dir setting")
+	}
+
+	ref := opts.args[0]
+	if strings.Contains(ref, "@") {
+		return fmt.Errorf("Expected a namespace or an orb without a version, got '%s'", ref)
+	}
+
+	names := []string{ref}
+	if isNamespace(ref) {
+		versions, err := api.ListNamespaceOrbVersions(opts.cl, ref)
+		if err != nil {
+			return errors.Wrapf(err, "Failed to list the orbs of '%s'", ref)
+		}
+		names = names[:0]
+		for _, version := range versions {
+			names = append(names, version.Orb.Name)
+		}
+	} else if _, _, err := references.SplitIntoOrbAndNamespace(ref); err != nil {
+		return err
+	}
+
+	mirror := orbMirror{dir: dir}
+	for _, name := range names {
+		if err := mirror.mirrorOrb(opts.cl, name, mirrorOpts.allVersions); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("Mirrored %d orb(s) to %s\n", len(names), dir)
+	return nil
+}
+
+// mirrorOrb saves the latest version of an orb, or all of them, and its
+// metadata. Versions already in the mirror are not written again, since
+// published versions never change.
+func (m orbMirror) mirrorOrb(cl *graphql.Client, name string, allVersions bool) error {
+	info, err := api.OrbInfo(cl, name)
+	if _, ok := err.(*api.ErrOrbVersionNotExists); ok {
+		fmt.Printf("Skipping %s, which has no published version\n", name)
+		return nil
+	}
+	if err != nil {
+		return errors.Wrapf(err, "Failed to get info for '%s'", name)
+	}
+
+	listed := info.Orb.Versions
+	versions := []api.OrbVersion{*info}
+	if allVersions {
+		// OrbInfo lists only the latest 200 versions, and without their
+		// sources, which OrbVersions returns for every version.
+		if versions, err = api.OrbVersions(cl, name); err != nil {
+			return errors.Wrapf(err, "Failed to list the versions of '%s'", name)
+		}
+		listed = versions
+	}
+
+	for _, version := range versions {
+		path := m.sourcePath(name, version.Version)
+		if _, statErr := os.Stat(path); statErr == nil {
+			continue
+		}
+
+		if err = writeMirrorFile(path, []byte(version.Source)); err != nil {
+			return err
+		}
+		fmt.Printf("Mirrored %s@%s\n", name, version.Version)
+	}
+
+	metadata := orbMirrorMetadata{
+		Name:       info.Orb.Name,
+		CreatedAt:  info.Orb.CreatedAt,
+		Statistics: api.OrbStatistics(info.Orb.Statistics),
+		Categories: info.Orb.Categories,
+	}
+	for _, version := range listed {
+		metadata.Versions = append(metadata.Versions, orbMirrorVersion{version.Version, version.CreatedAt})
+	}
+
+	out, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "Failed to convert to JSON")
+	}
+	return writeMirrorFile(filepath.Join(m.dir, filepath.FromSlash(name), orbMirrorMetadataFile), out)
+}
+
+func writeMirrorFile(path string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return errors.Wrap(err, "Unable to create the directory of the mirror")
+	}
+	return errors.Wrapf(ioutil.WriteFile(path, contents, 0644), "Unable to write %s", path)
+}
+
+func (m orbMirror) sourcePath(name, version string) string {
+	return filepath.Join(m.dir, filepath.FromSlash(name), version+".yml")
+}
+
+// load reads a version of an orb from the mirror, like api.OrbInfo reads it
+// from the registry. It reports whether the mirror holds the version; a ref
+// without a version, or with `volatile`, is the highest version.
+func (m orbMirror) load(ref string) (*api.OrbVersion, bool, error) {
+	if err := references.IsOrbRefWithOptionalVersion(ref); err != nil {
+		return nil, false, err
+	}
+
+	name, version := ref, ""
+	if i := strings.Index(ref, "@"); i >= 0 {
+		name, version = ref[:i], ref[i+1:]
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(m.dir, filepath.FromSlash(name), orbMirrorMetadataFile)) // #nosec
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "Unable to read the mirror of '%s'", name)
+	}
+
+	var metadata orbMirrorMetadata
+	if err = json.Unmarshal(raw, &metadata); err != nil {
+		return nil, false, errors.Wrapf(err, "Corrupt mirror of '%s'", name)
+	}
+
+	if version == "" || version == "volatile" {
+		if len(metadata.Versions) == 0 {
+			return nil, false, nil
+		}
+		version = metadata.Versions[0].Version
+	}
+
+	source, err := ioutil.ReadFile(m.sourcePath(name, version)) // #nosec
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "Unable to read the mirror of '%s@%s'", name, version)
+	}
+
+	info := &api.OrbVersion{
+		Version: version,
+		Source:  string(source),
+		Orb: api.Orb{
+			Name:       metadata.Name,
+			Namespace:  api.Namespace{Name: strings.SplitN(name, "/", 2)[0]},
+			CreatedAt:  metadata.CreatedAt,
+			Categories: metadata.Categories,
+		},
+	}
+	info.Orb.Statistics.Last30DaysBuildCount = metadata.Statistics.Last30DaysBuildCount
+	info.Orb.Statistics.Last30DaysProjectCount = metadata.Statistics.Last30DaysProjectCount
+	info.Orb.Statistics.Last30DaysOrganizationCount = metadata.Statistics.Last30DaysOrganizationCount
+
+	for _, v := range metadata.Versions {
+		info.Orb.Versions = append(info.Orb.Versions, api.OrbVersion{Version: v.Version, CreatedAt: v.CreatedAt})
+		if v.Version == version {
+			info.CreatedAt = v.CreatedAt
+		}
+	}
+	if len(info.Orb.Versions) > 0 {
+		info.Orb.HighestVersion = info.Orb.Versions[0].Version
+	}
+
+	if err = yaml.Unmarshal(source, &info.Orb); err != nil {
+		return nil, false, errors.Wrapf(err, "Corrupt Orb %s %s", name, version)
+	}
+
+	return info, true, nil
+}
+
+// fetchOrbInfo gets the meta-data of an orb from the mirror set by the
+// orb_mirror_dir setting when it holds the orb, and from the registry
+// otherwise.
+func fetchOrbInfo(cfg *settings.Config, cl *graphql.Client, ref string) (*api.OrbVersion, error) {
+	if cfg != nil && cfg.OrbMirrorDir != "" {
+		info, ok, err := orbMirror{dir: cfg.OrbMirrorDir}.load(ref)
+		if err != nil || ok {
+			return info, err
+		}
+	}
+	return api.OrbInfo(cl, ref)
+}
+
+// fetchOrbSource gets the source of an orb like fetchOrbInfo.
+func fetchOrbSource(cfg *settings.Config, cl *graphql.Client, ref string) (string, error) {
+	if cfg != nil && cfg.OrbMirrorDir != "" {
+		info, ok, err := orbMirror{dir: cfg.OrbMirrorDir}.load(ref)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return info.Source, nil
+		}
+	}
+	return api.OrbSource(cl, ref)
+}
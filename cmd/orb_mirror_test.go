@@ -0,0 +1,201 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/CircleCI-Public/circleci-cli/api/graphql"
+	"github.com/CircleCI-Public/circleci-cli/clitest"
+	"github.com/CircleCI-Public/circleci-cli/settings"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Orb mirror", func() {
+	const infoQuery = `query($orbVersionRef: String!) {
+			    orbVersion(orbVersionRef: $orbVersionRef) {
+			        id
+                                version
+                                orb {
+                                    id
+                                    createdAt
+									name
+									namespace {
+									  name
+									}
+                                    categories {
+                                      id
+                                      name
+                                    }
+	                            statistics {
+		                        last30DaysBuildCount,
+		                        last30DaysProjectCount,
+		                        last30DaysOrganizationCount
+	                            }
+                                    versions(count: 200) {
+                                        createdAt
+                                        version
+                                    }
+                                }
+                                source
+                                createdAt
+			    }
+		      }`
+
+	const versionsQuery = `query($name: String!, $count: Int!) {
+			    orb(name: $name) {
+			        id
+			        createdAt
+			        name
+			        namespace {
+			            name
+			        }
+			        versions(count: $count) {
+			            id
+			            version
+			            source
+			            createdAt
+			        }
+			    }
+		      }`
+
+	var (
+		cli    *clitest.TempSettings
+		client *graphql.Client
+		dir    string
+		mirror orbMirror
+	)
+
+	expect := func(request *graphql.Request, response string) {
+		encoded, err := request.Encode()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		cli.AppendPostHandler("", clitest.MockRequestResponse{
+			Status:   http.StatusOK,
+			Request:  encoded.String(),
+			Response: response,
+		})
+	}
+
+	expectRequest := func(query, ref, response string) {
+		request := graphql.NewRequest(query)
+		request.Variables["orbVersionRef"] = ref
+		expect(request, response)
+	}
+
+	expectVersions := func() {
+		request := graphql.NewRequest(versionsQuery)
+		request.Variables["name"] = "my-ns/my-orb"
+		request.Variables["count"] = 100
+		expect(request, `{
+			"orb": {
+				"id": "bb604b45-b6b0-4b81-ad80-796f15eddf87",
+				"createdAt": "2018-09-24T08:53:37.086Z",
+				"name": "my-ns/my-orb",
+				"namespace": {"name": "my-ns"},
+				"versions": [
+					{"version": "1.1.0", "source": "version: 2.1\n", "createdAt": "2018-10-11T22:12:19.477Z"},
+					{"version": "1.0.0", "source": "version: 2.1\n", "createdAt": "2018-09-24T08:53:37.086Z"}
+				]
+			}
+		}`)
+	}
+
+	expectInfo := func() {
+		expectRequest(infoQuery, "my-ns/my-orb@volatile", `{
+			"orbVersion": {
+				"id": "bb604b45-b6b0-4b81-ad80-796f15eddf87",
+				"version": "1.1.0",
+				"orb": {
+					"id": "bb604b45-b6b0-4b81-ad80-796f15eddf87",
+					"createdAt": "2018-09-24T08:53:37.086Z",
+					"name": "my-ns/my-orb",
+					"namespace": {"name": "my-ns"},
+					"categories": [{"id": "1", "name": "Testing"}],
+					"statistics": {
+						"last30DaysBuildCount": 12,
+						"last30DaysProjectCount": 3,
+						"last30DaysOrganizationCount": 1
+					},
+					"versions": [
+						{"version": "1.1.0", "createdAt": "2018-10-11T22:12:19.477Z"},
+						{"version": "1.0.0", "createdAt": "2018-09-24T08:53:37.086Z"}
+					]
+				},
+				"source": "version: 2.1\ncommands:\n  greet:\n    steps:\n      - run: echo hello\n",
+				"createdAt": "2018-10-11T22:12:19.477Z"
+			}
+		}`)
+	}
+
+	BeforeEach(func() {
+		cli = clitest.WithTempSettings()
+		client = cli.NewFakeClient("graphql-unstable", "")
+
+		var err error
+		dir, err = ioutil.TempDir("", "circleci-orb-mirror")
+		Expect(err).ShouldNot(HaveOccurred())
+		mirror = orbMirror{dir: dir}
+	})
+
+	AfterEach(func() {
+		cli.Close()
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("saves every version of an orb and its metadata", func() {
+		expectInfo()
+		expectVersions()
+
+		Expect(mirror.mirrorOrb(client, "my-ns/my-orb", true)).To(Succeed())
+
+		source, err := ioutil.ReadFile(filepath.Join(dir, "my-ns", "my-orb", "1.0.0.yml"))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(string(source)).To(Equal("version: 2.1\n"))
+		Expect(filepath.Join(dir, "my-ns", "my-orb", "1.1.0.yml")).To(BeAnExistingFile())
+		Expect(filepath.Join(dir, "my-ns", "my-orb", "orb.json")).To(BeAnExistingFile())
+		Expect(cli.TestServer.ReceivedRequests()).To(HaveLen(2))
+	})
+
+	Describe("reading orbs", func() {
+		BeforeEach(func() {
+			expectInfo()
+			Expect(mirror.mirrorOrb(client, "my-ns/my-orb", false)).To(Succeed())
+		})
+
+		It("reads the highest version like the registry", func() {
+			info, ok, err := mirror.load("my-ns/my-orb")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(info.Version).To(Equal("1.1.0"))
+			Expect(info.CreatedAt).To(Equal("2018-10-11T22:12:19.477Z"))
+			Expect(info.Orb.Name).To(Equal("my-ns/my-orb"))
+			Expect(info.Orb.Namespace.Name).To(Equal("my-ns"))
+			Expect(info.Orb.HighestVersion).To(Equal("1.1.0"))
+			Expect(info.Orb.Versions).To(HaveLen(2))
+			Expect(info.Orb.Commands).To(HaveKey("greet"))
+			Expect(info.Orb.Statistics.Last30DaysBuildCount).To(Equal(12))
+			Expect(info.Orb.Categories[0].Name).To(Equal("Testing"))
+		})
+
+		It("reports the versions it does not hold", func() {
+			_, ok, err := mirror.load("my-ns/my-orb@1.0.0")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+
+			_, ok, err = mirror.load("other-ns/other-orb")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(ok).To(BeFalse())
+		})
+
+		It("is read before the registry when set", func() {
+			cfg := &settings.Config{OrbMirrorDir: dir}
+			source, err := fetchOrbSource(cfg, client, "my-ns/my-orb@1.1.0")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(source).To(HavePrefix("version: 2.1\ncommands:"))
+			Expect(cli.TestServer.ReceivedRequests()).To(HaveLen(1))
+		})
+	})
+})
@@ -1102,6 +1102,128 @@ See a full explanation and documentation on orbs here: https://circleci.com/docs
 			})
 		})
 
+		Context("with an orb removing a parameter of its latest version", func() {
+			const released = "version: 2.1\njobs:\n  test:\n    parameters:\n      command:\n        type: string\n    steps:\n      - run: << parameters.command >>\n"
+			const changed = "version: 2.1\njobs:\n  test:\n    steps:\n      - run: make test\n"
+
+			var (
+				expectedVersionRequest string
+				gqlVersionResponse     string
+				expectedInfoRequest    string
+				gqlInfoResponse        string
+			)
+
+			BeforeEach(func() {
+				orb.Write([]byte(changed))
+
+				expectedVersionRequest = `{
+					"query": "query($name: String!) {\n\t\t\t    orb(name: $name) {\n\t\t\t      versions(count: 1) {\n\t\t\t\t    version\n\t\t\t      }\n\t\t\t    }\n\t\t      }",
+					"variables": {
+						"name": "my/orb"
+					}
+				}`
+				gqlVersionResponse = `{
+					"orb": {
+						"versions": [{"version": "1.2.3"}]
+					}
+				}`
+
+				expectedInfoRequest = `{
+					"query": "query($orbVersionRef: String!) {\n\t\t\t    orbVersion(orbVersionRef: $orbVersionRef) {\n\t\t\t        id\n                                version\n                                orb {\n                                    id\n                                    createdAt\n\t\t\t\t\t\t\t\t\tname\n\t\t\t\t\t\t\t\t\tnamespace {\n\t\t\t\t\t\t\t\t\t  name\n\t\t\t\t\t\t\t\t\t}\n                                    categories {\n                                      id\n                                      name\n                                    }\n\t                            statistics {\n\t\t                        last30DaysBuildCount,\n\t\t                        last30DaysProjectCount,\n\t\t                        last30DaysOrganizationCount\n\t                            }\n                                    versions(count: 200) {\n                                        createdAt\n                                        version\n                                    }\n                                }\n                                source\n                                createdAt\n\t\t\t    }\n\t\t      }",
+					"variables": {
+						"orbVersionRef": "my/orb@1.2.3"
+					}
+				}`
+				source, err := json.Marshal(released)
+				Expect(err).ShouldNot(HaveOccurred())
+				gqlInfoResponse = fmt.Sprintf(`{
+					"orbVersion": {
+						"id": "orbversionid1",
+						"version": "1.2.3",
+						"orb": {
+							"id": "orbid1",
+							"name": "my/orb",
+							"versions": [{"version": "1.2.3"}]
+						},
+						"source": %s
+					}
+				}`, source)
+			})
+
+			It("picks a major release with --auto", func() {
+				command = exec.Command(pathCLI,
+					"orb", "publish", "increment",
+					"--skip-update-check",
+					"--token", token,
+					"--host", tempSettings.TestServer.URL(),
+					"--auto",
+					orb.Path,
+					"my/orb",
+				)
+
+				config, err := json.Marshal(changed)
+				Expect(err).ShouldNot(HaveOccurred())
+				expectedPublishRequest := fmt.Sprintf(`{
+					"query": "\n\t\tmutation($config: String!, $orbName: String, $namespaceName: String, $version: String!) {\n\t\t\tpublishOrb(\n\t\t\t\torbName: $orbName,\n\t\t\t\tnamespaceName: $namespaceName,\n\t\t\t\torbYaml: $config,\n\t\t\t\tversion: $version\n\t\t\t) {\n\t\t\t\torb {\n\t\t\t\t\tversion\n\t\t\t\t}\n\t\t\t\terrors { message }\n\t\t\t}\n\t\t}\n\t",
+					"variables": {
+						"config": %s,
+						"namespaceName": "my",
+						"orbName": "orb",
+						"version": "2.0.0"
+					}
+				}`, config)
+
+				tempSettings.AppendPostHandler(token, clitest.MockRequestResponse{Status: http.StatusOK, Request: expectedVersionRequest, Response: gqlVersionResponse})
+				tempSettings.AppendPostHandler(token, clitest.MockRequestResponse{Status: http.StatusOK, Request: expectedInfoRequest, Response: gqlInfoResponse})
+				tempSettings.AppendPostHandler(token, clitest.MockRequestResponse{Status: http.StatusOK, Request: expectedVersionRequest, Response: gqlVersionResponse})
+				tempSettings.AppendPostHandler(token, clitest.MockRequestResponse{Status: http.StatusOK, Request: expectedPublishRequest, Response: `{
+						"publishOrb": {
+							"errors": [],
+							"orb": {"version": "2.0.0"}
+						}
+					}`})
+				tempSettings.AppendPostHandler(token, clitest.MockRequestResponse{Status: http.StatusOK, Request: `{
+						"query": "\n\tquery ($name: String!, $namespace: String) {\n\t\torb(name: $name) {\n\t\t  id\n\t\t  isPrivate\n\t\t}\n\t\tregistryNamespace(name: $namespace) {\n\t\t\tid\n\t\t  }\n\t  }\n\t  ",
+						"variables": {
+							"name": "my/orb",
+							"namespace": "my"
+						}
+					}`, Response: `{
+						"orb": {"id": "orbid1", "isPrivate": true},
+						"registryNamespace": {"id": "nsid1"}
+					}`})
+
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+
+				Expect(err).ShouldNot(HaveOccurred())
+				Eventually(session.Out).Should(gbytes.Say("jobs/test: parameter `command`: parameter removed"))
+				Eventually(session.Out).Should(gbytes.Say("These changes call for a major release."))
+				Eventually(session.Out).Should(gbytes.Say("Orb `my/orb` has been incremented to `my/orb@2.0.0`."))
+				Eventually(session).Should(gexec.Exit(0))
+			})
+
+			It("refuses a minor release with --strict", func() {
+				command = exec.Command(pathCLI,
+					"orb", "publish", "increment",
+					"--skip-update-check",
+					"--token", token,
+					"--host", tempSettings.TestServer.URL(),
+					"--strict",
+					orb.Path,
+					"my/orb", "minor",
+				)
+
+				tempSettings.AppendPostHandler(token, clitest.MockRequestResponse{Status: http.StatusOK, Request: expectedVersionRequest, Response: gqlVersionResponse})
+				tempSettings.AppendPostHandler(token, clitest.MockRequestResponse{Status: http.StatusOK, Request: expectedInfoRequest, Response: gqlInfoResponse})
+
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+
+				Expect(err).ShouldNot(HaveOccurred())
+				Eventually(session.Err).Should(gbytes.Say("Error: refusing to publish a minor release with breaking changes, which call for a major release"))
+				Eventually(session).Should(clitest.ShouldFail())
+			})
+		})
+
 		Describe("when creating / reserving an orb", func() {
 			Context("skipping prompts", func() {
 				BeforeEach(func() {
@@ -2183,6 +2305,91 @@ query ListOrbs ($after: String!, $certifiedOnly: Boolean!) {
 			})
 		})
 
+		Describe("when listing orbs with integer and enum parameter defaults", func() {
+			BeforeEach(func() {
+				command = exec.Command(pathCLI,
+					"orb", "list",
+					"--skip-update-check",
+					"--host", tempSettings.TestServer.URL(),
+					"--details",
+				)
+
+				query := `
+query ListOrbs ($after: String!, $certifiedOnly: Boolean!) {
+  orbs(first: 20, after: $after, certifiedOnly: $certifiedOnly) {
+	totalCount,
+    edges {
+		cursor
+	  node {
+	    name
+	    statistics {
+		last30DaysBuildCount,
+		last30DaysProjectCount,
+		last30DaysOrganizationCount
+	    }
+		  versions(count: 1) {
+			version,
+			source
+		  }
+		}
+	}
+    pageInfo {
+      hasNextPage
+    }
+  }
+}
+`
+
+				request := graphql.NewRequest(query)
+				request.Variables["after"] = ""
+				request.Variables["certifiedOnly"] = true
+
+				encoded, err := request.Encode()
+				Expect(err).ShouldNot(HaveOccurred())
+
+				response := `{
+					"orbs": {
+						"totalCount": 1,
+						"edges": [
+							{
+								"cursor": "foo/test",
+								"node": {
+									"name": "foo/test",
+									"versions": [
+										{
+											"source": "version: 2.1\ncommands:\n  retry:\n    parameters:\n      attempts:\n        type: integer\n        default: 3\n      mode:\n        type: enum\n        enum: [fast, slow]\n        default: slow\n    steps:\n      - run: echo <<parameters.attempts>>\n",
+											"version": "0.7.0"
+										}
+									]
+								}
+							}
+						],
+						"pageInfo": {
+							"hasNextPage": false
+						}
+					}
+				}`
+
+				tempSettings.AppendPostHandler("", clitest.MockRequestResponse{
+					Status:   http.StatusOK,
+					Request:  encoded.String(),
+					Response: response,
+				})
+			})
+
+			It("shows the defaults of every type", func() {
+				session, err := gexec.Start(command, GinkgoWriter, GinkgoWriter)
+
+				Expect(err).ShouldNot(HaveOccurred())
+				stdout := session.Wait().Out.Contents()
+				Expect(string(stdout)).To(ContainSubstring(`    - retry: 2 parameter(s)
+       - attempts: integer (default: '3')
+       - mode: enum (default: 'slow')
+`))
+				Eventually(session).Should(gexec.Exit(0))
+			})
+		})
+
 		Describe("when listing all orbs with --details", func() {
 			BeforeEach(func() {
 				command = exec.Command(pathCLI,
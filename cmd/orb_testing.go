@@ -0,0 +1,538 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CircleCI-Public/circleci-cli/api/rest"
+	"github.com/CircleCI-Public/circleci-cli/config"
+	"github.com/CircleCI-Public/circleci-cli/pipeline"
+	"github.com/CircleCI-Public/circleci-cli/settings"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// Formats of the results of `orb test`.
+const (
+	orbTestFormatTAP   = "tap"
+	orbTestFormatJUnit = "junit"
+)
+
+type orbTestOptions struct {
+	// name is the alias the examples and tests import the orb under.
+	name   string
+	tests  string
+	format string
+	output string
+	orgID  string
+}
+
+// orbCompileFunc compiles a config, returning its expanded form.
+type orbCompileFunc func(config string) (string, error)
+
+// orbTestFixture is a file of the tests directory: a config using the orb,
+// and what is expected of its compiled form.
+type orbTestFixture struct {
+	Description string               `yaml:"description"`
+	Config      yaml.Node            `yaml:"config"`
+	Expect      []orbTestExpectation `yaml:"expect"`
+	Error       *string              `yaml:"error"`
+}
+
+// orbTestExpectation is an assertion on the value found at a path of the
+// compiled config, like `jobs.test.steps[3].run.command`.
+type orbTestExpectation struct {
+	Path     string  `yaml:"path"`
+	Equals   *string `yaml:"equals"`
+	Contains *string `yaml:"contains"`
+	Matches  *string `yaml:"matches"`
+	Exists   *bool   `yaml:"exists"`
+}
+
+type orbTestCase struct {
+	name    string
+	config  *yaml.Node
+	fixture *orbTestFixture
+}
+
+type orbTestResult struct {
+	name     string
+	failures []string
+	duration time.Duration
+}
+
+func testOrb(opts orbOptions, testOpts orbTestOptions) error {
+	src := opts.args[0]
+	if testOpts.name == "" {
+		testOpts.name = orbProjectName(src)
+	}
+	if testOpts.tests == "" {
+		testOpts.tests = defaultOrbTestsDir(src)
+	}
+	if testOpts.format != orbTestFormatTAP && testOpts.format != orbTestFormatJUnit {
+		return fmt.Errorf("unknown format `%s`, expected %s or %s", testOpts.format, orbTestFormatTAP, orbTestFormatJUnit)
+	}
+
+	compile := compileWithAPI(opts.cfg, testOpts.orgID)
+	results, err := runOrbTests(src, testOpts, compile)
+	if err != nil {
+		return err
+	}
+
+	w := io.Writer(os.Stdout)
+	if testOpts.output != "" {
+		file, err := os.Create(testOpts.output)
+		if err != nil {
+			return errors.Wrap(err, "Unable to write the test results")
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if testOpts.format == orbTestFormatJUnit {
+		err = writeOrbTestJUnit(w, testOpts.name, results)
+	} else {
+		err = writeOrbTestTAP(w, results)
+	}
+	if err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if len(result.failures) > 0 {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d orb tests failed", failed, len(results))
+	}
+	return nil
+}
+
+func compileWithAPI(cfg *settings.Config, orgID string) orbCompileFunc {
+	client := rest.New(cfg.Host, cfg)
+	return func(source string) (string, error) {
+		response, err := config.CompileConfig(client, source, orgID, nil, pipeline.LocalPipelineValues())
+		if err != nil {
+			return "", err
+		}
+		return response.OutputYaml, nil
+	}
+}
+
+// orbProjectName is the name of the orb project: the directory holding
+// the source, unless it is the `src` directory of the project.
+func orbProjectName(src string) string {
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		abs = src
+	}
+	if filepath.Base(abs) == "src" {
+		abs = filepath.Dir(abs)
+	}
+	return filepath.Base(abs)
+}
+
+// defaultOrbTestsDir is the tests directory next to the source, where it
+// isn't packed into the orb.
+func defaultOrbTestsDir(src string) string {
+	abs, err := filepath.Abs(src)
+	if err != nil {
+		abs = src
+	}
+	return filepath.Join(filepath.Dir(abs), "tests")
+}
+
+// runOrbTests packs the orb, then compiles its examples and the fixtures of
+// the tests directory with the packed orb inline.
+func runOrbTests(src string, opts orbTestOptions, compile orbCompileFunc) ([]orbTestResult, error) {
+	packed, err := packOrb(src)
+	if err != nil {
+		return nil, err
+	}
+
+	var orb yaml.Node
+	if err := yaml.Unmarshal([]byte(packed), &orb); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the packed orb")
+	}
+	if len(orb.Content) == 0 {
+		return nil, errors.New("the packed orb is empty")
+	}
+
+	cases := orbExampleCases(orb.Content[0])
+	fixtures, err := orbFixtureCases(opts.tests)
+	if err != nil {
+		return nil, err
+	}
+	cases = append(cases, fixtures...)
+
+	if len(cases) == 0 {
+		return nil, fmt.Errorf("no examples nor tests were found for the orb at %s", src)
+	}
+
+	results := make([]orbTestResult, 0, len(cases))
+	for _, c := range cases {
+		start := time.Now()
+		failures := runOrbTestCase(c, orb.Content[0], opts.name, compile)
+		results = append(results, orbTestResult{
+			name:     c.name,
+			failures: failures,
+			duration: time.Since(start),
+		})
+	}
+	return results, nil
+}
+
+func orbExampleCases(orb *yaml.Node) []orbTestCase {
+	examples := mappingValue(orb, "examples")
+	if examples == nil || examples.Kind != yaml.MappingNode {
+		return nil
+	}
+
+	var cases []orbTestCase
+	for i := 0; i+1 < len(examples.Content); i += 2 {
+		usage := mappingValue(examples.Content[i+1], "usage")
+		if usage == nil {
+			continue
+		}
+		cases = append(cases, orbTestCase{
+			name:   "examples/" + examples.Content[i].Value,
+			config: usage,
+		})
+	}
+	return cases
+}
+
+func orbFixtureCases(dir string) ([]orbTestCase, error) {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	var paths []string
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if ext := filepath.Ext(path); !info.IsDir() && (ext == ".yml" || ext == ".yaml") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read the tests")
+	}
+	sort.Strings(paths)
+
+	cases := make([]orbTestCase, 0, len(paths))
+	for _, path := range paths {
+		raw, err := ioutil.ReadFile(path) // #nosec
+		if err != nil {
+			return nil, errors.Wrap(err, "Unable to read the tests")
+		}
+
+		var fixture orbTestFixture
+		decoder := yaml.NewDecoder(bytes.NewReader(raw))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&fixture); err != nil {
+			return nil, errors.Wrapf(err, "Unable to parse the test %s", path)
+		}
+		if fixture.Config.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("the test %s has no config", path)
+		}
+
+		rel, _ := filepath.Rel(dir, path)
+		cases = append(cases, orbTestCase{
+			name:    "tests/" + strings.TrimSuffix(filepath.ToSlash(rel), filepath.Ext(rel)),
+			config:  &fixture.Config,
+			fixture: &fixture,
+		})
+	}
+	return cases, nil
+}
+
+// runOrbTestCase compiles the config of a test, and returns why it failed.
+func runOrbTestCase(c orbTestCase, orb *yaml.Node, name string, compile orbCompileFunc) []string {
+	source, err := inlineOrbUnderTest(c.config, orb, name)
+	if err != nil {
+		return []string{err.Error()}
+	}
+
+	compiled, err := compile(source)
+	if c.fixture != nil && c.fixture.Error != nil {
+		if err == nil {
+			return []string{fmt.Sprintf("expected the config to fail to compile with `%s`", *c.fixture.Error)}
+		}
+		if !strings.Contains(err.Error(), *c.fixture.Error) {
+			return []string{fmt.Sprintf("expected the config to fail to compile with `%s`, got: %s", *c.fixture.Error, err)}
+		}
+		return nil
+	}
+	if err != nil {
+		return []string{fmt.Sprintf("the config failed to compile: %s", err)}
+	}
+	if c.fixture == nil {
+		return nil
+	}
+
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte(compiled), &doc); err != nil {
+		return []string{fmt.Sprintf("unable to parse the compiled config: %s", err)}
+	}
+
+	var failures []string
+	for _, expectation := range c.fixture.Expect {
+		if failure := expectation.check(doc); failure != "" {
+			failures = append(failures, failure)
+		}
+	}
+	return failures
+}
+
+// inlineOrbUnderTest returns the config with the orb defined inline,
+// replacing the one it imports under the given name, or under any alias of a
+// registry orb of that name. Configs with no orbs get it under the name.
+func inlineOrbUnderTest(configNode, orb *yaml.Node, name string) (string, error) {
+	if configNode.Kind != yaml.MappingNode {
+		return "", errors.New("the config is not a map")
+	}
+
+	// Copies the top-level mapping, as examples share nodes with the orb.
+	root := *configNode
+	root.Content = append([]*yaml.Node(nil), configNode.Content...)
+
+	var orbs *yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "orbs" {
+			continue
+		}
+		orbs = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		if root.Content[i+1].Kind == yaml.MappingNode {
+			orbs.Content = append(orbs.Content, root.Content[i+1].Content...)
+		}
+		root.Content[i+1] = orbs
+	}
+
+	if orbs == nil {
+		orbs = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: "orbs"}, orbs)
+		orbs.Content = append(orbs.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}, orb)
+	} else if !replaceOrbUnderTest(orbs, orb, name) {
+		// The config would otherwise be tested against the published orb.
+		return "", fmt.Errorf("the config does not import the orb as `%s`, nor as `<namespace>/%s`; use --name to set the name it is imported under", name, name)
+	}
+
+	out, err := yaml.Marshal(&root)
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to marshal the config")
+	}
+	return string(out), nil
+}
+
+// replaceOrbUnderTest replaces the orbs imported under the given name, or
+// from the registry under that name, with orb.
+func replaceOrbUnderTest(orbs, orb *yaml.Node, name string) bool {
+	replaced := false
+	for i := 0; i+1 < len(orbs.Content); i += 2 {
+		alias, ref := orbs.Content[i], orbs.Content[i+1]
+		registryName := strings.SplitN(ref.Value, "@", 2)[0]
+		if alias.Value == name || (ref.Kind == yaml.ScalarNode && strings.HasSuffix(registryName, "/"+name)) {
+			orbs.Content[i+1] = orb
+			replaced = true
+		}
+	}
+	return replaced
+}
+
+func (e orbTestExpectation) check(doc interface{}) string {
+	value, found, err := lookupYAMLPath(doc, e.Path)
+	if err != nil {
+		return err.Error()
+	}
+
+	if e.Exists != nil {
+		if found != *e.Exists {
+			if found {
+				return fmt.Sprintf("%s: expected not to exist", e.Path)
+			}
+			return fmt.Sprintf("%s: expected to exist", e.Path)
+		}
+		if !found {
+			return ""
+		}
+	}
+	if !found {
+		return fmt.Sprintf("%s: not found", e.Path)
+	}
+
+	actual := renderYAMLValue(value)
+	if e.Equals != nil && actual != *e.Equals {
+		return fmt.Sprintf("%s: expected %q, got %q", e.Path, *e.Equals, actual)
+	}
+	if e.Contains != nil && !strings.Contains(actual, *e.Contains) {
+		return fmt.Sprintf("%s: expected to contain %q, got %q", e.Path, *e.Contains, actual)
+	}
+	if e.Matches != nil {
+		re, err := regexp.Compile(*e.Matches)
+		if err != nil {
+			return fmt.Sprintf("%s: invalid regular expression %q: %s", e.Path, *e.Matches, err)
+		}
+		if !re.MatchString(actual) {
+			return fmt.Sprintf("%s: expected to match %q, got %q", e.Path, *e.Matches, actual)
+		}
+	}
+	return ""
+}
+
+var yamlPathSegment = regexp.MustCompile(`^([^\[\]]*)((?:\[\d+\])*)$`)
+var yamlPathIndex = regexp.MustCompile(`\[(\d+)\]`)
+
+// lookupYAMLPath returns the value at a path like `jobs.test.steps[3]` of a
+// decoded document, and whether it was found.
+func lookupYAMLPath(doc interface{}, path string) (interface{}, bool, error) {
+	if path == "" {
+		return nil, false, errors.New("an expectation has no path")
+	}
+
+	value := doc
+	for _, segment := range strings.Split(path, ".") {
+		parts := yamlPathSegment.FindStringSubmatch(segment)
+		if parts == nil {
+			return nil, false, fmt.Errorf("invalid path `%s`", path)
+		}
+
+		if parts[1] != "" {
+			m, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+			if value, ok = m[parts[1]]; !ok {
+				return nil, false, nil
+			}
+		}
+
+		for _, index := range yamlPathIndex.FindAllStringSubmatch(parts[2], -1) {
+			list, ok := value.([]interface{})
+			if !ok {
+				return nil, false, nil
+			}
+			i, _ := strconv.Atoi(index[1])
+			if i >= len(list) {
+				return nil, false, nil
+			}
+			value = list[i]
+		}
+	}
+	return value, true, nil
+}
+
+// renderYAMLValue renders scalars as is, and maps and lists as YAML.
+func renderYAMLValue(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return ""
+	case map[string]interface{}, []interface{}:
+		out, err := yaml.Marshal(value)
+		if err != nil {
+			return fmt.Sprint(value)
+		}
+		return strings.TrimSuffix(string(out), "\n")
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// writeOrbTestTAP writes the results in the Test Anything Protocol, with the
+// failures as YAML diagnostics.
+func writeOrbTestTAP(w io.Writer, results []orbTestResult) error {
+	fmt.Fprintf(w, "TAP version 13\n1..%d\n", len(results))
+	for i, result := range results {
+		if len(result.failures) == 0 {
+			fmt.Fprintf(w, "ok %d - %s\n", i+1, result.name)
+			continue
+		}
+
+		fmt.Fprintf(w, "not ok %d - %s\n", i+1, result.name)
+		diagnostics, err := yaml.Marshal(map[string][]string{"failures": result.failures})
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(w, "  ---")
+		for _, line := range strings.Split(strings.TrimSuffix(string(diagnostics), "\n"), "\n") {
+			fmt.Fprintf(w, "  %s\n", line)
+		}
+		fmt.Fprintln(w, "  ...")
+	}
+	return nil
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	Skipped   *struct{}     `xml:"skipped,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeOrbTestJUnit(w io.Writer, name string, results []orbTestResult) error {
+	suite := junitTestSuite{Name: name, Tests: len(results)}
+
+	var total time.Duration
+	for _, result := range results {
+		total += result.duration
+
+		testCase := junitTestCase{
+			Name:      result.name,
+			ClassName: name,
+			Time:      formatSeconds(result.duration),
+		}
+		if len(result.failures) > 0 {
+			suite.Failures++
+			testCase.Failure = &junitFailure{
+				Message: result.failures[0],
+				Text:    strings.Join(result.failures, "\n"),
+			}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = formatSeconds(total)
+
+	out, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s%s\n", xml.Header, out)
+	return err
+}
+
+func formatSeconds(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
@@ -0,0 +1,254 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("Orb test", func() {
+	var (
+		tmp      string
+		project  string
+		compiled []string
+		compile  orbCompileFunc
+	)
+
+	write := func(name, contents string) {
+		path := filepath.Join(project, name)
+		Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(path, []byte(contents), 0600)).To(Succeed())
+	}
+
+	BeforeEach(func() {
+		var err error
+		tmp, err = ioutil.TempDir("", "circleci-orb-test")
+		Expect(err).ShouldNot(HaveOccurred())
+		project = filepath.Join(tmp, "test")
+
+		write("src/@orb.yml", "version: 2.1\ndescription: An orb\n")
+		write("src/jobs/test.yml", `description: Runs the tests
+parameters:
+  command:
+    type: string
+docker:
+  - image: cimg/base:stable
+steps:
+  - run: <<include(scripts/test.sh)>>
+`)
+		write("src/scripts/test.sh", "make test\n")
+		write("src/examples/simple.yml", `description: Runs the tests
+usage:
+  version: 2.1
+  orbs:
+    test: my-ns/test@1.0.0
+  workflows:
+    main:
+      jobs:
+        - test/test
+`)
+
+		// Compiling is left to the API, here the config is returned as is.
+		compiled = nil
+		compile = func(source string) (string, error) {
+			compiled = append(compiled, source)
+			return source, nil
+		}
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(tmp)).To(Succeed())
+	})
+
+	run := func() []orbTestResult {
+		src := filepath.Join(project, "src")
+		results, err := runOrbTests(src, orbTestOptions{
+			name:  orbProjectName(src),
+			tests: defaultOrbTestsDir(src),
+		}, compile)
+		Expect(err).ShouldNot(HaveOccurred())
+		return results
+	}
+
+	It("compiles the examples with the packed orb inline", func() {
+		project = filepath.Join(tmp, "my-orb")
+		write("src/@orb.yml", "version: 2.1\ndescription: An orb\n")
+		write("src/jobs/test.yml", "steps:\n  - run: <<include(scripts/test.sh)>>\n")
+		write("src/scripts/test.sh", "make test\n")
+		write("src/examples/simple.yml", "usage:\n  version: 2.1\n  orbs:\n    my-orb: my-ns/my-orb@1.0.0\n    node: circleci/node@5.0.0\n")
+
+		results := run()
+		Expect(results).To(HaveLen(1))
+		Expect(results[0].name).To(Equal("examples/simple"))
+		Expect(results[0].failures).To(BeEmpty())
+
+		var config map[string]interface{}
+		Expect(yaml.Unmarshal([]byte(compiled[0]), &config)).To(Succeed())
+		orbs := config["orbs"].(map[string]interface{})
+		Expect(orbs["node"]).To(Equal("circleci/node@5.0.0"))
+		value, found, err := lookupYAMLPath(orbs, "my-orb.jobs.test.steps[0].run")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(value).To(Equal("make test\n"))
+	})
+
+	It("checks the expectations of the tests", func() {
+		write("tests/job.yml", `description: The job runs the script
+config:
+  version: 2.1
+  workflows:
+    main:
+      jobs:
+        - test/test
+expect:
+  - path: orbs.test.jobs.test.steps[0].run
+    contains: make test
+  - path: orbs.test.jobs.test.docker[0].image
+    matches: ^cimg/
+  - path: orbs.test.jobs.test.resource_class
+    exists: false
+  - path: workflows.main.jobs[0]
+    equals: other/test
+`)
+		write("tests/nested/error.yml", `config:
+  version: 2.1
+error: Missing required argument
+`)
+
+		compile = func(source string) (string, error) {
+			if len(compiled) == 2 {
+				return "", errors.New("config compilation contains errors: Missing required argument command")
+			}
+			compiled = append(compiled, source)
+			return source, nil
+		}
+
+		results := run()
+		Expect(results).To(HaveLen(3))
+		Expect(results[1].name).To(Equal("tests/job"))
+		Expect(results[1].failures).To(Equal([]string{
+			`workflows.main.jobs[0]: expected "other/test", got "test/test"`,
+		}))
+		Expect(results[2].name).To(Equal("tests/nested/error"))
+		Expect(results[2].failures).To(BeEmpty())
+	})
+
+	It("fails the tests whose config does not compile", func() {
+		compile = func(source string) (string, error) {
+			return "", errors.New("config compilation contains errors: Missing required argument command")
+		}
+
+		results := run()
+		Expect(results[0].failures).To(Equal([]string{
+			"the config failed to compile: config compilation contains errors: Missing required argument command",
+		}))
+	})
+
+	It("replaces the orb imported from the registry under another alias", func() {
+		write("src/examples/simple.yml", "usage:\n  version: 2.1\n  orbs:\n    tester: my-ns/test@1.0.0\n")
+
+		results := run()
+		Expect(results[0].failures).To(BeEmpty())
+
+		var config map[string]interface{}
+		Expect(yaml.Unmarshal([]byte(compiled[0]), &config)).To(Succeed())
+		value, found, err := lookupYAMLPath(config, "orbs.tester.jobs.test.steps[0].run")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(value).To(Equal("make test\n"))
+	})
+
+	It("fails the tests that don't import the orb", func() {
+		write("src/examples/simple.yml", "usage:\n  version: 2.1\n  orbs:\n    node: circleci/node@5.0.0\n")
+
+		results := run()
+		Expect(compiled).To(BeEmpty())
+		Expect(results[0].failures).To(Equal([]string{
+			"the config does not import the orb as `test`, nor as `<namespace>/test`; use --name to set the name it is imported under",
+		}))
+	})
+
+	It("rejects tests with unknown keys", func() {
+		write("tests/typo.yml", "config:\n  version: 2.1\nexpects: []\n")
+
+		src := filepath.Join(project, "src")
+		_, err := runOrbTests(src, orbTestOptions{name: "test", tests: defaultOrbTestsDir(src)}, compile)
+		Expect(err).To(MatchError(ContainSubstring("field expects not found")))
+	})
+
+	Describe("paths", func() {
+		var doc interface{}
+
+		BeforeEach(func() {
+			Expect(yaml.Unmarshal([]byte(`jobs:
+  test:
+    steps:
+      - checkout
+      - run:
+          command: make
+    matrix: [[1, 2]]
+`), &doc)).To(Succeed())
+		})
+
+		It("looks up keys and indexes", func() {
+			value, found, err := lookupYAMLPath(doc, "jobs.test.steps[1].run.command")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(found).To(BeTrue())
+			Expect(value).To(Equal("make"))
+
+			value, found, _ = lookupYAMLPath(doc, "jobs.test.matrix[0][1]")
+			Expect(found).To(BeTrue())
+			Expect(value).To(Equal(2))
+		})
+
+		It("reports missing values", func() {
+			_, found, err := lookupYAMLPath(doc, "jobs.test.steps[2]")
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(found).To(BeFalse())
+
+			_, found, _ = lookupYAMLPath(doc, "jobs.build.steps")
+			Expect(found).To(BeFalse())
+		})
+
+		It("rejects invalid paths", func() {
+			_, _, err := lookupYAMLPath(doc, "jobs.test.steps[one]")
+			Expect(err).To(MatchError("invalid path `jobs.test.steps[one]`"))
+		})
+	})
+
+	Describe("results", func() {
+		results := []orbTestResult{
+			{name: "examples/simple", duration: 1500 * time.Millisecond},
+			{name: "tests/job", failures: []string{"jobs.test: not found"}},
+		}
+
+		It("writes TAP", func() {
+			var out bytes.Buffer
+			Expect(writeOrbTestTAP(&out, results)).To(Succeed())
+			Expect(out.String()).To(Equal(`TAP version 13
+1..2
+ok 1 - examples/simple
+not ok 2 - tests/job
+  ---
+  failures:
+      - 'jobs.test: not found'
+  ...
+`))
+		})
+
+		It("writes JUnit", func() {
+			var out bytes.Buffer
+			Expect(writeOrbTestJUnit(&out, "my-orb", results)).To(Succeed())
+			Expect(out.String()).To(ContainSubstring(`<testsuite name="my-orb" tests="2" failures="1" time="1.500">`))
+			Expect(out.String()).To(ContainSubstring(`<testcase name="examples/simple" classname="my-orb" time="1.500"></testcase>`))
+			Expect(out.String()).To(ContainSubstring(`<failure message="jobs.test: not found">jobs.test: not found</failure>`))
+		})
+	})
+})
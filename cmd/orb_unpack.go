@@ -0,0 +1,170 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// unescapedInclude matches a << that packing would escape when including
+// a script, and so cannot be moved out to one.
+var unescapedInclude = regexp.MustCompile(`(^|[^\\])<<`)
+
+func unpackOrbCommand(opts orbOptions) error {
+	source, err := loadOrbSource(opts, opts.args[0])
+	if err != nil {
+		return err
+	}
+
+	dir := opts.args[1]
+	entries, err := ioutil.ReadDir(dir)
+	if err == nil && len(entries) > 0 {
+		return fmt.Errorf("the directory %s is not empty", dir)
+	}
+
+	files, err := unpackOrb(source)
+	if err != nil {
+		return err
+	}
+
+	for _, name := range sortedFileNames(files) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return errors.Wrapf(err, "Unable to create the directory for %s", path)
+		}
+		if err := ioutil.WriteFile(path, files[name], 0644); err != nil {
+			return errors.Wrapf(err, "Unable to write %s", path)
+		}
+	}
+
+	fmt.Printf("The orb was unpacked to %s, pack it again with `circleci orb pack %s`.\n", dir, dir)
+	return nil
+}
+
+// unpackOrb splits the source of an orb into the files of a source tree, by
+// their slash-separated path: @orb.yml, a file per command, job, executor and
+// example, and the scripts of the long run steps.
+func unpackOrb(source string) (map[string][]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(source), &doc); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the orb")
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, errors.New("The orb is not a YAML mapping")
+	}
+	root := doc.Content[0]
+
+	files := map[string][]byte{}
+	scripts := map[string]bool{}
+	orb := &yaml.Node{Kind: yaml.MappingNode}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		if !isOrbElementKind(key.Value) {
+			orb.Content = append(orb.Content, key, value)
+			continue
+		}
+		if value.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("`%s` is not a mapping", key.Value)
+		}
+
+		for j := 0; j+1 < len(value.Content); j += 2 {
+			name, element := value.Content[j].Value, value.Content[j+1]
+			if key.Value == "commands" || key.Value == "jobs" {
+				extractScripts(element, name, scripts, files)
+			}
+
+			out, err := encodeOrbFile(element)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Unable to write %s/%s", key.Value, name)
+			}
+			files[key.Value+"/"+name+".yml"] = out
+		}
+	}
+
+	out, err := encodeOrbFile(orb)
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to write @orb.yml")
+	}
+	files["@orb.yml"] = out
+
+	return files, nil
+}
+
+// isOrbElementKind tells the top-level keys of an orb unpacked to a file per
+// element.
+func isOrbElementKind(key string) bool {
+	for _, kind := range orbElementKinds {
+		if key == kind {
+			return true
+		}
+	}
+	return key == "examples"
+}
+
+// extractScripts moves the long commands of the run steps of an element to
+// scripts, replacing them with <<include()>>. Commands using parameters stay
+// inline, since packing escapes the << of included scripts.
+func extractScripts(element *yaml.Node, name string, scripts map[string]bool, files map[string][]byte) {
+	steps := mappingValue(element, "steps")
+	if steps == nil || steps.Kind != yaml.SequenceNode {
+		return
+	}
+
+	for _, step := range steps.Content {
+		run := mappingValue(step, "run")
+		if run != nil && run.Kind == yaml.MappingNode {
+			run = mappingValue(run, "command")
+		}
+		if run == nil || run.Kind != yaml.ScalarNode {
+			continue
+		}
+
+		command := run.Value
+		if len(strings.TrimSpace(command)) <= orbLintMaxScriptLength ||
+			includeStatement.MatchString(strings.TrimSpace(command)) ||
+			unescapedInclude.MatchString(command) {
+			continue
+		}
+
+		script := "scripts/" + name + ".sh"
+		for i := 2; scripts[script]; i++ {
+			script = fmt.Sprintf("scripts/%s-%d.sh", name, i)
+		}
+		scripts[script] = true
+
+		files[script] = []byte(strings.ReplaceAll(command, `\<<`, "<<"))
+		run.Value = "<<include(" + script + ")>>"
+		run.Style = 0
+	}
+}
+
+func encodeOrbFile(node *yaml.Node) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func sortedFileNames(m map[string][]byte) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,113 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("Orb unpack", func() {
+	const source = `version: 2.1
+description: Tools for testing
+display:
+  source_url: https://github.com/example/my-orb
+commands:
+  install:
+    description: Installs the tools
+    parameters:
+      version:
+        type: string
+        default: "1.0"
+    steps:
+      - run:
+          name: Install
+          command: |
+            curl -fsSL https://example.com/install.sh -o install.sh
+            sh install.sh --prefix \<< prefix >>
+      - run: echo "installing << parameters.version >> of the tools from https://example.com/tools"
+jobs:
+  install:
+    docker:
+      - image: cimg/base:stable
+    steps:
+      - run: curl -fsSL https://example.com/check.sh | sh -s -- --verbose --strict --all
+      - run: make
+examples:
+  install-tools:
+    description: Installs the tools
+    usage:
+      version: 2.1
+      orbs:
+        my-orb: example/my-orb@1.0.0
+      workflows:
+        main:
+          jobs:
+            - my-orb/install
+`
+
+	var (
+		dir   string
+		files map[string][]byte
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "circleci-orb-unpack")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		files, err = unpackOrb(source)
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("writes a file per element", func() {
+		Expect(sortedFileNames(files)).To(Equal([]string{
+			"@orb.yml",
+			"commands/install.yml",
+			"examples/install-tools.yml",
+			"jobs/install.yml",
+			"scripts/install-2.sh",
+			"scripts/install.sh",
+		}))
+		Expect(string(files["@orb.yml"])).To(Equal("version: 2.1\ndescription: Tools for testing\ndisplay:\n  source_url: https://github.com/example/my-orb\n"))
+	})
+
+	It("moves long commands without parameters to scripts", func() {
+		Expect(string(files["scripts/install.sh"])).To(Equal("curl -fsSL https://example.com/install.sh -o install.sh\nsh install.sh --prefix << prefix >>\n"))
+		Expect(string(files["commands/install.yml"])).To(ContainSubstring("command: <<include(scripts/install.sh)>>\n"))
+		Expect(string(files["commands/install.yml"])).To(ContainSubstring(`echo "installing << parameters.version >>`))
+
+		Expect(string(files["scripts/install-2.sh"])).To(Equal("curl -fsSL https://example.com/check.sh | sh -s -- --verbose --strict --all"))
+		Expect(string(files["jobs/install.yml"])).To(ContainSubstring("- run: <<include(scripts/install-2.sh)>>\n"))
+	})
+
+	It("packs back to the same orb", func() {
+		for name, contents := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			Expect(os.MkdirAll(filepath.Dir(path), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(path, contents, 0600)).To(Succeed())
+		}
+
+		packed, err := packOrb(dir)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		// Packing quotes the version of examples, so compare with the orb
+		// as packing writes it.
+		var schema OrbSchema
+		Expect(yaml.Unmarshal([]byte(source), &schema)).To(Succeed())
+		normalized, err := yaml.Marshal(&schema)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		var before, after interface{}
+		Expect(yaml.Unmarshal(normalized, &before)).To(Succeed())
+		Expect(yaml.Unmarshal([]byte(packed), &after)).To(Succeed())
+		Expect(after).To(Equal(before))
+	})
+})
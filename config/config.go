@@ -34,8 +34,9 @@ type Options struct {
 	PipelineValues     map[string]string `json:"pipeline_values,omitempty"`
 }
 
+// LoadYaml reads the config file at path, or stdin when path is "-".
 // #nosec
-func loadYaml(path string) (string, error) {
+func LoadYaml(path string) (string, error) {
 	var err error
 	var config []byte
 	if path == "-" {
@@ -62,11 +63,22 @@ func ConfigQuery(
 	values pipeline.Values,
 ) (*ConfigResponse, error) {
 
-	configString, err := loadYaml(configPath)
+	configString, err := LoadYaml(configPath)
 	if err != nil {
 		return nil, err
 	}
 
+	return CompileConfig(rest, configString, orgID, params, values)
+}
+
+// CompileConfig - like ConfigQuery, for a config already in memory.
+func CompileConfig(
+	rest *rest.Client,
+	configString string,
+	orgID string,
+	params pipeline.Parameters,
+	values pipeline.Values,
+) (*ConfigResponse, error) {
 	compileRequest := CompileConfigRequest{
 		ConfigYaml: configString,
 		Options: Options{
@@ -0,0 +1,511 @@
+// Package convert translates the pipeline definitions of other CI systems
+// into CircleCI 2.1 configs.
+//
+// The translation is a first pass: anything without a direct equivalent is
+// carried over as a `TODO` comment next to the closest matching part of the
+// generated config, and listed in Result.TODOs.
+package convert
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats that can be converted.
+const (
+	GitHubActions = "github-actions"
+	GitLabCI      = "gitlab-ci"
+)
+
+// Formats lists the names accepted by Convert.
+var Formats = []string{GitHubActions, GitLabCI}
+
+// Result is a converted config.
+type Result struct {
+	Config string
+	// TODOs lists everything that could not be translated, in the order it
+	// appears in Config.
+	TODOs []string
+}
+
+// Convert translates the pipeline in src, written in the given format.
+func Convert(format string, src []byte) (*Result, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(src, &doc); err != nil {
+		return nil, fmt.Errorf("unable to parse %s pipeline: %s", format, err.Error())
+	}
+
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("expected the %s pipeline to be a map", format)
+	}
+
+	expandMergeKeys(doc.Content[0])
+	c := &converter{reported: map[string]bool{}}
+
+	var cfg *config
+	var err error
+	switch format {
+	case GitHubActions:
+		cfg, err = c.fromGitHubActions(doc.Content[0])
+	case GitLabCI:
+		cfg, err = c.fromGitLabCI(doc.Content[0])
+	default:
+		return nil, fmt.Errorf("unknown format `%s`, expected one of: %s", format, strings.Join(Formats, ", "))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(cfg.render()); err != nil {
+		return nil, err
+	}
+
+	return &Result{Config: out.String(), TODOs: c.todos}, nil
+}
+
+// converter carries the state shared by both translations.
+type converter struct {
+	todos []string
+	// reported records the secrets and variables already reported, so that
+	// each is only listed once.
+	reported map[string]bool
+}
+
+// todo attaches a TODO comment to node and records it.
+func (c *converter) todo(node *yaml.Node, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	c.todos = append(c.todos, message)
+
+	comment := "TODO: " + message
+	if node.HeadComment != "" {
+		comment = node.HeadComment + "\n" + comment
+	}
+	node.HeadComment = comment
+}
+
+// config is the CircleCI config being built.
+type config struct {
+	executors []executor
+	jobs      []*job
+	workflows []*workflow
+	// comment is placed at the top of the generated config.
+	comment *yaml.Node
+}
+
+type executor struct {
+	name string
+	node *yaml.Node
+}
+
+type job struct {
+	name             string
+	executor         string
+	parameters       []string
+	parallelism      int
+	workingDirectory string
+	environment      []keyValue
+	steps            []*yaml.Node
+	// comment holds the TODOs about the job as a whole.
+	comment *yaml.Node
+}
+
+type workflow struct {
+	name string
+	jobs []*workflowJob
+}
+
+type workflowJob struct {
+	name     string
+	approval bool
+	requires []string
+	matrix   []matrixParameter
+	exclude  []map[string]string
+	branches []string
+	ignore   []string
+	comment  *yaml.Node
+}
+
+type matrixParameter struct {
+	name   string
+	values []string
+}
+
+type keyValue struct {
+	key, value string
+}
+
+// addExecutor registers an executor and returns its name, reusing an
+// identical one when it already exists.
+func (cfg *config) addExecutor(name string, node *yaml.Node) string {
+	rendered, _ := yaml.Marshal(node)
+	for _, e := range cfg.executors {
+		existing, _ := yaml.Marshal(e.node)
+		if string(existing) == string(rendered) {
+			return e.name
+		}
+	}
+
+	unique := name
+	for i := 2; cfg.hasExecutor(unique); i++ {
+		unique = fmt.Sprintf("%s-%d", name, i)
+	}
+
+	cfg.executors = append(cfg.executors, executor{name: unique, node: node})
+	return unique
+}
+
+func (cfg *config) hasExecutor(name string) bool {
+	for _, e := range cfg.executors {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (cfg *config) render() *yaml.Node {
+	root := mapping()
+	if cfg.comment != nil {
+		root.HeadComment = cfg.comment.HeadComment
+	}
+	set(root, "version", "2.1")
+	root.Content[1].Tag = "!!float"
+
+	if len(cfg.executors) > 0 {
+		executors := mapping()
+		for _, e := range cfg.executors {
+			set(executors, e.name, e.node)
+		}
+		set(root, "executors", executors)
+	}
+
+	jobs := mapping()
+	for _, j := range cfg.jobs {
+		set(jobs, j.name, j.render())
+		if j.comment != nil {
+			jobs.Content[len(jobs.Content)-2].HeadComment = j.comment.HeadComment
+		}
+	}
+	set(root, "jobs", jobs)
+
+	workflows := mapping()
+	for _, w := range cfg.workflows {
+		list := sequence()
+		for _, wj := range w.jobs {
+			list.Content = append(list.Content, wj.render())
+		}
+		set(workflows, w.name, mapping("jobs", list))
+	}
+	set(root, "workflows", workflows)
+
+	return root
+}
+
+func (j *job) render() *yaml.Node {
+	node := mapping()
+
+	if len(j.parameters) > 0 {
+		parameters := mapping()
+		for _, p := range j.parameters {
+			set(parameters, p, mapping("type", "string"))
+		}
+		set(node, "parameters", parameters)
+	}
+
+	set(node, "executor", j.executor)
+
+	if j.parallelism > 1 {
+		set(node, "parallelism", fmt.Sprint(j.parallelism))
+		node.Content[len(node.Content)-1].Tag = "!!int"
+	}
+
+	if j.workingDirectory != "" {
+		set(node, "working_directory", j.workingDirectory)
+	}
+
+	if len(j.environment) > 0 {
+		set(node, "environment", environment(j.environment))
+	}
+
+	steps := sequence()
+	steps.Content = j.steps
+	set(node, "steps", steps)
+
+	return node
+}
+
+func (wj *workflowJob) render() *yaml.Node {
+	options := mapping()
+
+	if wj.approval {
+		set(options, "type", "approval")
+	}
+
+	if len(wj.requires) > 0 {
+		set(options, "requires", wj.requires)
+	}
+
+	if len(wj.matrix) > 0 {
+		parameters := mapping()
+		for _, p := range wj.matrix {
+			set(parameters, p.name, p.values)
+		}
+		matrix := mapping("parameters", parameters)
+
+		if len(wj.exclude) > 0 {
+			exclude := sequence()
+			for _, e := range wj.exclude {
+				exclude.Content = append(exclude.Content, stringMap(e))
+			}
+			set(matrix, "exclude", exclude)
+		}
+		set(options, "matrix", matrix)
+	}
+
+	if len(wj.branches) > 0 || len(wj.ignore) > 0 {
+		branches := mapping()
+		if len(wj.branches) > 0 {
+			set(branches, "only", wj.branches)
+		}
+		if len(wj.ignore) > 0 {
+			set(branches, "ignore", wj.ignore)
+		}
+		set(options, "filters", mapping("branches", branches))
+	}
+
+	var node *yaml.Node
+	if len(options.Content) == 0 {
+		node = scalar(wj.name)
+	} else {
+		node = mapping(wj.name, options)
+	}
+
+	if wj.comment != nil {
+		node.HeadComment = wj.comment.HeadComment
+	}
+
+	return node
+}
+
+// mapping builds a mapping node from alternating keys and values.
+// Values may be nodes, strings or string slices.
+func mapping(pairs ...interface{}) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		set(node, pairs[i].(string), pairs[i+1])
+	}
+	return node
+}
+
+func sequence(items ...*yaml.Node) *yaml.Node {
+	return &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq", Content: items}
+}
+
+var yaml11Booleans = regexp.MustCompile(`^(?i:y|yes|n|no|on|off)$`)
+
+func scalar(value string) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+	switch {
+	case strings.Contains(value, "\n"):
+		node.Style = yaml.LiteralStyle
+	case yaml11Booleans.MatchString(value):
+		// Quoted so that YAML 1.1 parsers don't read them as booleans
+		node.Style = yaml.DoubleQuotedStyle
+	}
+	return node
+}
+
+func set(node *yaml.Node, key string, value interface{}) {
+	var v *yaml.Node
+	switch value := value.(type) {
+	case *yaml.Node:
+		v = value
+	case string:
+		v = scalar(value)
+	case []string:
+		v = sequence()
+		for _, s := range value {
+			v.Content = append(v.Content, scalar(s))
+		}
+	default:
+		panic(fmt.Sprintf("unsupported value %T", value))
+	}
+
+	node.Content = append(node.Content, scalar(key), v)
+}
+
+func environment(values []keyValue) *yaml.Node {
+	node := mapping()
+	for _, kv := range values {
+		set(node, kv.key, kv.value)
+	}
+	return node
+}
+
+func stringMap(m map[string]string) *yaml.Node {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	node := mapping()
+	for _, k := range keys {
+		set(node, k, m[k])
+	}
+	return node
+}
+
+// runStep builds a `run` step. The name is left out when empty.
+func runStep(name, command string) *yaml.Node {
+	run := mapping()
+	if name != "" {
+		set(run, "name", name)
+	}
+	set(run, "command", command)
+	return mapping("run", run)
+}
+
+// todoStep is a placeholder for a step that could not be translated, so that
+// it keeps its place in the job.
+func todoStep(name string) *yaml.Node {
+	return runStep(name, fmt.Sprintf("echo %q && exit 1", "TODO: "+name))
+}
+
+// Helpers for reading the source pipelines, which are kept as nodes so that
+// jobs and steps retain their order.
+
+func lookup(node *yaml.Node, key string) *yaml.Node {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return resolve(node.Content[i+1])
+		}
+	}
+	return nil
+}
+
+func resolve(node *yaml.Node) *yaml.Node {
+	if node != nil && node.Kind == yaml.AliasNode {
+		return node.Alias
+	}
+	return node
+}
+
+func str(node *yaml.Node) string {
+	if node == nil || node.Kind != yaml.ScalarNode {
+		return ""
+	}
+	return node.Value
+}
+
+// strs reads a scalar or a sequence of scalars, flattening nested sequences
+// as produced by YAML anchors in scripts.
+func strs(node *yaml.Node) []string {
+	node = resolve(node)
+	if node == nil {
+		return nil
+	}
+
+	switch node.Kind {
+	case yaml.ScalarNode:
+		return []string{node.Value}
+	case yaml.SequenceNode:
+		var out []string
+		for _, item := range node.Content {
+			out = append(out, strs(item)...)
+		}
+		return out
+	}
+
+	return nil
+}
+
+// expandMergeKeys replaces YAML merge keys (`<<: *anchor`) with the entries
+// they stand for, as the decoder only does that when decoding into Go values.
+func expandMergeKeys(node *yaml.Node) {
+	node = resolve(node)
+	if node == nil {
+		return
+	}
+
+	for _, child := range node.Content {
+		if child.Kind != yaml.AliasNode {
+			expandMergeKeys(child)
+		}
+	}
+
+	if node.Kind != yaml.MappingNode {
+		return
+	}
+
+	var content, merged []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], resolve(node.Content[i+1])
+		if key.Tag != "!!merge" {
+			content = append(content, key, node.Content[i+1])
+			continue
+		}
+
+		sources := []*yaml.Node{value}
+		if value.Kind == yaml.SequenceNode {
+			sources = value.Content
+		}
+		for _, source := range sources {
+			source = resolve(source)
+			expandMergeKeys(source)
+			if source.Kind == yaml.MappingNode {
+				merged = append(merged, source.Content...)
+			}
+		}
+	}
+
+	// Explicit keys take precedence over merged ones.
+	for i := 0; i+1 < len(merged); i += 2 {
+		if lookup(&yaml.Node{Kind: yaml.MappingNode, Content: content}, merged[i].Value) == nil {
+			content = append(content, merged[i], merged[i+1])
+		}
+	}
+
+	node.Content = content
+}
+
+// pairs iterates over the keys and values of a mapping node, in order.
+func pairs(node *yaml.Node, fn func(key string, value *yaml.Node)) {
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		fn(node.Content[i].Value, resolve(node.Content[i+1]))
+	}
+}
+
+// keyValues reads a mapping of scalars, such as an env section.
+func keyValues(node *yaml.Node) []keyValue {
+	var out []keyValue
+	pairs(node, func(key string, value *yaml.Node) {
+		out = append(out, keyValue{key, str(value)})
+	})
+	return out
+}
+
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]+`)
+
+// sanitizeName turns an arbitrary name into a valid job or executor name.
+func sanitizeName(name string) string {
+	name = strings.Trim(invalidNameChars.ReplaceAllString(name, "-"), "-")
+	if name == "" {
+		return "job"
+	}
+	return name
+}
@@ -0,0 +1,506 @@
+package convert
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var githubExpression = regexp.MustCompile(`\$\{\{\s*(.*?)\s*\}\}`)
+
+// githubContexts maps the GitHub context values that have a CircleCI
+// counterpart to the equivalent built-in environment variable.
+var githubContexts = map[string]string{
+	"github.sha":              "${CIRCLE_SHA1}",
+	"github.ref_name":         "${CIRCLE_BRANCH}",
+	"github.head_ref":         "${CIRCLE_BRANCH}",
+	"github.run_number":       "${CIRCLE_BUILD_NUM}",
+	"github.run_id":           "${CIRCLE_WORKFLOW_ID}",
+	"github.workspace":        "${CIRCLE_WORKING_DIRECTORY}",
+	"github.repository":       "${CIRCLE_PROJECT_USERNAME}/${CIRCLE_PROJECT_REPONAME}",
+	"github.repository_owner": "${CIRCLE_PROJECT_USERNAME}",
+	"github.job":              "${CIRCLE_JOB}",
+	"github.actor":            "${CIRCLE_USERNAME}",
+	"runner.temp":             "/tmp",
+}
+
+// githubCacheKeys maps GitHub context values used in cache keys to the
+// CircleCI cache key template equivalent.
+var githubCacheKeys = map[string]string{
+	"runner.os":       "{{ arch }}",
+	"github.sha":      "{{ .Revision }}",
+	"github.ref_name": "{{ .Branch }}",
+	"github.head_ref": "{{ .Branch }}",
+}
+
+var hashFilesCall = regexp.MustCompile(`^hashFiles\(\s*'([^']+)'\s*\)$`)
+
+// githubTranslator rewrites `${{ }}` expressions for one job, collecting the
+// ones it can't translate until they can be attached to a node.
+type githubTranslator struct {
+	c       *converter
+	params  map[string]string
+	pending []string
+}
+
+func (t *githubTranslator) expressions(s string) string {
+	return githubExpression.ReplaceAllStringFunc(s, func(match string) string {
+		expr := githubExpression.FindStringSubmatch(match)[1]
+
+		if translated, ok := githubContexts[expr]; ok {
+			return translated
+		}
+
+		switch {
+		case strings.HasPrefix(expr, "matrix."):
+			if param, ok := t.params[strings.TrimPrefix(expr, "matrix.")]; ok {
+				return fmt.Sprintf("<< parameters.%s >>", param)
+			}
+		case strings.HasPrefix(expr, "env."):
+			return fmt.Sprintf("${%s}", strings.TrimPrefix(expr, "env."))
+		case strings.HasPrefix(expr, "secrets."):
+			name := strings.TrimPrefix(expr, "secrets.")
+			if !t.c.reported["secret:"+name] {
+				t.c.reported["secret:"+name] = true
+				t.pending = append(t.pending, fmt.Sprintf("store the secret `%s` in a context or as a project environment variable", name))
+			}
+			return fmt.Sprintf("${%s}", name)
+		}
+
+		t.pending = append(t.pending, fmt.Sprintf("translate the expression `%s`", match))
+		return match
+	})
+}
+
+func (t *githubTranslator) cacheKey(s string) string {
+	return githubExpression.ReplaceAllStringFunc(s, func(match string) string {
+		expr := githubExpression.FindStringSubmatch(match)[1]
+
+		if translated, ok := githubCacheKeys[expr]; ok {
+			return translated
+		}
+
+		if call := hashFilesCall.FindStringSubmatch(expr); call != nil && !strings.ContainsAny(call[1], "*?[") {
+			return fmt.Sprintf(`{{ checksum "%s" }}`, call[1])
+		}
+
+		if strings.HasPrefix(expr, "env.") {
+			return fmt.Sprintf("{{ .Environment.%s }}", strings.TrimPrefix(expr, "env."))
+		}
+
+		if param, ok := t.params[strings.TrimPrefix(expr, "matrix.")]; ok && strings.HasPrefix(expr, "matrix.") {
+			return fmt.Sprintf("<< parameters.%s >>", param)
+		}
+
+		t.pending = append(t.pending, fmt.Sprintf("translate the cache key expression `%s`; checksum only accepts a single file", match))
+		return match
+	})
+}
+
+// attach moves the pending TODOs onto node.
+func (t *githubTranslator) attach(node *yaml.Node) {
+	for _, message := range t.pending {
+		t.c.todo(node, "%s", message)
+	}
+	t.pending = nil
+}
+
+func (c *converter) fromGitHubActions(root *yaml.Node) (*config, error) {
+	jobs := lookup(root, "jobs")
+	if jobs == nil || jobs.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("no jobs found in the GitHub Actions workflow")
+	}
+
+	cfg := &config{comment: &yaml.Node{}}
+
+	name := "main"
+	if n := str(lookup(root, "name")); n != "" {
+		name = sanitizeName(strings.ToLower(n))
+	}
+	wf := &workflow{name: name}
+	cfg.workflows = append(cfg.workflows, wf)
+
+	branches := c.githubTriggers(cfg.comment, lookup(root, "on"))
+
+	global := &githubTranslator{c: c}
+	globalEnv := keyValues(lookup(root, "env"))
+	for i := range globalEnv {
+		globalEnv[i].value = global.expressions(globalEnv[i].value)
+	}
+	global.attach(cfg.comment)
+
+	defaults := lookup(lookup(root, "defaults"), "run")
+
+	var err error
+	pairs(jobs, func(id string, node *yaml.Node) {
+		if err != nil {
+			return
+		}
+		err = c.githubJob(cfg, wf, id, node, globalEnv, defaults, branches)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// githubTriggers returns the branches that pushes are filtered on, and
+// reports the triggers that have no equivalent.
+func (c *converter) githubTriggers(comment *yaml.Node, on *yaml.Node) []string {
+	var branches []string
+	if on == nil {
+		return nil
+	}
+
+	switch on.Kind {
+	case yaml.ScalarNode, yaml.SequenceNode:
+		for _, event := range strs(on) {
+			if event != "push" {
+				c.todo(comment, "the workflow was triggered on `%s`; configure the equivalent trigger in the project settings", event)
+			}
+		}
+	case yaml.MappingNode:
+		pairs(on, func(event string, options *yaml.Node) {
+			switch event {
+			case "push":
+				for _, branch := range strs(lookup(options, "branches")) {
+					if strings.ContainsAny(branch, "*?[!") {
+						c.todo(comment, "translate the branch pattern `%s` into a regular expression filter", branch)
+						continue
+					}
+					branches = append(branches, branch)
+				}
+			case "schedule":
+				for _, cron := range options.Content {
+					c.todo(comment, "create a scheduled pipeline for the cron expression `%s`", str(lookup(cron, "cron")))
+				}
+			default:
+				c.todo(comment, "the workflow was triggered on `%s`; configure the equivalent trigger in the project settings", event)
+			}
+		})
+	}
+
+	return branches
+}
+
+func (c *converter) githubJob(cfg *config, wf *workflow, id string, node *yaml.Node, globalEnv []keyValue, defaults *yaml.Node, branches []string) error {
+	j := &job{name: sanitizeName(id), comment: &yaml.Node{}}
+	wj := &workflowJob{name: j.name, branches: branches, comment: &yaml.Node{}}
+	t := &githubTranslator{c: c, params: map[string]string{}}
+
+	for _, need := range strs(lookup(node, "needs")) {
+		wj.requires = append(wj.requires, sanitizeName(need))
+	}
+
+	if uses := str(lookup(node, "uses")); uses != "" {
+		c.todo(j.comment, "the reusable workflow `%s` can't be called from CircleCI; inline its jobs or turn it into an orb", uses)
+		j.executor = cfg.addExecutor("ubuntu", mapping("machine", mapping("image", "ubuntu-2204:current")))
+		j.steps = append(j.steps, todoStep("call "+uses))
+		cfg.jobs = append(cfg.jobs, j)
+		wf.jobs = append(wf.jobs, wj)
+		return nil
+	}
+
+	c.githubMatrix(j, wj, lookup(lookup(node, "strategy"), "matrix"), t)
+
+	if cond := str(lookup(node, "if")); cond != "" {
+		c.todo(wj.comment, "the job only ran `if: %s`; use filters or a `when` clause", cond)
+	}
+
+	for _, key := range []string{"timeout-minutes", "continue-on-error", "outputs", "concurrency", "environment", "permissions"} {
+		if lookup(node, key) != nil {
+			c.todo(j.comment, "`%s` has no direct equivalent", key)
+		}
+	}
+
+	j.executor = c.githubExecutor(cfg, j, node, t)
+
+	j.environment = append(j.environment, globalEnv...)
+	for _, kv := range keyValues(lookup(node, "env")) {
+		j.environment = append(j.environment, keyValue{kv.key, t.expressions(kv.value)})
+	}
+
+	jobDefaults := lookup(lookup(node, "defaults"), "run")
+	if wd := str(lookup(jobDefaults, "working-directory")); wd != "" {
+		j.workingDirectory = path.Join("~/project", wd)
+	} else if wd := str(lookup(defaults, "working-directory")); wd != "" {
+		j.workingDirectory = path.Join("~/project", wd)
+	}
+
+	t.attach(j.comment)
+
+	var saves []*yaml.Node
+	steps := lookup(node, "steps")
+	if steps != nil {
+		for _, step := range steps.Content {
+			converted, save := c.githubStep(resolve(step), t)
+			j.steps = append(j.steps, converted...)
+			if save != nil {
+				saves = append(saves, save)
+			}
+		}
+	}
+	// GitHub saves caches in a post-job step, after every other step.
+	j.steps = append(j.steps, saves...)
+
+	if len(j.steps) == 0 {
+		j.steps = append(j.steps, todoStep("add the steps of "+id))
+	}
+
+	cfg.jobs = append(cfg.jobs, j)
+	wf.jobs = append(wf.jobs, wj)
+	return nil
+}
+
+func (c *converter) githubMatrix(j *job, wj *workflowJob, matrix *yaml.Node, t *githubTranslator) {
+	if matrix == nil {
+		return
+	}
+
+	if matrix.Kind != yaml.MappingNode {
+		c.todo(wj.comment, "translate the dynamic matrix `%s`", str(matrix))
+		return
+	}
+
+	pairs(matrix, func(key string, values *yaml.Node) {
+		switch key {
+		case "include":
+			c.todo(wj.comment, "matrix `include` entries have no equivalent; add them as separate jobs")
+			return
+		case "exclude":
+			return
+		}
+
+		param := sanitizeName(key)
+		var list []string
+		for _, v := range values.Content {
+			if v.Kind != yaml.ScalarNode {
+				c.todo(wj.comment, "the matrix values of `%s` are not plain values; only scalars can be parameters", key)
+				return
+			}
+			list = append(list, v.Value)
+		}
+
+		t.params[key] = param
+		j.parameters = append(j.parameters, param)
+		wj.matrix = append(wj.matrix, matrixParameter{name: param, values: list})
+	})
+
+	if exclude := lookup(matrix, "exclude"); exclude != nil {
+		for _, entry := range exclude.Content {
+			values := map[string]string{}
+			pairs(resolve(entry), func(key string, value *yaml.Node) {
+				if param, ok := t.params[key]; ok {
+					values[param] = str(value)
+				}
+			})
+			wj.exclude = append(wj.exclude, values)
+		}
+	}
+}
+
+// githubExecutor picks the executor matching the job's runner, container and services.
+func (c *converter) githubExecutor(cfg *config, j *job, node *yaml.Node, t *githubTranslator) string {
+	container := lookup(node, "container")
+	services := lookup(node, "services")
+
+	if container != nil || services != nil {
+		primary := mapping("image", "cimg/base:stable")
+		if container != nil {
+			image := str(container)
+			if container.Kind == yaml.MappingNode {
+				image = str(lookup(container, "image"))
+			}
+			primary = mapping("image", t.expressions(image))
+			if env := keyValues(lookup(container, "env")); len(env) > 0 {
+				set(primary, "environment", environment(env))
+			}
+			if lookup(container, "options") != nil || lookup(container, "credentials") != nil {
+				c.todo(primary, "container `options` and `credentials` were not translated; use `auth` for private images")
+			}
+		}
+
+		images := sequence(primary)
+		pairs(services, func(name string, service *yaml.Node) {
+			image := mapping("image", t.expressions(str(lookup(service, "image"))), "name", name)
+			if env := keyValues(lookup(service, "env")); len(env) > 0 {
+				for i := range env {
+					env[i].value = t.expressions(env[i].value)
+				}
+				set(image, "environment", environment(env))
+			}
+			if lookup(service, "options") != nil {
+				c.todo(image, "service `options` such as health checks were not translated; wait for the service in a step instead")
+			}
+			images.Content = append(images.Content, image)
+		})
+		t.attach(primary)
+
+		base := path.Base(strings.SplitN(str(lookup(primary, "image")), ":", 2)[0])
+		return cfg.addExecutor(sanitizeName(base), mapping("docker", images))
+	}
+
+	runsOn := strings.Join(strs(lookup(node, "runs-on")), ",")
+	switch {
+	case strings.Contains(runsOn, "${{"):
+		c.todo(j.comment, "the runner `%s` is chosen dynamically; pick an executor per matrix value", runsOn)
+	case strings.Contains(runsOn, "macos"):
+		executor := mapping("macos", mapping("xcode", "14.0.0"))
+		c.todo(executor, "pick the Xcode version matching `%s`", runsOn)
+		return cfg.addExecutor("macos", executor)
+	case strings.Contains(runsOn, "windows"):
+		return cfg.addExecutor("windows", mapping(
+			"machine", mapping("image", "windows-server-2022-gui:current"),
+			"resource_class", "windows.medium",
+			"shell", "powershell.exe -ExecutionPolicy Bypass",
+		))
+	case strings.Contains(runsOn, "self-hosted"):
+		executor := mapping("machine", "true", "resource_class", "<namespace>/<resource-class>")
+		executor.Content[1].Tag = "!!bool"
+		c.todo(executor, "set the self-hosted runner resource class matching `%s`", runsOn)
+		return cfg.addExecutor("self-hosted", executor)
+	}
+
+	return cfg.addExecutor("ubuntu", mapping("machine", mapping("image", "ubuntu-2204:current")))
+}
+
+// githubStep converts one step. Caches also return the step saving them,
+// which belongs at the end of the job.
+func (c *converter) githubStep(step *yaml.Node, t *githubTranslator) ([]*yaml.Node, *yaml.Node) {
+	name := t.expressions(str(lookup(step, "name")))
+
+	if uses := str(lookup(step, "uses")); uses != "" {
+		return c.githubAction(step, uses, name, t)
+	}
+
+	run := str(lookup(step, "run"))
+	if run == "" {
+		node := todoStep("translate step " + name)
+		c.todo(node, "the step has neither `run` nor `uses`")
+		return []*yaml.Node{node}, nil
+	}
+
+	converted := runStep(name, t.expressions(run))
+	options := converted.Content[1]
+
+	if wd := str(lookup(step, "working-directory")); wd != "" {
+		set(options, "working_directory", t.expressions(wd))
+	}
+
+	if env := keyValues(lookup(step, "env")); len(env) > 0 {
+		for i := range env {
+			env[i].value = t.expressions(env[i].value)
+		}
+		set(options, "environment", environment(env))
+	}
+
+	switch shell := str(lookup(step, "shell")); shell {
+	case "", "bash", "sh":
+	default:
+		c.todo(converted, "the step ran with the `%s` shell; set `shell` accordingly", shell)
+	}
+
+	c.githubCondition(converted, options, step)
+
+	for _, key := range []string{"continue-on-error", "timeout-minutes"} {
+		if lookup(step, key) != nil {
+			c.todo(converted, "`%s` has no direct equivalent", key)
+		}
+	}
+
+	t.attach(converted)
+	return []*yaml.Node{converted}, nil
+}
+
+// githubCondition translates the status functions of a step `if`.
+func (c *converter) githubCondition(node, options *yaml.Node, step *yaml.Node) {
+	cond := strings.TrimSpace(str(lookup(step, "if")))
+	cond = strings.TrimSuffix(strings.TrimPrefix(cond, "${{"), "}}")
+	switch strings.TrimSpace(cond) {
+	case "":
+	case "always()":
+		set(options, "when", "always")
+	case "failure()":
+		set(options, "when", "on_fail")
+	case "success()":
+	default:
+		c.todo(node, "the step only ran `if: %s`; use a `when` step or a shell condition", cond)
+	}
+}
+
+func (c *converter) githubAction(step *yaml.Node, uses, name string, t *githubTranslator) ([]*yaml.Node, *yaml.Node) {
+	action := strings.SplitN(uses, "@", 2)[0]
+	with := lookup(step, "with")
+
+	switch {
+	case action == "actions/checkout":
+		node := scalar("checkout")
+		if lookup(with, "path") != nil || lookup(with, "submodules") != nil {
+			c.todo(node, "checkout `path` and `submodules` options were not translated")
+		}
+		t.attach(node)
+		return []*yaml.Node{node}, nil
+
+	case action == "actions/cache":
+		paths := nonEmptyLines(str(lookup(with, "path")))
+		keys := []string{t.cacheKey(str(lookup(with, "key")))}
+		for _, key := range nonEmptyLines(str(lookup(with, "restore-keys"))) {
+			keys = append(keys, t.cacheKey(key))
+		}
+
+		restore := mapping("restore_cache", mapping("keys", keys))
+		save := mapping("save_cache", mapping("key", keys[0], "paths", paths))
+		t.attach(restore)
+		return []*yaml.Node{restore}, save
+
+	case action == "actions/upload-artifact":
+		paths := nonEmptyLines(t.expressions(str(lookup(with, "path"))))
+		nodes := []*yaml.Node{}
+		for _, p := range paths {
+			nodes = append(nodes, mapping("store_artifacts", mapping("path", p)))
+		}
+		// Artifacts are also how GitHub jobs share files
+		persist := mapping("persist_to_workspace", mapping("root", ".", "paths", paths))
+		nodes = append(nodes, persist)
+		t.attach(persist)
+		return nodes, nil
+
+	case action == "actions/download-artifact":
+		at := str(lookup(with, "path"))
+		if at == "" {
+			at = "."
+		}
+		node := mapping("attach_workspace", mapping("at", t.expressions(at)))
+		t.attach(node)
+		return []*yaml.Node{node}, nil
+
+	case strings.HasPrefix(action, "actions/setup-"):
+		tool := strings.TrimPrefix(action, "actions/setup-")
+		node := runStep(name, fmt.Sprintf("echo 'Set up %s'", tool))
+		c.todo(node, "`%s` was used to install %s; use a `cimg/%s` image or the matching certified orb", uses, tool, tool)
+		t.attach(node)
+		return []*yaml.Node{node}, nil
+	}
+
+	if name == "" {
+		name = uses
+	}
+	node := todoStep(name)
+	c.todo(node, "the action `%s` has no equivalent; replace it with `run` steps or an orb", uses)
+	t.attach(node)
+	return []*yaml.Node{node}, nil
+}
+
+func nonEmptyLines(s string) []string {
+	var out []string
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	return out
+}
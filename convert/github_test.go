@@ -0,0 +1,172 @@
+package convert_test
+
+import (
+	"github.com/CircleCI-Public/circleci-cli/convert"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+// decode reads a generated config back, failing when it isn't valid YAML.
+func decode(result *convert.Result) map[string]interface{} {
+	var out map[string]interface{}
+	Expect(yaml.Unmarshal([]byte(result.Config), &out)).To(Succeed())
+	return out
+}
+
+var _ = Describe("GitHub Actions", func() {
+	It("converts jobs, steps and dependencies", func() {
+		result, err := convert.Convert(convert.GitHubActions, []byte(`
+name: CI
+on:
+  push:
+    branches: [main]
+jobs:
+  build:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/checkout@v3
+      - name: Build
+        run: make build
+        working-directory: app
+        env:
+          REVISION: ${{ github.sha }}
+      - uses: actions/upload-artifact@v3
+        with:
+          path: dist
+  deploy:
+    needs: [build]
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/download-artifact@v3
+      - run: ./deploy.sh
+`))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(result.TODOs).To(BeEmpty())
+		Expect(result.Config).To(Equal(`version: 2.1
+executors:
+  ubuntu:
+    machine:
+      image: ubuntu-2204:current
+jobs:
+  build:
+    executor: ubuntu
+    steps:
+      - checkout
+      - run:
+          name: Build
+          command: make build
+          working_directory: app
+          environment:
+            REVISION: ${CIRCLE_SHA1}
+      - store_artifacts:
+          path: dist
+      - persist_to_workspace:
+          root: .
+          paths:
+            - dist
+  deploy:
+    executor: ubuntu
+    steps:
+      - attach_workspace:
+          at: .
+      - run:
+          command: ./deploy.sh
+workflows:
+  ci:
+    jobs:
+      - build:
+          filters:
+            branches:
+              only:
+                - main
+      - deploy:
+          requires:
+            - build
+          filters:
+            branches:
+              only:
+                - main
+`))
+	})
+
+	It("turns a matrix into job parameters", func() {
+		result, err := convert.Convert(convert.GitHubActions, []byte(`
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    container: cimg/go:${{ matrix.go }}
+    strategy:
+      matrix:
+        go: ["1.18", "1.19"]
+        exclude:
+          - go: "1.18"
+    steps:
+      - run: go test ./...
+`))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(result.Config).To(ContainSubstring("image: cimg/go:<< parameters.go >>"))
+
+		test := decode(result)["workflows"].(map[string]interface{})["main"].(map[string]interface{})["jobs"].([]interface{})[0]
+		Expect(test).To(Equal(map[string]interface{}{
+			"test": map[string]interface{}{
+				"matrix": map[string]interface{}{
+					"parameters": map[string]interface{}{"go": []interface{}{"1.18", "1.19"}},
+					"exclude":    []interface{}{map[string]interface{}{"go": "1.18"}},
+				},
+			},
+		}))
+	})
+
+	It("restores caches in place and saves them at the end of the job", func() {
+		result, err := convert.Convert(convert.GitHubActions, []byte(`
+jobs:
+  test:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: actions/cache@v3
+        with:
+          path: ~/.npm
+          key: ${{ runner.os }}-npm-${{ hashFiles('package-lock.json') }}
+      - run: npm ci
+`))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		steps := decode(result)["jobs"].(map[string]interface{})["test"].(map[string]interface{})["steps"].([]interface{})
+		Expect(steps).To(HaveLen(3))
+		Expect(steps[0]).To(Equal(map[string]interface{}{
+			"restore_cache": map[string]interface{}{"keys": []interface{}{`{{ arch }}-npm-{{ checksum "package-lock.json" }}`}},
+		}))
+		Expect(steps[2]).To(Equal(map[string]interface{}{
+			"save_cache": map[string]interface{}{
+				"key":   `{{ arch }}-npm-{{ checksum "package-lock.json" }}`,
+				"paths": []interface{}{"~/.npm"},
+			},
+		}))
+	})
+
+	It("leaves TODO comments for what it can't translate", func() {
+		result, err := convert.Convert(convert.GitHubActions, []byte(`
+on: [push, pull_request]
+jobs:
+  release:
+    runs-on: ubuntu-latest
+    steps:
+      - uses: softprops/action-gh-release@v1
+      - run: ./publish --token ${{ secrets.NPM_TOKEN }} --again ${{ secrets.NPM_TOKEN }}
+`))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(result.TODOs).To(Equal([]string{
+			"the workflow was triggered on `pull_request`; configure the equivalent trigger in the project settings",
+			"the action `softprops/action-gh-release@v1` has no equivalent; replace it with `run` steps or an orb",
+			"store the secret `NPM_TOKEN` in a context or as a project environment variable",
+		}))
+		Expect(result.Config).To(ContainSubstring("# TODO: the action `softprops/action-gh-release@v1` has no equivalent"))
+		Expect(result.Config).To(ContainSubstring("./publish --token ${NPM_TOKEN} --again ${NPM_TOKEN}"))
+	})
+
+	It("rejects workflows without jobs", func() {
+		_, err := convert.Convert(convert.GitHubActions, []byte("on: push\n"))
+		Expect(err).To(MatchError("no jobs found in the GitHub Actions workflow"))
+	})
+})
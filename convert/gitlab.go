@@ -0,0 +1,623 @@
+package convert
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// gitlabKeywords are the top-level keys that are not jobs.
+var gitlabKeywords = map[string]bool{
+	"image":         true,
+	"services":      true,
+	"stages":        true,
+	"variables":     true,
+	"cache":         true,
+	"before_script": true,
+	"after_script":  true,
+	"default":       true,
+	"include":       true,
+	"workflow":      true,
+	"types":         true,
+}
+
+// gitlabDefaultStages applies when the pipeline doesn't declare its stages.
+var gitlabDefaultStages = []string{".pre", "build", "test", "deploy", ".post"}
+
+// gitlabVariables maps the predefined GitLab variables that have a CircleCI
+// counterpart to the equivalent built-in environment variable.
+var gitlabVariables = map[string]string{
+	"CI_COMMIT_SHA":        "CIRCLE_SHA1",
+	"CI_COMMIT_REF_NAME":   "CIRCLE_BRANCH",
+	"CI_COMMIT_REF_SLUG":   "CIRCLE_BRANCH",
+	"CI_COMMIT_BRANCH":     "CIRCLE_BRANCH",
+	"CI_COMMIT_TAG":        "CIRCLE_TAG",
+	"CI_JOB_ID":            "CIRCLE_BUILD_NUM",
+	"CI_JOB_NAME":          "CIRCLE_JOB",
+	"CI_JOB_URL":           "CIRCLE_BUILD_URL",
+	"CI_PIPELINE_ID":       "CIRCLE_WORKFLOW_ID",
+	"CI_PROJECT_DIR":       "CIRCLE_WORKING_DIRECTORY",
+	"CI_PROJECT_NAME":      "CIRCLE_PROJECT_REPONAME",
+	"CI_PROJECT_NAMESPACE": "CIRCLE_PROJECT_USERNAME",
+	"CI_REPOSITORY_URL":    "CIRCLE_REPOSITORY_URL",
+	"CI_MERGE_REQUEST_IID": "CIRCLE_PR_NUMBER",
+	"CI_NODE_TOTAL":        "CIRCLE_NODE_TOTAL",
+	"CI_NODE_INDEX":        "CIRCLE_NODE_INDEX",
+	"GITLAB_USER_LOGIN":    "CIRCLE_USERNAME",
+}
+
+// gitlabCacheKeyVariables maps the variables used in cache keys to the
+// CircleCI cache key template equivalent.
+var gitlabCacheKeyVariables = map[string]string{
+	"CI_COMMIT_REF_NAME": "{{ .Branch }}",
+	"CI_COMMIT_REF_SLUG": "{{ .Branch }}",
+	"CI_COMMIT_BRANCH":   "{{ .Branch }}",
+	"CI_COMMIT_SHA":      "{{ .Revision }}",
+}
+
+var gitlabVariable = regexp.MustCompile(`\$(\{)?([A-Z][A-Z0-9_]*)(\})?`)
+
+// gitlabJob is a job definition once `extends` and the defaults are applied.
+type gitlabJob struct {
+	name  string
+	stage string
+	node  *yaml.Node
+}
+
+func (c *converter) fromGitLabCI(root *yaml.Node) (*config, error) {
+	cfg := &config{comment: &yaml.Node{}}
+	wf := &workflow{name: "main"}
+	cfg.workflows = append(cfg.workflows, wf)
+
+	for _, key := range []string{"include", "workflow"} {
+		if lookup(root, key) != nil {
+			c.todo(cfg.comment, "the top-level `%s` keyword was not translated", key)
+		}
+	}
+
+	defaults := lookup(root, "default")
+	if defaults == nil {
+		defaults = mapping()
+	}
+	// Global keywords predate `default` and have the same meaning.
+	for _, key := range []string{"image", "services", "cache", "before_script", "after_script"} {
+		if value := lookup(root, key); value != nil && lookup(defaults, key) == nil {
+			set(defaults, key, value)
+		}
+	}
+
+	stages := strs(lookup(root, "stages"))
+	if len(stages) == 0 {
+		stages = gitlabDefaultStages
+	} else {
+		stages = append(append([]string{".pre"}, stages...), ".post")
+	}
+
+	var jobs []gitlabJob
+	var err error
+	pairs(root, func(name string, node *yaml.Node) {
+		if err != nil || gitlabKeywords[name] || strings.HasPrefix(name, ".") {
+			return
+		}
+
+		var resolved *yaml.Node
+		resolved, err = gitlabExtends(root, name, node, nil)
+		if err != nil {
+			return
+		}
+
+		stage := str(lookup(resolved, "stage"))
+		if stage == "" {
+			stage = "test"
+		}
+		if indexOf(stages, stage) < 0 {
+			err = fmt.Errorf("job `%s` uses the undeclared stage `%s`", name, stage)
+			return
+		}
+
+		jobs = append(jobs, gitlabJob{name: name, stage: stage, node: resolved})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(jobs) == 0 {
+		return nil, fmt.Errorf("no jobs found in the GitLab CI pipeline")
+	}
+
+	globalVariables := c.gitlabVariables(lookup(root, "variables"), cfg.comment)
+
+	for _, gj := range jobs {
+		c.gitlabJob(cfg, wf, gj, jobs, stages, defaults, globalVariables)
+	}
+
+	return cfg, nil
+}
+
+// gitlabExtends resolves the `extends` chain of a job.
+func gitlabExtends(root *yaml.Node, name string, node *yaml.Node, seen []string) (*yaml.Node, error) {
+	if indexOf(seen, name) >= 0 {
+		return nil, fmt.Errorf("job `%s` extends itself", name)
+	}
+	seen = append(seen, name)
+
+	var merged *yaml.Node
+	for _, parent := range strs(lookup(node, "extends")) {
+		definition := lookup(root, parent)
+		if definition == nil {
+			return nil, fmt.Errorf("job `%s` extends the unknown job `%s`", name, parent)
+		}
+
+		resolved, err := gitlabExtends(root, parent, definition, seen)
+		if err != nil {
+			return nil, err
+		}
+		merged = deepMerge(merged, resolved)
+	}
+
+	return deepMerge(merged, node), nil
+}
+
+// deepMerge merges override into base the way GitLab does: mappings are
+// merged key by key, anything else is replaced.
+func deepMerge(base, override *yaml.Node) *yaml.Node {
+	if base == nil || override == nil || base.Kind != yaml.MappingNode || override.Kind != yaml.MappingNode {
+		if override == nil {
+			return base
+		}
+		return override
+	}
+
+	merged := mapping()
+	pairs(base, func(key string, value *yaml.Node) {
+		if key == "extends" {
+			return
+		}
+		set(merged, key, deepMerge(value, lookup(override, key)))
+	})
+	pairs(override, func(key string, value *yaml.Node) {
+		if key != "extends" && lookup(base, key) == nil {
+			set(merged, key, value)
+		}
+	})
+
+	return merged
+}
+
+func (c *converter) gitlabJob(cfg *config, wf *workflow, gj gitlabJob, jobs []gitlabJob, stages []string, defaults *yaml.Node, globalVariables []keyValue) {
+	node := gj.node
+	j := &job{name: sanitizeName(gj.name), comment: &yaml.Node{}}
+	wj := &workflowJob{name: j.name, comment: &yaml.Node{}}
+
+	inherited := func(key string) *yaml.Node {
+		if value := lookup(node, key); value != nil {
+			return value
+		}
+		return lookup(defaults, key)
+	}
+
+	for _, key := range []string{"rules", "retry", "timeout", "allow_failure", "interruptible", "resource_group", "environment", "coverage", "tags", "release"} {
+		if lookup(node, key) != nil {
+			c.todo(j.comment, "`%s` has no direct equivalent", key)
+		}
+	}
+
+	if trigger := lookup(node, "trigger"); trigger != nil {
+		c.todo(j.comment, "downstream pipelines can't be triggered from the config; call the CircleCI API instead")
+		j.executor = cfg.addExecutor("base", mapping("docker", sequence(mapping("image", "cimg/base:stable"))))
+		j.steps = append(j.steps, todoStep("trigger the downstream pipeline"))
+		cfg.jobs = append(cfg.jobs, j)
+		wf.jobs = append(wf.jobs, wj)
+		return
+	}
+
+	wj.requires = gitlabRequires(gj, jobs, stages)
+	c.gitlabRefs(wj, node)
+
+	variables := append([]keyValue{}, globalVariables...)
+	for _, kv := range c.gitlabVariables(lookup(node, "variables"), j.comment) {
+		variables = setKeyValue(variables, kv)
+	}
+
+	c.gitlabParallel(j, wj, lookup(node, "parallel"), &variables)
+
+	j.executor = c.gitlabExecutor(cfg, j, inherited("image"), inherited("services"))
+
+	checkout := true
+	for _, kv := range variables {
+		if kv.key == "GIT_STRATEGY" && kv.value == "none" {
+			checkout = false
+		}
+	}
+	j.environment = variables
+
+	if checkout {
+		j.steps = append(j.steps, scalar("checkout"))
+	}
+
+	if gitlabAttachesArtifacts(gj, jobs, stages, wj.requires) {
+		j.steps = append(j.steps, mapping("attach_workspace", mapping("at", ".")))
+	}
+
+	var save *yaml.Node
+	if cache := inherited("cache"); cache != nil {
+		var restore *yaml.Node
+		restore, save = c.gitlabCache(cache)
+		if restore != nil {
+			j.steps = append(j.steps, restore)
+		}
+	}
+
+	script := append(strs(inherited("before_script")), strs(lookup(node, "script"))...)
+	if len(script) == 0 {
+		c.todo(j.comment, "the job has no script")
+		j.steps = append(j.steps, todoStep("add the script of "+gj.name))
+	} else {
+		j.steps = append(j.steps, c.gitlabRun("Script", script))
+	}
+
+	if afterScript := strs(inherited("after_script")); len(afterScript) > 0 {
+		step := c.gitlabRun("After script", afterScript)
+		set(step.Content[1], "when", "always")
+		j.steps = append(j.steps, step)
+	}
+
+	if save != nil {
+		j.steps = append(j.steps, save)
+	}
+
+	j.steps = append(j.steps, c.gitlabArtifacts(lookup(node, "artifacts"))...)
+
+	switch when := str(lookup(node, "when")); when {
+	case "", "on_success":
+	case "manual":
+		hold := &workflowJob{name: "hold-" + j.name, approval: true, requires: wj.requires, branches: wj.branches, ignore: wj.ignore}
+		wj.requires = []string{hold.name}
+		wf.jobs = append(wf.jobs, hold)
+	default:
+		c.todo(wj.comment, "the job ran `when: %s`; CircleCI jobs only run once their requirements succeed", when)
+	}
+
+	cfg.jobs = append(cfg.jobs, j)
+	wf.jobs = append(wf.jobs, wj)
+}
+
+// gitlabRequires returns the jobs that must finish first: those listed in
+// `needs`, or else every job of the closest previous stage that has jobs.
+func gitlabRequires(gj gitlabJob, jobs []gitlabJob, stages []string) []string {
+	if needs := lookup(gj.node, "needs"); needs != nil {
+		requires := []string{}
+		for _, need := range needs.Content {
+			need = resolve(need)
+			name := str(need)
+			if need.Kind == yaml.MappingNode {
+				name = str(lookup(need, "job"))
+			}
+			requires = append(requires, sanitizeName(name))
+		}
+		return requires
+	}
+
+	for stage := indexOf(stages, gj.stage) - 1; stage >= 0; stage-- {
+		var requires []string
+		for _, other := range jobs {
+			if other.stage == stages[stage] {
+				requires = append(requires, sanitizeName(other.name))
+			}
+		}
+		if len(requires) > 0 {
+			return requires
+		}
+	}
+
+	return nil
+}
+
+// gitlabAttachesArtifacts tells whether the job downloads the artifacts of
+// the jobs before it, which GitLab does by default.
+func gitlabAttachesArtifacts(gj gitlabJob, jobs []gitlabJob, stages []string, requires []string) bool {
+	if dependencies := lookup(gj.node, "dependencies"); dependencies != nil {
+		return len(strs(dependencies)) > 0
+	}
+
+	// With `needs`, only the artifacts of the needed jobs are downloaded.
+	needs := lookup(gj.node, "needs") != nil
+
+	for _, other := range jobs {
+		if lookup(other.node, "artifacts") == nil {
+			continue
+		}
+		if indexOf(requires, sanitizeName(other.name)) >= 0 {
+			return true
+		}
+		if !needs && indexOf(stages, other.stage) < indexOf(stages, gj.stage) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// gitlabRefs translates `only` and `except` into branch filters.
+func (c *converter) gitlabRefs(wj *workflowJob, node *yaml.Node) {
+	refs := func(key string) []string {
+		value := lookup(node, key)
+		if value == nil {
+			return nil
+		}
+
+		if value.Kind == yaml.MappingNode {
+			pairs(value, func(option string, _ *yaml.Node) {
+				if option != "refs" {
+					c.todo(wj.comment, "`%s:%s` has no direct equivalent", key, option)
+				}
+			})
+			value = lookup(value, "refs")
+		}
+
+		var branches []string
+		for _, ref := range strs(value) {
+			switch ref {
+			case "branches", "pushes":
+			case "tags", "merge_requests", "schedules", "api", "web", "triggers", "pipelines", "external":
+				c.todo(wj.comment, "`%s: %s` has no direct equivalent", key, ref)
+			default:
+				branches = append(branches, ref)
+			}
+		}
+		return branches
+	}
+
+	wj.branches = refs("only")
+	wj.ignore = refs("except")
+}
+
+// gitlabParallel translates `parallel`, which is either a number of nodes or a matrix.
+func (c *converter) gitlabParallel(j *job, wj *workflowJob, parallel *yaml.Node, variables *[]keyValue) {
+	if parallel == nil {
+		return
+	}
+
+	if parallel.Kind == yaml.ScalarNode {
+		n, err := strconv.Atoi(parallel.Value)
+		if err != nil {
+			c.todo(j.comment, "translate `parallel: %s`", parallel.Value)
+			return
+		}
+		j.parallelism = n
+		return
+	}
+
+	matrix := lookup(parallel, "matrix")
+	if matrix == nil || len(matrix.Content) == 0 {
+		return
+	}
+	if len(matrix.Content) > 1 {
+		c.todo(wj.comment, "only the first `parallel:matrix` entry was translated; add the others as separate jobs")
+	}
+
+	pairs(resolve(matrix.Content[0]), func(name string, values *yaml.Node) {
+		param := strings.ToLower(sanitizeName(name))
+		j.parameters = append(j.parameters, param)
+		wj.matrix = append(wj.matrix, matrixParameter{name: param, values: strs(values)})
+		*variables = setKeyValue(*variables, keyValue{name, fmt.Sprintf("<< parameters.%s >>", param)})
+	})
+}
+
+// gitlabExecutor builds a docker executor out of the job's image and services.
+func (c *converter) gitlabExecutor(cfg *config, j *job, image *yaml.Node, services *yaml.Node) string {
+	name := str(image)
+	if image != nil && image.Kind == yaml.MappingNode {
+		name = str(lookup(image, "name"))
+		if lookup(image, "entrypoint") != nil {
+			c.todo(j.comment, "the image entrypoint was not translated")
+		}
+	}
+
+	primary := mapping("image", name)
+	if name == "" {
+		primary = mapping("image", "cimg/base:stable")
+		c.todo(primary, "the job used the runner's default image; pick the image to run it in")
+	} else {
+		name = c.gitlabExpand(name, primary)
+		primary.Content[1].Value = name
+	}
+
+	images := sequence(primary)
+	if services != nil {
+		for _, service := range services.Content {
+			service = resolve(service)
+			serviceImage, alias := str(service), ""
+			if service.Kind == yaml.MappingNode {
+				serviceImage, alias = str(lookup(service, "name")), str(lookup(service, "alias"))
+			}
+			if alias == "" {
+				// GitLab derives the hostname from the image name
+				alias = path.Base(strings.SplitN(serviceImage, ":", 2)[0])
+			}
+
+			secondary := mapping("image", serviceImage, "name", alias)
+			if variables := keyValues(lookup(service, "variables")); len(variables) > 0 {
+				set(secondary, "environment", environment(variables))
+			}
+			if command := strs(lookup(service, "command")); len(command) > 0 {
+				set(secondary, "command", command)
+			}
+			if lookup(service, "entrypoint") != nil {
+				c.todo(secondary, "the service entrypoint was not translated")
+			}
+			images.Content = append(images.Content, secondary)
+		}
+	}
+
+	base := path.Base(strings.SplitN(str(lookup(primary, "image")), ":", 2)[0])
+	return cfg.addExecutor(sanitizeName(base), mapping("docker", images))
+}
+
+// gitlabCache returns the steps restoring and saving a cache, honouring its policy.
+func (c *converter) gitlabCache(cache *yaml.Node) (*yaml.Node, *yaml.Node) {
+	if cache.Kind == yaml.SequenceNode {
+		if len(cache.Content) == 0 {
+			return nil, nil
+		}
+		cache = resolve(cache.Content[0])
+	}
+
+	keyNode := lookup(cache, "key")
+	key := "default"
+	checksums := false
+
+	switch {
+	case keyNode == nil:
+	case keyNode.Kind == yaml.MappingNode:
+		var parts []string
+		if prefix := str(lookup(keyNode, "prefix")); prefix != "" {
+			parts = append(parts, c.gitlabCacheKey(prefix))
+		}
+		for _, file := range strs(lookup(keyNode, "files")) {
+			parts = append(parts, fmt.Sprintf(`{{ checksum "%s" }}`, file))
+			checksums = true
+		}
+		key = strings.Join(parts, "-")
+	default:
+		key = c.gitlabCacheKey(str(keyNode))
+	}
+
+	policy := str(lookup(cache, "policy"))
+
+	var restore, save *yaml.Node
+	if policy != "push" {
+		restore = mapping("restore_cache", mapping("keys", []string{key}))
+	}
+	if policy != "pull" {
+		save = mapping("save_cache", mapping("key", key, "paths", strs(lookup(cache, "paths"))))
+		if !checksums && !strings.Contains(key, "{{") {
+			c.todo(save, "caches can't be overwritten, so a fixed key is only saved once; add a checksum of the lock file to the key")
+		}
+	}
+
+	return restore, save
+}
+
+func (c *converter) gitlabCacheKey(key string) string {
+	return gitlabVariable.ReplaceAllStringFunc(key, func(match string) string {
+		name := gitlabVariable.FindStringSubmatch(match)[2]
+		if translated, ok := gitlabCacheKeyVariables[name]; ok {
+			return translated
+		}
+		return fmt.Sprintf("{{ .Environment.%s }}", name)
+	})
+}
+
+// gitlabArtifacts stores the artifacts and test reports of a job, and
+// persists the artifacts so that the next jobs can attach them.
+func (c *converter) gitlabArtifacts(artifacts *yaml.Node) []*yaml.Node {
+	if artifacts == nil {
+		return nil
+	}
+
+	var steps []*yaml.Node
+	paths := strs(lookup(artifacts, "paths"))
+	for _, p := range paths {
+		steps = append(steps, mapping("store_artifacts", mapping("path", p)))
+	}
+
+	reports := lookup(artifacts, "reports")
+	pairs(reports, func(kind string, value *yaml.Node) {
+		if kind != "junit" {
+			step := mapping("store_artifacts", mapping("path", strings.Join(strs(value), " ")))
+			c.todo(step, "`%s` reports have no equivalent; they are stored as artifacts", kind)
+			steps = append(steps, step)
+			return
+		}
+		for _, report := range strs(value) {
+			steps = append(steps, mapping("store_test_results", mapping("path", report)))
+		}
+	})
+
+	if len(paths) > 0 {
+		persist := mapping("persist_to_workspace", mapping("root", ".", "paths", paths))
+		if when := str(lookup(artifacts, "when")); when != "" && when != "on_success" {
+			c.todo(persist, "artifacts were uploaded `when: %s`; add `when` to the steps above", when)
+		}
+		steps = append(steps, persist)
+	}
+
+	return steps
+}
+
+// gitlabRun builds a run step out of script lines.
+func (c *converter) gitlabRun(name string, script []string) *yaml.Node {
+	step := runStep(name, "")
+	command := step.Content[1].Content[3]
+	command.Value = c.gitlabExpand(strings.Join(script, "\n"), step)
+	if strings.Contains(command.Value, "\n") {
+		command.Style = yaml.LiteralStyle
+	}
+	return step
+}
+
+// gitlabVariables reads a `variables` section, which may hold plain values
+// or values with a description.
+func (c *converter) gitlabVariables(node *yaml.Node, comment *yaml.Node) []keyValue {
+	var out []keyValue
+	pairs(node, func(key string, value *yaml.Node) {
+		v := str(value)
+		if value.Kind == yaml.MappingNode {
+			v = str(lookup(value, "value"))
+		}
+		out = append(out, keyValue{key, c.gitlabExpand(v, comment)})
+	})
+	return out
+}
+
+// gitlabExpand renames the predefined variables used in s. Those without a
+// counterpart are reported once, on node.
+func (c *converter) gitlabExpand(s string, node *yaml.Node) string {
+	return gitlabVariable.ReplaceAllStringFunc(s, func(match string) string {
+		groups := gitlabVariable.FindStringSubmatch(match)
+		name := groups[2]
+
+		translated, known := gitlabVariables[name]
+		if !known {
+			if strings.HasPrefix(name, "CI_") && !c.reported["variable:"+name] {
+				c.reported["variable:"+name] = true
+				c.todo(node, "the predefined variable `%s` has no equivalent", name)
+			}
+			return match
+		}
+
+		if name == "CI_NODE_INDEX" && !c.reported["variable:"+name] {
+			c.reported["variable:"+name] = true
+			c.todo(node, "CIRCLE_NODE_INDEX starts at 0 where CI_NODE_INDEX started at 1")
+		}
+
+		if groups[1] == "" {
+			return "$" + translated + groups[3]
+		}
+		return "${" + translated + "}"
+	})
+}
+
+func setKeyValue(values []keyValue, kv keyValue) []keyValue {
+	for i := range values {
+		if values[i].key == kv.key {
+			values[i].value = kv.value
+			return values
+		}
+	}
+	return append(values, kv)
+}
+
+func indexOf(list []string, s string) int {
+	for i, item := range list {
+		if item == s {
+			return i
+		}
+	}
+	return -1
+}
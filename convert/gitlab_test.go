@@ -0,0 +1,192 @@
+package convert_test
+
+import (
+	"github.com/CircleCI-Public/circleci-cli/convert"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("GitLab CI", func() {
+	It("orders jobs by stage and applies extends", func() {
+		result, err := convert.Convert(convert.GitLabCI, []byte(`
+stages: [build, test]
+image: golang:1.19
+variables:
+  CGO_ENABLED: "0"
+.go:
+  before_script:
+    - go version
+build:
+  extends: .go
+  stage: build
+  script:
+    - go build -o bin/app
+  artifacts:
+    paths: [bin/]
+test:
+  extends: .go
+  script: go test ./...
+  artifacts:
+    reports:
+      junit: report.xml
+`))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(result.TODOs).To(BeEmpty())
+		Expect(result.Config).To(Equal(`version: 2.1
+executors:
+  golang:
+    docker:
+      - image: golang:1.19
+jobs:
+  build:
+    executor: golang
+    environment:
+      CGO_ENABLED: "0"
+    steps:
+      - checkout
+      - run:
+          name: Script
+          command: |-
+            go version
+            go build -o bin/app
+      - store_artifacts:
+          path: bin/
+      - persist_to_workspace:
+          root: .
+          paths:
+            - bin/
+  test:
+    executor: golang
+    environment:
+      CGO_ENABLED: "0"
+    steps:
+      - checkout
+      - attach_workspace:
+          at: .
+      - run:
+          name: Script
+          command: |-
+            go version
+            go test ./...
+      - store_test_results:
+          path: report.xml
+workflows:
+  main:
+    jobs:
+      - build
+      - test:
+          requires:
+            - build
+`))
+	})
+
+	It("gates manual jobs behind an approval", func() {
+		result, err := convert.Convert(convert.GitLabCI, []byte(`
+build:
+  stage: build
+  image: alpine
+  script: make
+deploy:
+  stage: deploy
+  image: alpine
+  script: make deploy
+  when: manual
+  only: [main]
+`))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		jobs := decode(result)["workflows"].(map[string]interface{})["main"].(map[string]interface{})["jobs"].([]interface{})
+		filters := map[string]interface{}{"branches": map[string]interface{}{"only": []interface{}{"main"}}}
+		Expect(jobs).To(Equal([]interface{}{
+			"build",
+			map[string]interface{}{"hold-deploy": map[string]interface{}{"type": "approval", "requires": []interface{}{"build"}, "filters": filters}},
+			map[string]interface{}{"deploy": map[string]interface{}{"requires": []interface{}{"hold-deploy"}, "filters": filters}},
+		}))
+	})
+
+	It("converts needs, services, caches and matrices", func() {
+		result, err := convert.Convert(convert.GitLabCI, []byte(`
+lint:
+  stage: build
+  image: node:18
+  script: npm run lint
+test:
+  stage: test
+  image: node:18
+  needs: []
+  services:
+    - name: postgres:14
+      alias: db
+  cache:
+    key:
+      files: [package-lock.json]
+    paths: [node_modules/]
+  parallel:
+    matrix:
+      - SUITE: [unit, e2e]
+  script: npm test -- --suite $SUITE --node $CI_NODE_INDEX
+`))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(result.TODOs).To(Equal([]string{"CIRCLE_NODE_INDEX starts at 0 where CI_NODE_INDEX started at 1"}))
+
+		config := decode(result)
+		Expect(config["executors"]).To(HaveKeyWithValue("node-2", map[string]interface{}{
+			"docker": []interface{}{
+				map[string]interface{}{"image": "node:18"},
+				map[string]interface{}{"image": "postgres:14", "name": "db"},
+			},
+		}))
+
+		test := config["jobs"].(map[string]interface{})["test"].(map[string]interface{})
+		Expect(test["environment"]).To(Equal(map[string]interface{}{"SUITE": "<< parameters.suite >>"}))
+		Expect(test["steps"]).To(ContainElement(map[string]interface{}{
+			"restore_cache": map[string]interface{}{"keys": []interface{}{`{{ checksum "package-lock.json" }}`}},
+		}))
+		Expect(result.Config).To(ContainSubstring("npm test -- --suite $SUITE --node $CIRCLE_NODE_INDEX"))
+
+		jobs := config["workflows"].(map[string]interface{})["main"].(map[string]interface{})["jobs"].([]interface{})
+		Expect(jobs[1]).To(Equal(map[string]interface{}{
+			"test": map[string]interface{}{
+				"matrix": map[string]interface{}{"parameters": map[string]interface{}{"suite": []interface{}{"unit", "e2e"}}},
+			},
+		}))
+	})
+
+	It("attaches only the artifacts of the needed jobs", func() {
+		result, err := convert.Convert(convert.GitLabCI, []byte(`
+stages: [build, test]
+build:
+  stage: build
+  script: make
+  artifacts:
+    paths: [bin/]
+lint:
+  stage: test
+  needs: []
+  script: make lint
+test:
+  stage: test
+  needs: [build]
+  script: make test
+`))
+		Expect(err).ShouldNot(HaveOccurred())
+
+		attach := map[string]interface{}{"attach_workspace": map[string]interface{}{"at": "."}}
+		jobs := decode(result)["jobs"].(map[string]interface{})
+		Expect(jobs["lint"].(map[string]interface{})["steps"]).NotTo(ContainElement(attach))
+		Expect(jobs["test"].(map[string]interface{})["steps"]).To(ContainElement(attach))
+	})
+
+	It("reports extends cycles", func() {
+		_, err := convert.Convert(convert.GitLabCI, []byte(`
+.a:
+  extends: .b
+.b:
+  extends: .a
+job:
+  extends: .a
+  script: make
+`))
+		Expect(err).To(MatchError("job `.a` extends itself"))
+	})
+})
@@ -137,6 +137,94 @@ sub_dir:
 `))
 		})
 	})
+
+	Describe("Overlay", func() {
+		var base, overlay string
+
+		BeforeEach(func() {
+			base = filepath.Join(tempRoot, "base")
+			overlay = filepath.Join(tempRoot, "overlay")
+
+			Expect(os.MkdirAll(filepath.Join(base, "jobs"), 0700)).To(Succeed())
+			Expect(os.MkdirAll(filepath.Join(overlay, "jobs"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(base, "jobs", "deploy.yml"), []byte(`docker:
+  - image: cimg/base:stable
+environment:
+  STAGE: dev
+  REGION: eu
+steps:
+  - run: ./deploy.sh
+`), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(base, "jobs", "smoke.yml"), []byte("steps:\n  - run: ./smoke.sh\n"), 0600)).To(Succeed())
+		})
+
+		overlaid := func() string {
+			baseTree, err := filetree.NewTree(base)
+			Expect(err).ToNot(HaveOccurred())
+			overlayTree, err := filetree.NewTree(overlay)
+			Expect(err).ToNot(HaveOccurred())
+
+			baseValue, err := baseTree.MarshalYAML()
+			Expect(err).ToNot(HaveOccurred())
+			overlayValue, err := overlayTree.MarshalYAML()
+			Expect(err).ToNot(HaveOccurred())
+
+			merged, err := filetree.Overlay(baseValue, overlayValue)
+			Expect(err).ToNot(HaveOccurred())
+
+			out, err := yaml.Marshal(merged)
+			Expect(err).ToNot(HaveOccurred())
+			return string(out)
+		}
+
+		It("merges maps and replaces lists", func() {
+			Expect(ioutil.WriteFile(filepath.Join(overlay, "jobs", "deploy.yml"), []byte(`environment:
+  STAGE: staging
+steps:
+  - run: ./deploy.sh --staging
+`), 0600)).To(Succeed())
+
+			Expect(overlaid()).To(MatchYAML(`jobs:
+  deploy:
+    docker:
+      - image: cimg/base:stable
+    environment:
+      STAGE: staging
+      REGION: eu
+    steps:
+      - run: ./deploy.sh --staging
+  smoke:
+    steps:
+      - run: ./smoke.sh
+`))
+		})
+
+		It("honours replace and delete markers", func() {
+			Expect(ioutil.WriteFile(filepath.Join(overlay, "jobs", "deploy.yml"), []byte(`environment:
+  $patch: replace
+  STAGE: production
+`), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(overlay, "jobs", "smoke.yml"), []byte("$patch: delete\n"), 0600)).To(Succeed())
+
+			Expect(overlaid()).To(MatchYAML(`jobs:
+  deploy:
+    docker:
+      - image: cimg/base:stable
+    environment:
+      STAGE: production
+    steps:
+      - run: ./deploy.sh
+`))
+		})
+
+		It("rejects unknown markers", func() {
+			_, err := filetree.Overlay(
+				map[string]interface{}{"jobs": map[string]interface{}{}},
+				map[string]interface{}{"jobs": map[string]interface{}{"build": map[string]interface{}{"$patch": "remove"}}},
+			)
+			Expect(err).To(MatchError("unknown `$patch: remove` at `jobs.build`, expected one of: merge, replace, delete"))
+		})
+	})
 })
 
 func TestCmd(t *testing.T) {
@@ -0,0 +1,139 @@
+package filetree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PatchKey is the key of the marker controlling how a map from an overlay is
+// applied, e.g. `$patch: replace`.
+const PatchKey = "$patch"
+
+// Values of the PatchKey marker.
+const (
+	// PatchMerge merges the map into the base one, key by key. It is the default.
+	PatchMerge = "merge"
+	// PatchReplace replaces the base map instead of merging into it.
+	PatchReplace = "replace"
+	// PatchDelete removes the key from the base tree.
+	PatchDelete = "delete"
+)
+
+// Overlay deep-merges each overlay, in order, over base. Both are expected to
+// be the result of marshalling a tree, such as `Node.MarshalYAML`.
+//
+// Maps are merged key by key, anything else in the overlay (scalars and
+// lists) replaces the base value. A map holding a `$patch` marker is
+// replaced instead of merged, or deleted from the base, depending on the
+// marker's value.
+func Overlay(base interface{}, overlays ...interface{}) (interface{}, error) {
+	result := base
+	for _, overlay := range overlays {
+		merged, _, err := overlayValue(result, overlay, nil)
+		if err != nil {
+			return nil, err
+		}
+		result = merged
+	}
+	return result, nil
+}
+
+// overlayValue applies overlay over base, reporting whether the value should
+// be kept at all.
+func overlayValue(base, overlay interface{}, path []string) (interface{}, bool, error) {
+	overlayMap, ok := overlay.(map[string]interface{})
+	if !ok {
+		if overlay == nil {
+			// Files that are empty or only hold comments
+			return base, true, nil
+		}
+		return overlay, true, nil
+	}
+
+	patch, err := patchOf(overlayMap, path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	switch patch {
+	case PatchDelete:
+		return nil, false, nil
+	case PatchReplace:
+		stripped, err := stripPatches(overlayMap, path)
+		return stripped, true, err
+	}
+
+	baseMap, ok := base.(map[string]interface{})
+	if !ok {
+		stripped, err := stripPatches(overlayMap, path)
+		return stripped, true, err
+	}
+
+	merged := make(map[string]interface{}, len(baseMap))
+	for k, v := range baseMap {
+		merged[k] = v
+	}
+
+	for k, v := range overlayMap {
+		if k == PatchKey {
+			continue
+		}
+
+		value, keep, err := overlayValue(baseMap[k], v, append(path, k))
+		if err != nil {
+			return nil, false, err
+		}
+
+		if keep {
+			merged[k] = value
+		} else {
+			delete(merged, k)
+		}
+	}
+
+	return merged, true, nil
+}
+
+// stripPatches removes the markers from a map that is used as is, so that
+// they don't end up in the packed config.
+func stripPatches(m map[string]interface{}, path []string) (map[string]interface{}, error) {
+	stripped := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k == PatchKey {
+			continue
+		}
+
+		if child, ok := v.(map[string]interface{}); ok {
+			patch, err := patchOf(child, append(path, k))
+			if err != nil {
+				return nil, err
+			}
+			if patch == PatchDelete {
+				continue
+			}
+
+			v, err = stripPatches(child, append(path, k))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		stripped[k] = v
+	}
+	return stripped, nil
+}
+
+func patchOf(m map[string]interface{}, path []string) (string, error) {
+	marker, ok := m[PatchKey]
+	if !ok {
+		return PatchMerge, nil
+	}
+
+	switch marker {
+	case PatchMerge, PatchReplace, PatchDelete:
+		return marker.(string), nil
+	}
+
+	return "", fmt.Errorf("unknown `%s: %v` at `%s`, expected one of: %s, %s, %s",
+		PatchKey, marker, strings.Join(path, "."), PatchMerge, PatchReplace, PatchDelete)
+}
@@ -0,0 +1,138 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/CircleCI-Public/circleci-cli/settings"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// fakeRuntime serves images from a map of references to digests, and
+// records the commands executed in containers.
+type fakeRuntime struct {
+	local   map[string][]string
+	remote  map[string][]string
+	offline bool
+	pulled  []string
+	execs   [][]string
+}
+
+func (f *fakeRuntime) name() string       { return "fake" }
+func (f *fakeRuntime) socketBind() string { return "" }
+
+func (f *fakeRuntime) pull(image string) error {
+	f.pulled = append(f.pulled, image)
+	if f.offline {
+		return errors.New("failed to pull " + image + ": no route to host")
+	}
+	f.local[image] = f.remote[image]
+	return nil
+}
+
+func (f *fakeRuntime) repoDigests(image string) ([]string, error) {
+	digests, ok := f.local[image]
+	if !ok {
+		return nil, errors.New("No such image: " + image)
+	}
+	return digests, nil
+}
+
+func (f *fakeRuntime) run(containerConfig, io.Reader, io.Writer, io.Writer) (int, error) {
+	return 0, nil
+}
+
+func (f *fakeRuntime) exec(container string, cmd []string, _ bool, _ io.Reader, _, _ io.Writer) (int, error) {
+	f.execs = append(f.execs, append([]string{container}, cmd...))
+	return 0, nil
+}
+
+var _ = Describe("agent image", func() {
+	var (
+		dir     string
+		cache   *settings.AgentImage
+		runtime *fakeRuntime
+		output  bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "circleci-agent-image")
+		Expect(err).NotTo(HaveOccurred())
+
+		cache = &settings.AgentImage{FileUsed: filepath.Join(dir, "agent_image.yml")}
+		runtime = &fakeRuntime{
+			local:  map[string][]string{},
+			remote: map[string][]string{picardRepo: {"circleci/picard@sha256:new"}},
+		}
+		output.Reset()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("pulls the latest image and caches its digest", func() {
+		Expect(resolveAgentImage(&output, runtime, cache, "", PullAlways)).To(Equal("circleci/picard@sha256:new"))
+		Expect(runtime.pulled).To(Equal([]string{picardRepo}))
+		Expect(output.String()).To(ContainSubstring("Docker image digest: sha256:new"))
+
+		content, err := ioutil.ReadFile(cache.FileUsed)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(content)).To(ContainSubstring("circleci/picard: sha256:new"))
+	})
+
+	It("uses the local image when offline", func() {
+		runtime.offline = true
+		runtime.local[picardRepo] = []string{"circleci/picard@sha256:old"}
+
+		Expect(resolveAgentImage(&output, runtime, cache, "", PullAlways)).To(Equal("circleci/picard@sha256:old"))
+		Expect(output.String()).To(ContainSubstring("Warning: failed to pull circleci/picard: no route to host"))
+	})
+
+	It("falls back to the cached digest", func() {
+		cache.Digests = map[string]string{picardRepo: "sha256:cached"}
+
+		Expect(resolveAgentImage(&output, runtime, cache, "", PullNever)).To(Equal("circleci/picard@sha256:cached"))
+		Expect(runtime.pulled).To(BeEmpty())
+	})
+
+	It("fails when the image can't be found anywhere", func() {
+		runtime.offline = true
+
+		_, err := resolveAgentImage(&output, runtime, cache, "", PullAlways)
+		Expect(err).To(MatchError("failed to pull circleci/picard: no route to host"))
+	})
+
+	It("only pulls missing images", func() {
+		runtime.local[picardRepo] = []string{"circleci/picard@sha256:old"}
+
+		Expect(resolveAgentImage(&output, runtime, cache, "", PullMissing)).To(Equal("circleci/picard@sha256:old"))
+		Expect(runtime.pulled).To(BeEmpty())
+	})
+
+	It("resolves pinned tags of other repositories", func() {
+		runtime.remote["example.com:5000/picard:1.2"] = []string{"example.com:5000/picard@sha256:abc"}
+
+		Expect(resolveAgentImage(&output, runtime, cache, "example.com:5000/picard:1.2", PullAlways)).To(Equal("example.com:5000/picard@sha256:abc"))
+	})
+
+	It("uses digests as they are", func() {
+		Expect(resolveAgentImage(&output, runtime, cache, "sha256:abc", PullNever)).To(Equal("circleci/picard@sha256:abc"))
+		Expect(runtime.pulled).To(BeEmpty())
+
+		runtime.remote["circleci/picard@sha256:abc"] = []string{"circleci/picard@sha256:abc"}
+		Expect(resolveAgentImage(&output, runtime, cache, "circleci/picard@sha256:abc", PullMissing)).To(Equal("circleci/picard@sha256:abc"))
+		Expect(runtime.pulled).To(Equal([]string{"circleci/picard@sha256:abc"}))
+	})
+
+	It("rejects unknown pull policies", func() {
+		_, err := resolveAgentImage(&output, runtime, cache, "", "sometimes")
+		Expect(err).To(MatchError("unknown pull policy `sometimes`, expected one of: always, missing, never"))
+	})
+})
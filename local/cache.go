@@ -0,0 +1,333 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CircleCI-Public/circleci-cli/settings"
+	"github.com/pkg/errors"
+)
+
+// cacheMount is where the cache directory is mounted in the containers of
+// the jobs.
+const cacheMount = "/tmp/circleci-cache"
+
+// The cache directory holds the archives of the saved paths under objects/,
+// named after the digest of their content, and one file per key under keys/
+// holding the digest of the archive and the key itself. Keys are stored
+// under their own digest, as they may contain any character.
+const (
+	cacheObjects = "objects"
+	cacheKeys    = "keys"
+)
+
+// CacheDir returns the directory the caches of local builds are kept in.
+func CacheDir() string {
+	return filepath.Join(settings.SettingsPath(), "local-cache")
+}
+
+// cacheArguments returns the build-agent arguments mounting the cache
+// directory, which is created when missing.
+func cacheArguments(dir string) ([]string, error) {
+	for _, sub := range []string{cacheObjects, cacheKeys} {
+		path := filepath.Join(dir, sub)
+		if err := os.MkdirAll(path, 0700); err != nil {
+			return nil, errors.Wrap(err, "Error creating the cache directory")
+		}
+		// The user of the job container is unrelated to the one running the
+		// CLI, and must be able to write the caches.
+		if err := os.Chmod(path, 0777); err != nil { // #nosec
+			return nil, errors.Wrap(err, "Error creating the cache directory")
+		}
+	}
+	return []string{"--volume", fmt.Sprintf("%s:%s", dir, cacheMount)}, nil
+}
+
+// emulateCache replaces the save_cache and restore_cache steps of the given
+// jobs of the compiled config, which picard skips, with steps archiving paths
+// to and restoring them from the cache directory. Steps whose keys can't be
+// rendered are left to picard, with a warning written to w.
+func emulateCache(w io.Writer, compiled string, jobs []string) (string, error) {
+	return rewriteSteps(compiled, jobs, func(name string, options map[string]interface{}) (map[string]interface{}, error) {
+		var step, command string
+		var err error
+
+		switch name {
+		case "save_cache":
+			key, _ := options["key"].(string)
+			paths, _ := options["paths"].([]interface{})
+			step = stepName(options, "Saving Cache")
+			command, err = saveCacheCommand(key, paths)
+		case "restore_cache":
+			var keys []string
+			if key, ok := options["key"].(string); ok {
+				keys = append(keys, key)
+			}
+			if list, ok := options["keys"].([]interface{}); ok {
+				for _, key := range list {
+					keys = append(keys, fmt.Sprint(key))
+				}
+			}
+			step = stepName(options, "Restoring Cache")
+			command, err = restoreCacheCommand(keys)
+		default:
+			return nil, nil
+		}
+
+		if err != nil {
+			fmt.Fprintf(w, "Warning: %s, so the step is skipped\n", err)
+			return nil, nil
+		}
+		return runStep(step, command), nil
+	})
+}
+
+func stepName(options map[string]interface{}, fallback string) string {
+	if name, ok := options["name"].(string); ok && name != "" {
+		return name
+	}
+	return fallback
+}
+
+func saveCacheCommand(key string, paths []interface{}) (string, error) {
+	if key == "" {
+		return "", errors.New("save_cache requires a key")
+	}
+	if len(paths) == 0 {
+		return "", fmt.Errorf("save_cache with key `%s` requires paths", key)
+	}
+
+	rendered, err := renderCacheKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	words := make([]string, 0, len(paths))
+	for _, path := range paths {
+		words = append(words, shellPath(fmt.Sprint(path)))
+	}
+
+	return fmt.Sprintf(`cache=%s
+key=%s
+entry="$cache/%s/$(printf '%%s' "$key" | sha256sum | cut -d' ' -f1)"
+if [ -f "$entry" ]; then
+  echo "Skipping cache generation, cache already exists for key: $key"
+  exit 0
+fi
+set --
+for path in %s; do
+  case "$path" in /*) ;; *) path="$PWD/$path" ;; esac
+  [ -e "$path" ] && set -- "$@" "${path#/}"
+done
+if [ $# -eq 0 ]; then
+  echo "None of the paths to cache exist, skipping"
+  exit 0
+fi
+mkdir -p "$cache/%s" "$cache/%s"
+archive=$(mktemp "$cache/%s/tmp.XXXXXX")
+tar -cf "$archive" -C / "$@"
+object=$(sha256sum "$archive" | cut -d' ' -f1)
+mv "$archive" "$cache/%s/$object.tar"
+printf '%%s\n%%s\n' "$object" "$key" > "$entry"
+echo "Stored cache for key: $key"`,
+		cacheMount, rendered, cacheKeys, strings.Join(words, " "),
+		cacheObjects, cacheKeys, cacheObjects, cacheObjects), nil
+}
+
+func restoreCacheCommand(keys []string) (string, error) {
+	if len(keys) == 0 {
+		return "", errors.New("restore_cache requires a key or keys")
+	}
+
+	attempts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		rendered, err := renderCacheKey(key)
+		if err != nil {
+			return "", err
+		}
+		attempts = append(attempts, "restore "+rendered)
+	}
+
+	// Keys are prefixes, matching the most recently saved cache.
+	return fmt.Sprintf(`cache=%s
+restore() {
+  for entry in $(ls -t "$cache/%s" 2>/dev/null); do
+    saved=$(sed -n 2p "$cache/%s/$entry")
+    case "$saved" in
+      "$1"*)
+        echo "Found a cache from key $saved"
+        tar -xf "$cache/%s/$(sed -n 1p "$cache/%s/$entry").tar" -C /
+        return 0 ;;
+    esac
+  done
+  return 1
+}
+%s || echo "No cache is found for the keys"`,
+		cacheMount, cacheKeys, cacheKeys, cacheObjects, cacheKeys, strings.Join(attempts, " || ")), nil
+}
+
+var cacheTemplate = regexp.MustCompile(`{{\s*(.*?)\s*}}`)
+var checksumTemplate = regexp.MustCompile(`^checksum\s+"(.*)"$`)
+
+// archCommand expands `{{ arch }}` in containers, naming the architecture
+// like Go does, so that the keys of both executors match.
+const archCommand = `$(uname -s | tr '[:upper:]' '[:lower:]')-$(uname -m | sed -e 's/^x86_64$/amd64/' -e 's/^aarch64$/arm64/')`
+
+// renderCacheKey turns a cache key template into a shell word, expanding
+// its templates when the step runs.
+func renderCacheKey(key string) (string, error) {
+	var word strings.Builder
+	last := 0
+
+	for _, match := range cacheTemplate.FindAllStringSubmatchIndex(key, -1) {
+		word.WriteString(quote(key[last:match[0]]))
+		last = match[1]
+
+		expression := key[match[2]:match[3]]
+		switch {
+		case expression == ".Branch":
+			word.WriteString(`"${CIRCLE_BRANCH}"`)
+		case expression == ".Revision":
+			word.WriteString(`"${CIRCLE_SHA1}"`)
+		case strings.HasPrefix(expression, ".Environment."):
+			word.WriteString(fmt.Sprintf(`"${%s}"`, strings.TrimPrefix(expression, ".Environment.")))
+		case expression == "epoch":
+			word.WriteString(`"$(date +%s)"`)
+		case expression == "arch":
+			word.WriteString(`"` + archCommand + `"`)
+		case checksumTemplate.MatchString(expression):
+			file := checksumTemplate.FindStringSubmatch(expression)[1]
+			word.WriteString(fmt.Sprintf(`"$(sha256sum %s | cut -d' ' -f1)"`, shellPath(file)))
+		default:
+			return "", fmt.Errorf("unsupported template `{{ %s }}` in cache key `%s`", expression, key)
+		}
+	}
+	word.WriteString(quote(key[last:]))
+
+	if word.Len() == 0 {
+		return "''", nil
+	}
+	return word.String(), nil
+}
+
+// CacheEntry is a cache saved by a local build.
+type CacheEntry struct {
+	Key   string
+	Size  int64
+	Saved time.Time
+
+	entry  string
+	object string
+}
+
+// ListCache returns the caches saved in dir, the most recent first.
+func ListCache(dir string) ([]CacheEntry, error) {
+	files, err := ioutil.ReadDir(filepath.Join(dir, cacheKeys))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CacheEntry
+	for _, file := range files {
+		entry := CacheEntry{Saved: file.ModTime(), entry: filepath.Join(dir, cacheKeys, file.Name())}
+
+		object, key, err := readCacheEntry(entry.entry)
+		if err != nil {
+			return nil, err
+		}
+		entry.Key = key
+		entry.object = filepath.Join(dir, cacheObjects, object+".tar")
+
+		if info, err := os.Stat(entry.object); err == nil {
+			entry.Size = info.Size()
+		}
+		entries = append(entries, entry)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Saved.After(entries[j].Saved)
+	})
+	return entries, nil
+}
+
+func readCacheEntry(path string) (string, string, error) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return "", "", err
+	}
+
+	if len(lines) < 2 {
+		return "", "", fmt.Errorf("malformed cache entry %s", path)
+	}
+	return lines[0], lines[1], nil
+}
+
+// PruneCache removes the caches saved before the given time, then the
+// archives no cache refers to anymore. It returns the number of caches
+// removed and the space freed.
+func PruneCache(dir string, before time.Time) (int, int64, error) {
+	entries, err := ListCache(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	removed := 0
+	referenced := map[string]bool{}
+	for _, entry := range entries {
+		if entry.Saved.Before(before) {
+			if err := os.Remove(entry.entry); err != nil {
+				return removed, 0, err
+			}
+			removed++
+			continue
+		}
+		referenced[entry.object] = true
+	}
+
+	objects, err := ioutil.ReadDir(filepath.Join(dir, cacheObjects))
+	if os.IsNotExist(err) {
+		return removed, 0, nil
+	}
+	if err != nil {
+		return removed, 0, err
+	}
+
+	var freed int64
+	for _, object := range objects {
+		path := filepath.Join(dir, cacheObjects, object.Name())
+		if referenced[path] {
+			continue
+		}
+		// Archives of caches being saved have no entry yet.
+		if strings.HasPrefix(object.Name(), "tmp.") && !object.ModTime().Before(before) {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return removed, freed, err
+		}
+		freed += object.Size()
+	}
+
+	return removed, freed, nil
+}
@@ -0,0 +1,169 @@
+package local
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("cache", func() {
+	DescribeTable("rendering keys", func(key, rendered string) {
+		Expect(renderCacheKey(key)).To(Equal(rendered))
+	},
+		Entry("literal", "v1-deps", "'v1-deps'"),
+		Entry("branch", "v1-{{ .Branch }}", `'v1-'"${CIRCLE_BRANCH}"`),
+		Entry("checksum", `deps-{{ checksum "go.sum" }}-x`, `'deps-'"$(sha256sum 'go.sum' | cut -d' ' -f1)"'-x'`),
+		Entry("epoch", "{{epoch}}", `"$(date +%s)"`),
+		Entry("environment", "{{ .Environment.CACHE_VERSION }}-deps", `"${CACHE_VERSION}"'-deps'`),
+	)
+
+	It("rejects unsupported templates", func() {
+		_, err := renderCacheKey("v1-{{ .BuildNum }}")
+		Expect(err).To(MatchError("unsupported template `{{ .BuildNum }}` in cache key `v1-{{ .BuildNum }}`"))
+	})
+
+	It("replaces the cache steps of the compiled config", func() {
+		emulated, err := emulateCache(ioutil.Discard, `jobs:
+  build:
+    steps:
+      - restore_cache:
+          keys:
+            - v1-deps-{{ .Branch }}
+            - v1-deps-
+      - save_cache:
+          name: Save the modules
+          key: v1-deps-{{ .Branch }}
+          paths:
+            - node_modules
+`, []string{"build"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(emulated).To(ContainSubstring("name: Restoring Cache"))
+		Expect(emulated).To(ContainSubstring(`restore 'v1-deps-'"${CIRCLE_BRANCH}" || restore 'v1-deps-' || echo`))
+		Expect(emulated).To(ContainSubstring("name: Save the modules"))
+		Expect(emulated).NotTo(ContainSubstring("save_cache"))
+	})
+
+	It("leaves the steps of other jobs and unsupported keys to picard", func() {
+		var warnings bytes.Buffer
+		emulated, err := emulateCache(&warnings, `jobs:
+  build:
+    steps:
+      - save_cache:
+          key: v1-{{ .BuildNum }}
+          paths:
+            - node_modules
+  deploy:
+    steps:
+      - restore_cache:
+          key: v1-{{ .Typo }}
+`, []string{"build"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(emulated).To(ContainSubstring("save_cache"))
+		Expect(emulated).To(ContainSubstring("restore_cache"))
+		Expect(warnings.String()).To(Equal("Warning: unsupported template `{{ .BuildNum }}` in cache key `v1-{{ .BuildNum }}`, so the step is skipped\n"))
+	})
+
+	Describe("on disk", func() {
+		var dir, work string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "circleci-cache")
+			Expect(err).NotTo(HaveOccurred())
+			work, err = ioutil.TempDir("", "circleci-work")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = cacheArguments(dir)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+			Expect(os.RemoveAll(work)).To(Succeed())
+		})
+
+		// sh runs a step in the working directory, with the cache directory
+		// in place of the mounted one.
+		sh := func(command string, env ...string) string {
+			for _, tool := range []string{"sh", "tar", "sha256sum"} {
+				if _, err := exec.LookPath(tool); err != nil {
+					Skip(tool + " is not available")
+				}
+			}
+
+			cmd := exec.Command("sh", "-c", strings.ReplaceAll(command, cacheMount, dir))
+			cmd.Dir = work
+			cmd.Env = append(os.Environ(), env...)
+			output, err := cmd.CombinedOutput()
+			Expect(err).NotTo(HaveOccurred(), string(output))
+			return string(output)
+		}
+
+		It("saves and restores the most recent cache matching a prefix", func() {
+			Expect(os.MkdirAll(filepath.Join(work, "node_modules", "left-pad"), 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(work, "node_modules", "left-pad", "index.js"), []byte("pad"), 0600)).To(Succeed())
+
+			save, err := saveCacheCommand("v1-{{ .Branch }}", []interface{}{"node_modules", "missing"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sh(save, "CIRCLE_BRANCH=main")).To(ContainSubstring("Stored cache for key: v1-main"))
+			Expect(sh(save, "CIRCLE_BRANCH=main")).To(ContainSubstring("cache already exists for key: v1-main"))
+
+			Expect(os.RemoveAll(filepath.Join(work, "node_modules"))).To(Succeed())
+
+			restore, err := restoreCacheCommand([]string{"v1-{{ .Branch }}", "v1-"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sh(restore, "CIRCLE_BRANCH=feature")).To(ContainSubstring("Found a cache from key v1-main"))
+			Expect(ioutil.ReadFile(filepath.Join(work, "node_modules", "left-pad", "index.js"))).To(BeEquivalentTo("pad"))
+
+			entries, err := ListCache(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Key).To(Equal("v1-main"))
+			Expect(entries[0].Size).To(BeNumerically(">", 0))
+		})
+
+		It("names the architecture like the shell executor", func() {
+			key, err := renderCacheKey("v1-{{ arch }}")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sh("printf %s " + key)).To(Equal("v1-" + cacheArch()))
+		})
+
+		It("reports when no cache matches", func() {
+			restore, err := restoreCacheCommand([]string{"v1-"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(sh(restore)).To(ContainSubstring("No cache is found for the keys"))
+		})
+
+		It("prunes old caches and the archives they used", func() {
+			write := func(name, content string, age time.Duration) {
+				path := filepath.Join(dir, name)
+				Expect(ioutil.WriteFile(path, []byte(content), 0600)).To(Succeed())
+				modified := time.Now().Add(-age)
+				Expect(os.Chtimes(path, modified, modified)).To(Succeed())
+			}
+
+			write("objects/aaa.tar", "old archive", 0)
+			write("objects/bbb.tar", "new", 0)
+			write("keys/1", "aaa\nv1-old\n", 48*time.Hour)
+			write("keys/2", "bbb\nv1-new\n", time.Hour)
+
+			removed, freed, err := PruneCache(dir, time.Now().Add(-24*time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(removed).To(Equal(1))
+			Expect(freed).To(Equal(int64(len("old archive"))))
+
+			entries, err := ListCache(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(entries).To(HaveLen(1))
+			Expect(entries[0].Key).To(Equal("v1-new"))
+			Expect(filepath.Join(dir, "objects", "aaa.tar")).NotTo(BeAnExistingFile())
+		})
+	})
+})
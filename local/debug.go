@@ -0,0 +1,205 @@
+package local
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// debugMount is where the directory the CLI and the paused jobs talk through
+// is mounted in the containers of the jobs.
+const debugMount = "/tmp/circleci-debug"
+
+// Files of the debug directory. A paused step saves the state of the job,
+// writes the ready file last and waits for the done file, which the CLI
+// writes once the debug shell exits.
+const (
+	debugContainer = "container"
+	debugDir       = "pwd"
+	debugEnv       = "env"
+	debugReady     = "ready"
+	debugDone      = "done"
+)
+
+// debugPollInterval is how often the CLI checks whether a job is paused.
+var debugPollInterval = 500 * time.Millisecond
+
+// emulateDebug adds the steps pausing the job to the compiled config: one
+// running when a step failed, and one before every step named breakBefore.
+func emulateDebug(compiled string, onFailure bool, breakBefore string) (string, error) {
+	var config map[string]interface{}
+	if err := yaml.Unmarshal([]byte(compiled), &config); err != nil {
+		return "", errors.Wrap(err, "Unable to parse the compiled config")
+	}
+
+	found := false
+	jobs, _ := config["jobs"].(map[string]interface{})
+	for _, job := range jobs {
+		job, ok := job.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		steps, _ := job["steps"].([]interface{})
+		var rewritten []interface{}
+		for _, step := range steps {
+			if breakBefore != "" && stepNamed(step, breakBefore) {
+				found = true
+				rewritten = append(rewritten, pauseStep("Breakpoint", pauseCommand(
+					fmt.Sprintf("Paused before `%s`, exit the debug shell to continue", breakBefore), false)))
+			}
+			rewritten = append(rewritten, step)
+		}
+
+		if onFailure {
+			step := pauseStep("Debugging the failure", pauseCommand("A step failed, exit the debug shell to end the job", true))
+			step["run"].(map[string]interface{})["when"] = "on_fail"
+			rewritten = append(rewritten, step)
+		}
+
+		job["steps"] = rewritten
+	}
+
+	if breakBefore != "" && !found {
+		return "", fmt.Errorf("no step is named `%s`", breakBefore)
+	}
+
+	out, err := yaml.Marshal(config)
+	return string(out), err
+}
+
+// pauseStep is a step that may wait for the debug shell for a long time,
+// without output.
+func pauseStep(name, command string) map[string]interface{} {
+	step := runStep(name, command)
+	step["run"].(map[string]interface{})["no_output_timeout"] = "24h"
+	return step
+}
+
+// stepNamed reports whether a step has the given name, or is of the given
+// type, like `checkout`.
+func stepNamed(step interface{}, name string) bool {
+	switch step := step.(type) {
+	case string:
+		return step == name
+	case map[string]interface{}:
+		for stepType, options := range step {
+			if stepType == name {
+				return true
+			}
+			if options, ok := options.(map[string]interface{}); ok && options["name"] == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// pauseCommand saves the state of the job for the debug shell, then waits
+// until it exits. The container is found by its hostname, which is its ID.
+// Bash exports variables in the format of sh in POSIX mode, so that either
+// can read them back.
+func pauseCommand(message string, fail bool) string {
+	command := fmt.Sprintf(`debug=%s
+(if [ -n "${BASH_VERSION:-}" ]; then set -o posix; fi; export -p) > "$debug/%s"
+pwd > "$debug/%s"
+hostname > "$debug/%s"
+echo %s
+touch "$debug/%s"
+while [ ! -f "$debug/%s" ]; do sleep 1; done
+rm -f "$debug/%s" "$debug/%s"`,
+		debugMount, debugEnv, debugDir, debugContainer, quote(message),
+		debugReady, debugDone, debugReady, debugDone)
+
+	if fail {
+		command += "\nexit 1"
+	}
+	return command
+}
+
+// debugArguments returns the build-agent arguments mounting a new debug
+// directory, and the directory.
+func debugArguments() ([]string, string, error) {
+	// Under /tmp for the same reason as the config, see writeStringToTempFile.
+	dir, err := ioutil.TempDir("/tmp", "circleci-debug-")
+	if err != nil {
+		return nil, "", errors.Wrap(err, "Error creating the debug directory")
+	}
+
+	// The user of the job container is unrelated to the one running the CLI.
+	if err := os.Chmod(dir, 0777); err != nil { // #nosec
+		return nil, "", errors.Wrap(err, "Error creating the debug directory")
+	}
+
+	return []string{"--volume", fmt.Sprintf("%s:%s", dir, debugMount)}, dir, nil
+}
+
+// watchDebug opens a debug shell in the job container every time the job
+// pauses, until stop is closed.
+func watchDebug(runtime containerRuntime, dir string, stop <-chan struct{}) {
+	ticker := time.NewTicker(debugPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		if _, err := os.Stat(filepath.Join(dir, debugReady)); err != nil {
+			continue
+		}
+
+		if err := openDebugShell(runtime, dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: could not open the debug shell: %s\n", err)
+		}
+
+		// Resumes the job, then waits for it to acknowledge, so that the same
+		// pause doesn't open a second shell.
+		_ = ioutil.WriteFile(filepath.Join(dir, debugDone), nil, 0666) // #nosec
+		for {
+			if _, err := os.Stat(filepath.Join(dir, debugReady)); os.IsNotExist(err) {
+				break
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// openDebugShell runs an interactive shell in the paused job container, in
+// the working directory and with the environment of the job.
+func openDebugShell(runtime containerRuntime, dir string) error {
+	container, err := ioutil.ReadFile(filepath.Join(dir, debugContainer)) // #nosec
+	if err != nil {
+		return err
+	}
+
+	state, err := term.MakeRaw(int(os.Stdin.Fd()))
+	if err != nil {
+		return errors.Wrap(err, "failed to set the terminal to raw mode")
+	}
+	defer term.Restore(int(os.Stdin.Fd()), state) // #nosec
+
+	_, err = runtime.exec(strings.TrimSpace(string(container)), debugShellCommand(), true, os.Stdin, os.Stdout, os.Stderr)
+	return err
+}
+
+func debugShellCommand() []string {
+	script := fmt.Sprintf(`cd "$(cat %[1]s/%[2]s)"
+. %[1]s/%[3]s 2>/dev/null
+if command -v bash >/dev/null; then exec bash -i; fi
+exec sh -i`, debugMount, debugDir, debugEnv)
+	return []string{"sh", "-c", script}
+}
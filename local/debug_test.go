@@ -0,0 +1,116 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("debug", func() {
+	const compiled = `jobs:
+  test:
+    steps:
+      - checkout
+      - run:
+          name: Install
+          command: make deps
+      - run: make test
+`
+
+	steps := func(emulated string) []map[string]interface{} {
+		var config struct {
+			Jobs map[string]struct {
+				Steps []interface{} `yaml:"steps"`
+			} `yaml:"jobs"`
+		}
+		Expect(yaml.Unmarshal([]byte(emulated), &config)).To(Succeed())
+
+		var result []map[string]interface{}
+		for _, step := range config.Jobs["test"].Steps {
+			if name, ok := step.(string); ok {
+				result = append(result, map[string]interface{}{name: nil})
+			} else {
+				result = append(result, step.(map[string]interface{}))
+			}
+		}
+		return result
+	}
+
+	It("pauses before the named step", func() {
+		emulated, err := emulateDebug(compiled, false, "Install")
+		Expect(err).NotTo(HaveOccurred())
+
+		result := steps(emulated)
+		Expect(result).To(HaveLen(4))
+		Expect(result[1]["run"]).To(HaveKeyWithValue("name", "Breakpoint"))
+		Expect(result[1]["run"]).To(HaveKeyWithValue("no_output_timeout", "24h"))
+		Expect(result[2]["run"]).To(HaveKeyWithValue("name", "Install"))
+	})
+
+	It("pauses before steps of the named type", func() {
+		emulated, err := emulateDebug(compiled, false, "checkout")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(steps(emulated)[0]["run"]).To(HaveKeyWithValue("name", "Breakpoint"))
+	})
+
+	It("pauses at the end of failed jobs", func() {
+		emulated, err := emulateDebug(compiled, true, "")
+		Expect(err).NotTo(HaveOccurred())
+
+		result := steps(emulated)
+		Expect(result).To(HaveLen(4))
+		Expect(result[3]["run"]).To(HaveKeyWithValue("when", "on_fail"))
+		Expect(result[3]["run"]).To(HaveKeyWithValue("command", HaveSuffix("exit 1")))
+	})
+
+	It("reports unknown steps", func() {
+		_, err := emulateDebug(compiled, false, "Deploy")
+		Expect(err).To(MatchError("no step is named `Deploy`"))
+	})
+
+	Describe("handshake", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "circleci-debug")
+			Expect(err).NotTo(HaveOccurred())
+			debugPollInterval = 10 * time.Millisecond
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("waits for the debug shell to exit", func() {
+			if _, err := exec.LookPath("sh"); err != nil {
+				Skip("sh is not available")
+			}
+
+			step := exec.Command("sh", "-c", strings.ReplaceAll(pauseCommand("Paused", false), debugMount, dir))
+			step.Env = append(os.Environ(), "FOO=bar baz")
+			Expect(step.Start()).To(Succeed())
+			finished := make(chan error)
+			go func() { finished <- step.Wait() }()
+
+			Eventually(filepath.Join(dir, debugReady), "5s").Should(BeAnExistingFile())
+			Expect(ioutil.ReadFile(filepath.Join(dir, debugEnv))).To(ContainSubstring("FOO='bar baz'"))
+			Consistently(finished).ShouldNot(Receive())
+
+			stop := make(chan struct{})
+			defer close(stop)
+			go watchDebug(&fakeRuntime{}, dir, stop)
+
+			Eventually(finished, "5s").Should(Receive(BeNil()))
+			Expect(filepath.Join(dir, debugReady)).NotTo(BeAnExistingFile())
+			Expect(filepath.Join(dir, debugDone)).NotTo(BeAnExistingFile())
+		})
+	})
+})
@@ -0,0 +1,466 @@
+package local
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const defaultDockerSocket = "/var/run/docker.sock"
+
+// dockerClient talks to the Docker Engine API over a unix socket or plain TCP.
+type dockerClient struct {
+	// network and address are those of net.Dial.
+	network string
+	address string
+	http    *http.Client
+}
+
+// containerConfig is the body of a container creation request. Field names
+// match the ones of the Engine API.
+type containerConfig struct {
+	Image        string
+	Cmd          []string
+	WorkingDir   string
+	Tty          bool
+	OpenStdin    bool
+	StdinOnce    bool
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	HostConfig   hostConfig
+}
+
+type hostConfig struct {
+	Binds       []string
+	SecurityOpt []string `json:",omitempty"`
+}
+
+// dockerEndpoint is where the Docker daemon listens.
+type dockerEndpoint struct {
+	// host is a URL such as unix:///var/run/docker.sock or tcp://host:2375.
+	host string
+	// fromEnv is set when host comes from DOCKER_HOST rather than a context.
+	fromEnv bool
+	// tls is set when the daemon expects TLS client certificates.
+	tls bool
+}
+
+// findDockerEndpoint finds the daemon the docker CLI would use: DOCKER_HOST,
+// then the endpoint of the current context, then the standard socket.
+func findDockerEndpoint() (dockerEndpoint, error) {
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		return dockerEndpoint{host: host, fromEnv: true, tls: os.Getenv("DOCKER_TLS_VERIFY") != ""}, nil
+	}
+
+	configDir := os.Getenv("DOCKER_CONFIG")
+	if configDir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return dockerEndpoint{host: "unix://" + defaultDockerSocket}, nil
+		}
+		configDir = filepath.Join(home, ".docker")
+	}
+
+	name, err := currentDockerContext(configDir)
+	if err != nil {
+		return dockerEndpoint{}, err
+	}
+	if name == "" || name == "default" {
+		return dockerEndpoint{host: "unix://" + defaultDockerSocket}, nil
+	}
+
+	// Contexts are stored under the digest of their name.
+	digest := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+
+	raw, err := ioutil.ReadFile(filepath.Join(configDir, "contexts", "meta", digest, "meta.json")) // #nosec
+	if err != nil {
+		return dockerEndpoint{}, errors.Wrapf(err, "failed to read docker context `%s`", name)
+	}
+
+	var meta struct {
+		Endpoints map[string]struct {
+			Host string
+		}
+	}
+	if err := json.Unmarshal(raw, &meta); err != nil {
+		return dockerEndpoint{}, errors.Wrapf(err, "failed to parse docker context `%s`", name)
+	}
+
+	host := meta.Endpoints["docker"].Host
+	if host == "" {
+		return dockerEndpoint{}, fmt.Errorf("docker context `%s` has no docker endpoint", name)
+	}
+
+	_, err = os.Stat(filepath.Join(configDir, "contexts", "tls", digest, "docker"))
+	return dockerEndpoint{host: host, tls: err == nil}, nil
+}
+
+// currentDockerContext returns the context chosen with DOCKER_CONTEXT or
+// `docker context use`, if any.
+func currentDockerContext(configDir string) (string, error) {
+	if name := os.Getenv("DOCKER_CONTEXT"); name != "" {
+		return name, nil
+	}
+
+	raw, err := ioutil.ReadFile(filepath.Join(configDir, "config.json")) // #nosec
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errors.Wrap(err, "failed to read the docker configuration")
+	}
+
+	var config struct {
+		CurrentContext string `json:"currentContext"`
+	}
+	if err := json.Unmarshal(raw, &config); err != nil {
+		return "", errors.Wrap(err, "failed to parse the docker configuration")
+	}
+	return config.CurrentContext, nil
+}
+
+func newDockerClient(socket string) *dockerClient {
+	return newDialingDockerClient("unix", socket)
+}
+
+// newDockerTCPClient returns a client of a daemon listening on TCP without
+// TLS, at an address such as `host:2375`.
+func newDockerTCPClient(address string) *dockerClient {
+	return newDialingDockerClient("tcp", address)
+}
+
+func newDialingDockerClient(network, address string) *dockerClient {
+	client := &dockerClient{network: network, address: address}
+	client.http = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return client.dial(ctx)
+			},
+		},
+	}
+	return client
+}
+
+func (c *dockerClient) dial(ctx context.Context) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, c.network, c.address)
+}
+
+// do sends a request to the API, decoding the JSON response into out when
+// given. Errors reported by the daemon are returned as is.
+func (c *dockerClient) do(method, path string, query url.Values, body, out interface{}) error {
+	resp, err := c.request(method, path, query, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		_, err = io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+func (c *dockerClient) request(method, path string, query url.Values, body interface{}) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest(method, c.url(path, query), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", c.address)
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		return nil, apiError(resp)
+	}
+
+	return resp, nil
+}
+
+func (c *dockerClient) url(path string, query url.Values) string {
+	u := url.URL{Scheme: "http", Host: "docker", Path: path}
+	if query != nil {
+		u.RawQuery = query.Encode()
+	}
+	return u.String()
+}
+
+func apiError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Message == "" {
+		return fmt.Errorf("docker responded with %s", resp.Status)
+	}
+	return errors.New(body.Message)
+}
+
+func (c *dockerClient) ping() error {
+	return c.do("GET", "/_ping", nil, nil, nil)
+}
+
+// pull pulls the image, waiting until the pull is complete.
+func (c *dockerClient) pull(image string) error {
+	repo, tag := splitTag(image)
+	if tag == "" {
+		tag = "latest"
+	}
+
+	resp, err := c.request("POST", "/images/create", url.Values{"fromImage": {repo}, "tag": {tag}}, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The progress is streamed as JSON messages, failures included.
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message struct {
+			Error string `json:"error"`
+		}
+		if err := decoder.Decode(&message); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if message.Error != "" {
+			return errors.New(message.Error)
+		}
+	}
+}
+
+// splitTag splits the tag or digest from an image reference, leaving the
+// registry port alone.
+func splitTag(image string) (string, string) {
+	if i := strings.Index(image, "@"); i >= 0 {
+		return image[:i], image[i+1:]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i], image[i+1:]
+	}
+	return image, ""
+}
+
+// repoDigests returns the digests of a local image, as `repo@sha256:...`.
+func (c *dockerClient) repoDigests(image string) ([]string, error) {
+	var inspect struct {
+		RepoDigests []string
+	}
+	err := c.do("GET", fmt.Sprintf("/images/%s/json", image), nil, nil, &inspect)
+	return inspect.RepoDigests, err
+}
+
+func (c *dockerClient) createContainer(config containerConfig) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.do("POST", "/containers/create", nil, config, &created); err != nil {
+		return "", errors.Wrap(err, "failed to create the container")
+	}
+	return created.ID, nil
+}
+
+func (c *dockerClient) startContainer(id string) error {
+	return c.do("POST", fmt.Sprintf("/containers/%s/start", id), nil, nil, nil)
+}
+
+// waitContainer blocks until the container stops, and returns its exit code.
+func (c *dockerClient) waitContainer(id string) (int, error) {
+	var result struct {
+		StatusCode int
+		Error      *struct {
+			Message string
+		}
+	}
+	if err := c.do("POST", fmt.Sprintf("/containers/%s/wait", id), nil, nil, &result); err != nil {
+		return 0, err
+	}
+	if result.Error != nil && result.Error.Message != "" {
+		return 0, errors.New(result.Error.Message)
+	}
+	return result.StatusCode, nil
+}
+
+func (c *dockerClient) killContainer(id, signal string) error {
+	return c.do("POST", fmt.Sprintf("/containers/%s/kill", id), url.Values{"signal": {signal}}, nil, nil)
+}
+
+func (c *dockerClient) resizeContainer(id string, height, width int) error {
+	query := url.Values{"h": {fmt.Sprint(height)}, "w": {fmt.Sprint(width)}}
+	return c.do("POST", fmt.Sprintf("/containers/%s/resize", id), query, nil, nil)
+}
+
+func (c *dockerClient) removeContainer(id string) error {
+	return c.do("DELETE", fmt.Sprintf("/containers/%s", id), url.Values{"force": {"1"}}, nil, nil)
+}
+
+// attachContainer connects to the standard streams of a container.
+func (c *dockerClient) attachContainer(id string) (*hijackedConn, error) {
+	query := url.Values{"stream": {"1"}, "stdin": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	conn, err := c.hijack(fmt.Sprintf("/containers/%s/attach", id), query, nil)
+	return conn, errors.Wrap(err, "failed to attach to the container")
+}
+
+// execConfig is the body of an exec creation request.
+type execConfig struct {
+	Cmd          []string
+	Tty          bool
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+}
+
+func (c *dockerClient) createExec(id string, config execConfig) (string, error) {
+	var created struct {
+		ID string `json:"Id"`
+	}
+	if err := c.do("POST", fmt.Sprintf("/containers/%s/exec", id), nil, config, &created); err != nil {
+		return "", errors.Wrap(err, "failed to create the exec instance")
+	}
+	return created.ID, nil
+}
+
+// startExec starts an exec instance, connected to its standard streams.
+func (c *dockerClient) startExec(id string, tty bool) (*hijackedConn, error) {
+	body := map[string]bool{"Detach": false, "Tty": tty}
+	conn, err := c.hijack(fmt.Sprintf("/exec/%s/start", id), nil, body)
+	return conn, errors.Wrap(err, "failed to start the exec instance")
+}
+
+func (c *dockerClient) resizeExec(id string, height, width int) error {
+	query := url.Values{"h": {fmt.Sprint(height)}, "w": {fmt.Sprint(width)}}
+	return c.do("POST", fmt.Sprintf("/exec/%s/resize", id), query, nil, nil)
+}
+
+// inspectExec returns the exit code of a finished exec instance.
+func (c *dockerClient) inspectExec(id string) (int, error) {
+	var inspect struct {
+		ExitCode int
+	}
+	err := c.do("GET", fmt.Sprintf("/exec/%s/json", id), nil, nil, &inspect)
+	return inspect.ExitCode, err
+}
+
+// hijack sends a POST request upgrading the connection to a raw stream. The
+// connection is taken over from HTTP, so the request is made by hand.
+func (c *dockerClient) hijack(path string, query url.Values, body interface{}) (*hijackedConn, error) {
+	conn, err := c.dial(context.Background())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %s", c.address)
+	}
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequest("POST", c.url(path, query), reader)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	buffered := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(buffered, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, apiError(resp)
+	}
+
+	return &hijackedConn{Conn: conn, reader: buffered}, nil
+}
+
+// hijackedConn is a connection taken over from HTTP, whose first bytes may
+// already have been buffered while reading the response headers.
+type hijackedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (h *hijackedConn) Read(p []byte) (int, error) {
+	return h.reader.Read(p)
+}
+
+// CloseWrite signals the end of stdin to the container.
+func (h *hijackedConn) CloseWrite() error {
+	if conn, ok := h.Conn.(interface{ CloseWrite() error }); ok {
+		return conn.CloseWrite()
+	}
+	return nil
+}
+
+// demuxStream splits the output of a container attached without a TTY,
+// where stdout and stderr are multiplexed in frames with an 8 bytes header:
+// the stream type, three bytes of padding and the size of the payload.
+func demuxStream(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		out := stdout
+		if header[0] == 2 {
+			out = stderr
+		}
+
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(out, r, size); err != nil {
+			return err
+		}
+	}
+}
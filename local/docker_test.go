@@ -0,0 +1,273 @@
+package local
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// frame builds a frame of a multiplexed container stream.
+func frame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+var _ = Describe("docker", func() {
+	var (
+		dir    string
+		server *httptest.Server
+		mux    *http.ServeMux
+		docker *dockerClient
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "circleci-docker")
+		Expect(err).NotTo(HaveOccurred())
+
+		socket := filepath.Join(dir, "docker.sock")
+		listener, err := net.Listen("unix", socket)
+		Expect(err).NotTo(HaveOccurred())
+
+		mux = http.NewServeMux()
+		server = httptest.NewUnstartedServer(mux)
+		server.Listener = listener
+		server.Start()
+
+		docker = newDockerClient(socket)
+	})
+
+	AfterEach(func() {
+		server.Close()
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	It("finds the digest of the pulled picard image", func() {
+		mux.HandleFunc("/images/create", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal("POST"))
+			Expect(r.URL.Query().Get("fromImage")).To(Equal("circleci/picard"))
+			Expect(r.URL.Query().Get("tag")).To(Equal("latest"))
+			fmt.Fprintln(w, `{"status":"Pulling from circleci/picard"}`)
+			fmt.Fprintln(w, `{"status":"Digest: sha256:abc"}`)
+		})
+		mux.HandleFunc("/images/circleci/picard/json", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"RepoDigests":["example.com/picard@sha256:def","circleci/picard@sha256:abc"]}`)
+		})
+
+		runtime := &engineRuntime{client: docker}
+		Expect(runtime.pull(picardRepo)).To(Succeed())
+		digests, err := runtime.repoDigests(picardRepo)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(digestOf(picardRepo, digests)).To(Equal("sha256:abc"))
+	})
+
+	It("reports errors happening during a pull", func() {
+		mux.HandleFunc("/images/create", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintln(w, `{"error":"toomanyrequests: rate limit exceeded"}`)
+		})
+
+		err := (&engineRuntime{client: docker}).pull(picardRepo)
+		Expect(err).To(MatchError("failed to pull circleci/picard: toomanyrequests: rate limit exceeded"))
+	})
+
+	It("pulls images pinned to a digest", func() {
+		mux.HandleFunc("/images/create", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.URL.Query().Get("fromImage")).To(Equal("example.com:5000/picard"))
+			Expect(r.URL.Query().Get("tag")).To(Equal("sha256:abc"))
+		})
+
+		Expect(docker.pull("example.com:5000/picard@sha256:abc")).To(Succeed())
+	})
+
+	It("returns the messages of API errors", func() {
+		mux.HandleFunc("/containers/create", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"message":"No such image: circleci/picard"}`)
+		})
+
+		_, err := docker.createContainer(containerConfig{Image: "circleci/picard"})
+		Expect(err).To(MatchError("failed to create the container: No such image: circleci/picard"))
+	})
+
+	It("returns the exit code of the container", func() {
+		mux.HandleFunc("/containers/abc/wait", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"StatusCode":3}`)
+		})
+
+		Expect(docker.waitContainer("abc")).To(Equal(3))
+	})
+
+	It("runs a container to completion", func() {
+		started := make(chan struct{})
+		finished := make(chan struct{})
+		removed := false
+
+		mux.HandleFunc("/containers/create", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"Id":"abc"}`)
+		})
+		mux.HandleFunc("/containers/abc/attach", func(w http.ResponseWriter, r *http.Request) {
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			fmt.Fprint(buf, "HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+			Expect(buf.Flush()).To(Succeed())
+
+			<-started
+			_, _ = conn.Write(frame(1, "Success!\n"))
+			_, _ = conn.Write(frame(2, "warning\n"))
+			close(finished)
+		})
+		mux.HandleFunc("/containers/abc/start", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+			close(started)
+		})
+		mux.HandleFunc("/containers/abc/wait", func(w http.ResponseWriter, r *http.Request) {
+			<-finished
+			fmt.Fprint(w, `{"StatusCode":0}`)
+		})
+		mux.HandleFunc("/containers/abc", func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Method).To(Equal("DELETE"))
+			removed = true
+			w.WriteHeader(http.StatusNoContent)
+		})
+
+		var stdout, stderr bytes.Buffer
+		code, err := runContainer(docker, containerConfig{Image: "circleci/picard"}, bytes.NewReader(nil), &stdout, &stderr)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(0))
+		Expect(stdout.String()).To(Equal("Success!\n"))
+		Expect(stderr.String()).To(Equal("warning\n"))
+		Expect(removed).To(BeTrue())
+	})
+
+	It("runs commands in a running container", func() {
+		mux.HandleFunc("/containers/abc/exec", func(w http.ResponseWriter, r *http.Request) {
+			var config execConfig
+			Expect(json.NewDecoder(r.Body).Decode(&config)).To(Succeed())
+			Expect(config.Cmd).To(Equal([]string{"sh", "-c", "echo hello"}))
+			fmt.Fprint(w, `{"Id":"def"}`)
+		})
+		mux.HandleFunc("/exec/def/start", func(w http.ResponseWriter, r *http.Request) {
+			conn, buf, err := w.(http.Hijacker).Hijack()
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			fmt.Fprint(buf, "HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+			Expect(buf.Flush()).To(Succeed())
+			_, _ = conn.Write(frame(1, "hello\n"))
+		})
+		mux.HandleFunc("/exec/def/json", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"ExitCode":4}`)
+		})
+
+		var stdout, stderr bytes.Buffer
+		code, err := runExec(docker, "abc", []string{"sh", "-c", "echo hello"}, false, bytes.NewReader(nil), &stdout, &stderr)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(4))
+		Expect(stdout.String()).To(Equal("hello\n"))
+	})
+
+	It("splits a multiplexed stream", func() {
+		var stream bytes.Buffer
+		stream.Write(frame(1, "out 1\n"))
+		stream.Write(frame(2, "err 1\n"))
+		stream.Write(frame(1, "out 2\n"))
+
+		var stdout, stderr bytes.Buffer
+		Expect(demuxStream(&stream, &stdout, &stderr)).To(Succeed())
+		Expect(stdout.String()).To(Equal("out 1\nout 2\n"))
+		Expect(stderr.String()).To(Equal("err 1\n"))
+	})
+
+	It("talks to daemons listening on TCP", func() {
+		tcp := httptest.NewServer(mux)
+		defer tcp.Close()
+		mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, "OK")
+		})
+
+		Expect(newDockerTCPClient(tcp.Listener.Addr().String()).ping()).To(Succeed())
+	})
+
+	Describe("finding the daemon", func() {
+		environment := []string{"DOCKER_HOST", "DOCKER_TLS_VERIFY", "DOCKER_CONFIG", "DOCKER_CONTEXT"}
+		saved := map[string]*string{}
+
+		BeforeEach(func() {
+			for _, key := range environment {
+				if value, ok := os.LookupEnv(key); ok {
+					saved[key] = &value
+				} else {
+					saved[key] = nil
+				}
+				Expect(os.Unsetenv(key)).To(Succeed())
+			}
+			Expect(os.Setenv("DOCKER_CONFIG", dir)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			for key, value := range saved {
+				if value != nil {
+					os.Setenv(key, *value)
+				} else {
+					os.Unsetenv(key)
+				}
+			}
+		})
+
+		writeContext := func(name, host string, tls bool) {
+			digest := fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+			meta := filepath.Join(dir, "contexts", "meta", digest)
+			Expect(os.MkdirAll(meta, 0700)).To(Succeed())
+			contents := fmt.Sprintf(`{"Name":%q,"Endpoints":{"docker":{"Host":%q,"SkipTLSVerify":false}}}`, name, host)
+			Expect(ioutil.WriteFile(filepath.Join(meta, "meta.json"), []byte(contents), 0600)).To(Succeed())
+			if tls {
+				Expect(os.MkdirAll(filepath.Join(dir, "contexts", "tls", digest, "docker"), 0700)).To(Succeed())
+			}
+		}
+
+		It("defaults to the standard socket", func() {
+			Expect(findDockerEndpoint()).To(Equal(dockerEndpoint{host: "unix:///var/run/docker.sock"}))
+		})
+
+		It("prefers DOCKER_HOST to the current context", func() {
+			writeContext("colima", "unix:///Users/me/.colima/default/docker.sock", false)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"currentContext":"colima"}`), 0600)).To(Succeed())
+			Expect(os.Setenv("DOCKER_HOST", "tcp://example.com:2376")).To(Succeed())
+			Expect(os.Setenv("DOCKER_TLS_VERIFY", "1")).To(Succeed())
+
+			Expect(findDockerEndpoint()).To(Equal(dockerEndpoint{host: "tcp://example.com:2376", fromEnv: true, tls: true}))
+		})
+
+		It("reads the endpoint of the current context", func() {
+			writeContext("colima", "unix:///Users/me/.colima/default/docker.sock", false)
+			Expect(ioutil.WriteFile(filepath.Join(dir, "config.json"), []byte(`{"currentContext":"colima"}`), 0600)).To(Succeed())
+			Expect(findDockerEndpoint()).To(Equal(dockerEndpoint{host: "unix:///Users/me/.colima/default/docker.sock"}))
+
+			writeContext("remote", "tcp://example.com:2376", true)
+			Expect(os.Setenv("DOCKER_CONTEXT", "remote")).To(Succeed())
+			Expect(findDockerEndpoint()).To(Equal(dockerEndpoint{host: "tcp://example.com:2376", tls: true}))
+		})
+
+		It("reports contexts that do not exist", func() {
+			Expect(os.Setenv("DOCKER_CONTEXT", "missing")).To(Succeed())
+			_, err := findDockerEndpoint()
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("failed to read docker context `missing`"))
+		})
+	})
+})
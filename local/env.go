@@ -0,0 +1,203 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// AddEnvironmentFlags adds the flags setting environment variables from files.
+func AddEnvironmentFlags(flags *pflag.FlagSet) {
+	flags.StringArray("env-file", nil, "Read environment variables from a file in dotenv format")
+	flags.String("context-file", "", "YAML file mapping context names to their environment variables, which are set for the contexts used by the job in the workflows of the config")
+}
+
+// environmentArguments returns the `--env` arguments of build-agent setting
+// the variables of the given contexts, then those of the env files. As
+// later values take precedence, `--env` flags still override them.
+func environmentArguments(flags *pflag.FlagSet, contexts []string) ([]string, error) {
+	var arguments []string
+
+	contextFile, _ := flags.GetString("context-file")
+	if contextFile != "" {
+		defined, err := readContextFile(contextFile)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, context := range contexts {
+			variables, ok := defined[context]
+			if !ok {
+				return nil, fmt.Errorf("context `%s` is not defined in %s", context, contextFile)
+			}
+			arguments = append(arguments, envArguments(variables)...)
+		}
+	}
+
+	envFiles, _ := flags.GetStringArray("env-file")
+	for _, path := range envFiles {
+		variables, err := readEnvFile(path)
+		if err != nil {
+			return nil, err
+		}
+		arguments = append(arguments, envArguments(variables)...)
+	}
+
+	return arguments, nil
+}
+
+func envArguments(variables map[string]string) []string {
+	names := make([]string, 0, len(variables))
+	for name := range variables {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	arguments := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		arguments = append(arguments, "--env", fmt.Sprintf("%s=%s", name, variables[name]))
+	}
+	return arguments
+}
+
+// readContextFile reads the variables of each context, e.g.
+//
+//	org-global:
+//	  AWS_REGION: us-east-1
+func readContextFile(path string) (map[string]map[string]string, error) {
+	content, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read the context file")
+	}
+
+	var contexts map[string]map[string]string
+	if err := yaml.Unmarshal(content, &contexts); err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse the context file %s", path)
+	}
+
+	return contexts, nil
+}
+
+func readEnvFile(path string) (map[string]string, error) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return nil, errors.Wrap(err, "Unable to read the env file")
+	}
+	defer file.Close()
+
+	variables := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, err := parseEnvLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, number, err)
+		}
+		variables[name] = value
+	}
+
+	return variables, scanner.Err()
+}
+
+// parseEnvLine parses a `NAME=value` line of a dotenv file. Values may be
+// quoted: double quoted ones understand the usual escapes, single quoted ones
+// are taken literally. Unquoted values end at a ` #` comment.
+func parseEnvLine(line string) (string, string, error) {
+	line = strings.TrimPrefix(line, "export ")
+
+	i := strings.Index(line, "=")
+	if i < 1 {
+		return "", "", errors.New("expected `NAME=value`")
+	}
+
+	name, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+	if strings.ContainsAny(name, " \t") {
+		return "", "", fmt.Errorf("invalid variable name `%s`", name)
+	}
+
+	if value == "" {
+		return name, "", nil
+	}
+
+	switch quote := value[0]; quote {
+	case '"', '\'':
+		end := strings.LastIndexByte(value, quote)
+		if end == 0 {
+			return "", "", fmt.Errorf("unterminated quote in the value of %s", name)
+		}
+		value = value[1:end]
+		if quote == '"' {
+			value = strings.NewReplacer(`\n`, "\n", `\t`, "\t", `\"`, `"`, `\\`, `\`).Replace(value)
+		}
+	default:
+		if comment := strings.Index(value, " #"); comment >= 0 {
+			value = strings.TrimSpace(value[:comment])
+		}
+	}
+
+	return name, value, nil
+}
+
+// jobContexts lists the contexts the workflows of a compiled config use for
+// a job.
+func jobContexts(compiled, job string) ([]string, error) {
+	var config struct {
+		Workflows map[string]yaml.Node `yaml:"workflows"`
+	}
+	if err := yaml.Unmarshal([]byte(compiled), &config); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the compiled config")
+	}
+
+	var contexts []string
+	seen := map[string]bool{}
+	for name, definition := range config.Workflows {
+		if name == "version" {
+			continue
+		}
+
+		nodes, err := workflowNodes(definition, name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, node := range nodes {
+			if node.job != job {
+				continue
+			}
+			for _, context := range node.contexts {
+				if !seen[context] {
+					seen[context] = true
+					contexts = append(contexts, context)
+				}
+			}
+		}
+	}
+
+	sort.Strings(contexts)
+	return contexts, nil
+}
+
+// contextNames reads the `context` of a workflow job, a name or a list of them.
+func contextNames(node yaml.Node) ([]string, error) {
+	switch node.Kind {
+	case 0:
+		return nil, nil
+	case yaml.ScalarNode:
+		return []string{node.Value}, nil
+	}
+
+	var names []string
+	err := node.Decode(&names)
+	return names, err
+}
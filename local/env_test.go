@@ -0,0 +1,115 @@
+package local
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+)
+
+var _ = Describe("environment", func() {
+	DescribeTable("parsing dotenv lines", func(line, name, value string) {
+		parsedName, parsedValue, err := parseEnvLine(line)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsedName).To(Equal(name))
+		Expect(parsedValue).To(Equal(value))
+	},
+		Entry("plain", "FOO=bar", "FOO", "bar"),
+		Entry("exported", "export FOO=bar", "FOO", "bar"),
+		Entry("empty", "FOO=", "FOO", ""),
+		Entry("comment", "FOO=bar # the bar", "FOO", "bar"),
+		Entry("equal signs", "URL=https://example.com/?a=b", "URL", "https://example.com/?a=b"),
+		Entry("double quotes", `FOO="two\nlines # kept"`, "FOO", "two\nlines # kept"),
+		Entry("single quotes", `FOO='no\nescapes'`, "FOO", `no\nescapes`),
+	)
+
+	It("rejects malformed lines", func() {
+		_, _, err := parseEnvLine("FOO")
+		Expect(err).To(MatchError("expected `NAME=value`"))
+
+		_, _, err = parseEnvLine(`FOO="bar`)
+		Expect(err).To(MatchError("unterminated quote in the value of FOO"))
+	})
+
+	It("finds the contexts a job uses in the workflows", func() {
+		contexts, err := jobContexts(`workflows:
+  version: 2
+  main:
+    jobs:
+      - build:
+          context: org-global
+      - deploy:
+          context: [aws, org-global]
+  nightly:
+    jobs:
+      - build:
+          context:
+            - slack
+      - lint
+`, "build")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(contexts).To(Equal([]string{"org-global", "slack"}))
+	})
+
+	Describe("arguments", func() {
+		var (
+			dir   string
+			flags *pflag.FlagSet
+		)
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "circleci-env")
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(ioutil.WriteFile(filepath.Join(dir, "contexts.yml"), []byte(`org-global:
+  REGION: us-east-1
+  RETRIES: 3
+aws:
+  AWS_KEY: secret
+`), 0600)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(dir, ".env"), []byte(`# local overrides
+REGION=eu-west-1
+
+export DEBUG=1
+`), 0600)).To(Succeed())
+
+			flags = pflag.NewFlagSet("test", pflag.ContinueOnError)
+			AddEnvironmentFlags(flags)
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("sets the variables of the contexts, then of the env files", func() {
+			Expect(flags.Parse([]string{
+				"--context-file", filepath.Join(dir, "contexts.yml"),
+				"--env-file", filepath.Join(dir, ".env"),
+			})).To(Succeed())
+
+			Expect(environmentArguments(flags, []string{"org-global", "aws"})).To(Equal([]string{
+				"--env", "REGION=us-east-1",
+				"--env", "RETRIES=3",
+				"--env", "AWS_KEY=secret",
+				"--env", "DEBUG=1",
+				"--env", "REGION=eu-west-1",
+			}))
+		})
+
+		It("reports contexts missing from the context file", func() {
+			Expect(flags.Parse([]string{"--context-file", filepath.Join(dir, "contexts.yml")})).To(Succeed())
+
+			_, err := environmentArguments(flags, []string{"slack"})
+			Expect(err).To(MatchError("context `slack` is not defined in " + filepath.Join(dir, "contexts.yml")))
+		})
+
+		It("ignores contexts without a context file", func() {
+			Expect(environmentArguments(flags, []string{"org-global"})).To(BeEmpty())
+		})
+	})
+})
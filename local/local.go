@@ -5,8 +5,8 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
-	"os/exec"
-	"regexp"
+	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 
@@ -16,6 +16,7 @@ import (
 	"github.com/CircleCI-Public/circleci-cli/settings"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
+	"golang.org/x/term"
 )
 
 var picardRepo = "circleci/picard"
@@ -23,42 +24,82 @@ var picardRepo = "circleci/picard"
 const DefaultConfigPath = ".circleci/config.yml"
 
 func Execute(flags *pflag.FlagSet, cfg *settings.Config) error {
-	var err error
-	var configResponse *config.ConfigResponse
-	restClient := rest.New(cfg.Host, cfg)
 	processedArgs, configPath := buildAgentArguments(flags)
 
-	//if no orgId provided use org slug
-	orgID, _ := flags.GetString("org-id")
-	if strings.TrimSpace(orgID) != "" {
-		configResponse, err = config.ConfigQuery(restClient, configPath, orgID, nil, pipeline.LocalPipelineValues())
-		if err != nil {
+	compiled, err := compileConfig(flags, cfg, configPath)
+	if err != nil {
+		return err
+	}
+
+	job, _ := flags.GetString("job")
+	contexts, err := jobContexts(compiled, job)
+	if err != nil {
+		return err
+	}
+
+	environment, err := environmentArguments(flags, contexts)
+	if err != nil {
+		return err
+	}
+	processedArgs = append(environment, processedArgs...)
+
+	switch executor, _ := flags.GetString("executor"); executor {
+	case ExecutorContainer:
+	case ExecutorShell:
+		return executeShell(compiled, job, shellEnvironment(flags, environment))
+	default:
+		return fmt.Errorf("unknown executor `%s`, expected one of: %s, %s", executor, ExecutorContainer, ExecutorShell)
+	}
+
+	if noCache, _ := flags.GetBool("no-cache"); !noCache {
+		if compiled, err = emulateCache(os.Stderr, compiled, []string{job}); err != nil {
 			return err
 		}
-	} else {
-		orgSlug, _ := flags.GetString("org-slug")
-		configResponse, err = config.ConfigQuery(restClient, configPath, orgSlug, nil, pipeline.LocalPipelineValues())
+
+		cache, err := cacheArguments(CacheDir())
 		if err != nil {
 			return err
 		}
+		processedArgs = append(processedArgs, cache...)
 	}
 
-	if !configResponse.Valid {
-		return fmt.Errorf("config errors %v", configResponse.Errors)
+	outputDir, _ := flags.GetString("output-dir")
+	if outputDir != "" {
+		if compiled, err = emulateOutput(compiled); err != nil {
+			return err
+		}
 	}
 
-	processedConfigPath, err := writeStringToTempFile(configResponse.OutputYaml)
+	debugOnFailure, _ := flags.GetBool("debug-on-failure")
+	breakBefore, _ := flags.GetString("break-before")
+	allNodes, _ := flags.GetBool("all-nodes")
 
-	// The file at processedConfigPath must be left in place until after the call
-	// to `docker run` has completed. Typically, we would `defer` a call to remove
-	// the file. In this case, we execute `docker` using `syscall.Exec`, which
-	// replaces the current process, and no more go code will execute at that
-	// point, so we cannot delete the file easily. We choose to leave the file
-	// in-place in /tmp.
+	var debugDir string
+	if debugOnFailure || breakBefore != "" {
+		if allNodes {
+			return errors.New("--debug-on-failure and --break-before can't be used with --all-nodes")
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return errors.New("--debug-on-failure and --break-before need a terminal to open the debug shell in")
+		}
+
+		if compiled, err = emulateDebug(compiled, debugOnFailure, breakBefore); err != nil {
+			return err
+		}
+
+		var debug []string
+		if debug, debugDir, err = debugArguments(); err != nil {
+			return err
+		}
+		defer os.RemoveAll(debugDir)
+		processedArgs = append(processedArgs, debug...)
+	}
 
+	processedConfigPath, err := writeStringToTempFile(compiled)
 	if err != nil {
 		return err
 	}
+	defer os.Remove(processedConfigPath)
 
 	pwd, err := os.Getwd()
 
@@ -66,33 +107,267 @@ func Execute(flags *pflag.FlagSet, cfg *settings.Config) error {
 		return err
 	}
 
-	dockerPath, err := ensureDockerIsAvailable()
+	runtimeName, _ := flags.GetString("runtime")
+	runtime, err := newRuntime(runtimeName)
 
 	if err != nil {
 		return err
 	}
 
-	image, err := picardImage(os.Stdout)
+	image, err := picardImage(os.Stdout, runtime, flags)
 
 	if err != nil {
 		return errors.Wrap(err, "Could not find picard image")
 	}
 
-	arguments := generateDockerCommand(processedConfigPath, image, pwd, processedArgs...)
+	if allNodes {
+		total, _ := flags.GetInt("node-total")
+		if !flags.Changed("node-total") {
+			if total, err = jobParallelism(compiled, job); err != nil {
+				return err
+			}
+		}
+
+		nodeArgs := withoutFlags(processedArgs, "index", "node-total")
+		err = runAllNodes(total, os.Stdout, os.Stderr, func(index int, stdout, stderr io.Writer) (int, error) {
+			arguments := append([]string{"--node-total", fmt.Sprint(total), "--index", fmt.Sprint(index)}, nodeArgs...)
+			if outputDir != "" {
+				// Each node has its own directory, so that they don't overwrite each other's files.
+				output, err := outputArguments(filepath.Join(outputDir, fmt.Sprintf("node-%d", index)))
+				if err != nil {
+					return 0, err
+				}
+				arguments = append(arguments, output...)
+			}
+
+			container := generateContainerConfig(processedConfigPath, image, pwd, runtime.socketBind(), false, arguments...)
+			return runtime.run(container, strings.NewReader(""), stdout, stderr)
+		})
+		return withOutputSummary(outputDir, err)
+	}
+
+	if outputDir != "" {
+		output, err := outputArguments(outputDir)
+		if err != nil {
+			return err
+		}
+		processedArgs = append(processedArgs, output...)
+	}
+
+	// While debugging, the terminal is handed over to the debug shell instead.
+	tty := debugDir == "" && term.IsTerminal(int(os.Stdin.Fd()))
+	container := generateContainerConfig(processedConfigPath, image, pwd, runtime.socketBind(), tty, processedArgs...)
 
 	if cfg.Debug {
-		_, err = fmt.Fprintf(os.Stderr, "Starting docker with args: %s", arguments)
+		_, err = fmt.Fprintf(os.Stderr, "Starting %s with args: %s", runtime.name(), container.Cmd)
 		if err != nil {
 			return err
 		}
 	}
 
+	var exitCode int
+	if debugDir != "" {
+		stop := make(chan struct{})
+		go watchDebug(runtime, debugDir, stop)
+		exitCode, err = runtime.run(container, strings.NewReader(""), os.Stdout, os.Stderr)
+		close(stop)
+	} else {
+		exitCode, err = runAttached(runtime, container)
+	}
+	if err != nil {
+		return err
+	}
+
+	if exitCode != 0 {
+		err = &ExitError{Code: exitCode}
+	}
+
+	return withOutputSummary(outputDir, err)
+}
+
+// runAttached runs the container with the standard streams attached to it,
+// in raw mode when they are a terminal.
+func runAttached(runtime containerRuntime, container containerConfig) (int, error) {
+	if container.Tty {
+		state, err := term.MakeRaw(int(os.Stdin.Fd()))
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to set the terminal to raw mode")
+		}
+		defer term.Restore(int(os.Stdin.Fd()), state) // #nosec
+	}
+
+	return runtime.run(container, os.Stdin, os.Stdout, os.Stderr)
+}
+
+// withOutputSummary prints the summary of the output of the job, when it was
+// copied out, whether the job succeeded or not.
+func withOutputSummary(outputDir string, err error) error {
+	if outputDir == "" {
+		return err
+	}
+
+	var exitErr *ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return err
+	}
+
+	if summaryErr := summarizeOutput(os.Stdout, outputDir); summaryErr != nil {
+		return summaryErr
+	}
+	return err
+}
+
+// compileConfig processes the config at configPath, which is what picard
+// runs jobs from.
+func compileConfig(flags *pflag.FlagSet, cfg *settings.Config, configPath string) (string, error) {
+	var err error
+	var configResponse *config.ConfigResponse
+	restClient := rest.New(cfg.Host, cfg)
+
+	//if no orgId provided use org slug
+	orgID, _ := flags.GetString("org-id")
+	if strings.TrimSpace(orgID) != "" {
+		configResponse, err = config.ConfigQuery(restClient, configPath, orgID, nil, pipeline.LocalPipelineValues())
+		if err != nil {
+			return "", err
+		}
+	} else {
+		orgSlug, _ := flags.GetString("org-slug")
+		configResponse, err = config.ConfigQuery(restClient, configPath, orgSlug, nil, pipeline.LocalPipelineValues())
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if !configResponse.Valid {
+		return "", fmt.Errorf("config errors %v", configResponse.Errors)
+	}
+
+	return configResponse.OutputYaml, nil
+}
+
+// ExitError reports that the job ran, but failed. The CLI exits with the same code.
+type ExitError struct {
+	Code int
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("the job exited with code %d", e.Code)
+}
+
+// runContainer runs the picard container to completion with the given
+// streams attached to it, and returns its exit code.
+func runContainer(docker *dockerClient, container containerConfig, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	id, err := docker.createContainer(container)
+	if err != nil {
+		return 0, err
+	}
+	// Removed here rather than by the daemon, so that its exit code can't
+	// be lost to the removal.
+	defer docker.removeContainer(id) // #nosec
+
+	conn, err := docker.attachContainer(id)
 	if err != nil {
-		return errors.Wrap(err, "Could not find a `docker` executable on $PATH; please ensure that docker installed")
+		return 0, err
+	}
+	defer conn.Close()
+
+	output := make(chan error, 1)
+	go func() {
+		if container.Tty {
+			_, err := io.Copy(stdout, conn)
+			output <- err
+			return
+		}
+		output <- demuxStream(conn, stdout, stderr)
+	}()
+
+	go func() {
+		_, _ = io.Copy(conn, stdin)
+		_ = conn.CloseWrite()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer func() {
+		signal.Stop(signals)
+		close(signals)
+	}()
+	go forwardSignals(docker, id, signals)
+
+	if err := docker.startContainer(id); err != nil {
+		return 0, errors.Wrap(err, "failed to start the container")
+	}
+
+	if container.Tty {
+		if width, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			_ = docker.resizeContainer(id, height, width)
+		}
 	}
 
-	err = syscall.Exec(dockerPath, arguments, os.Environ()) // #nosec
-	return errors.Wrap(err, "failed to execute docker")
+	exitCode, err := docker.waitContainer(id)
+	if err != nil {
+		return 0, errors.Wrap(err, "failed waiting for the container")
+	}
+
+	// The stream ends with the container, flush what is left of it.
+	if err := <-output; err != nil {
+		return 0, errors.Wrap(err, "failed reading the output of the container")
+	}
+
+	return exitCode, nil
+}
+
+// runExec runs a command in a running container with the given streams
+// attached to it, and returns its exit code.
+func runExec(docker *dockerClient, container string, cmd []string, tty bool, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	id, err := docker.createExec(container, execConfig{
+		Cmd:          cmd,
+		Tty:          tty,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	conn, err := docker.startExec(id, tty)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	go func() {
+		_, _ = io.Copy(conn, stdin)
+		_ = conn.CloseWrite()
+	}()
+
+	if tty {
+		if width, height, err := term.GetSize(int(os.Stdout.Fd())); err == nil {
+			_ = docker.resizeExec(id, height, width)
+		}
+		_, err = io.Copy(stdout, conn)
+	} else {
+		err = demuxStream(conn, stdout, stderr)
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "failed reading the output of the command")
+	}
+
+	return docker.inspectExec(id)
+}
+
+// forwardSignals passes the signals received by the CLI on to the container,
+// until the channel is closed.
+func forwardSignals(docker *dockerClient, id string, signals <-chan os.Signal) {
+	for sig := range signals {
+		name := "SIGTERM"
+		if sig == os.Interrupt {
+			name = "SIGINT"
+		}
+		_ = docker.killContainer(id, name)
+	}
 }
 
 // The `local execute` command proxies execution to the picard docker container,
@@ -106,6 +381,12 @@ func AddFlagsForDocumentation(flags *pflag.FlagSet) {
 	flags.String("job", "build", "job to be executed")
 	flags.Int("node-total", 1, "total number of parallel nodes")
 	flags.Int("index", 0, "node index of parallelism")
+	flags.String("executor", ExecutorContainer, fmt.Sprintf("where to run the job: %s runs it in the build agent container, %s runs its steps on the host", ExecutorContainer, ExecutorShell))
+	flags.Bool("debug-on-failure", false, "when a step fails, open a shell in the job container before it stops")
+	flags.String("break-before", "", "pause before the step with this name or type, and open a shell in the job container")
+	flags.Bool("no-cache", false, "skip the save_cache and restore_cache steps, instead of using the caches kept in ~/.circleci/local-cache")
+	flags.String("output-dir", "", "copy the paths of the store_artifacts and store_test_results steps to this directory, and summarize the test results")
+	flags.Bool("all-nodes", false, "run every parallel node of the job at once, with the parallelism of the job unless --node-total is set")
 	flags.Bool("skip-checkout", true, "use local path as-is")
 	flags.StringArrayP("volume", "v", nil, "Volume bind-mounting")
 	flags.String("checkout-key", "~/.ssh/id_rsa", "Git Checkout key")
@@ -115,10 +396,29 @@ func AddFlagsForDocumentation(flags *pflag.FlagSet) {
 	flags.StringArrayP("env", "e", nil, "Set environment variables, e.g. `-e VAR=VAL`")
 }
 
+// consumedFlags are the flags of `local execute` that this program handles
+// rather than build-agent.
+var consumedFlags = map[string]bool{
+	"org-slug":         true,
+	"org-id":           true,
+	"config":           true,
+	"debug":            true,
+	"runtime":          true,
+	"agent-image":      true,
+	"pull":             true,
+	"env-file":         true,
+	"context-file":     true,
+	"all-nodes":        true,
+	"output-dir":       true,
+	"no-cache":         true,
+	"debug-on-failure": true,
+	"break-before":     true,
+	"executor":         true,
+}
+
 // Given the full set of flags that were passed to this command, return the path
 // to the config file, and the list of supplied args _except_ for the `--config`
-// or `-c` argument, and except for --debug and --org-slug which are consumed by
-// this program.
+// or `-c` argument, and except for the other consumedFlags.
 // The `build-agent` can only deal with config version 2.0. In order to feed
 // version 2.0 config to it, we need to process the supplied config file using the
 // GraphQL API, and feed the result of that into `build-agent`. The first step of
@@ -130,7 +430,7 @@ func buildAgentArguments(flags *pflag.FlagSet) ([]string, string) {
 
 	// build a list of all supplied flags, that we will pass on to build-agent
 	flags.Visit(func(flag *pflag.Flag) {
-		if flag.Name != "org-slug" && flag.Name != "config" && flag.Name != "debug" && flag.Name != "org-id" {
+		if !consumedFlags[flag.Name] {
 			result = append(result, unparseFlag(flags, flag)...)
 		}
 	})
@@ -141,58 +441,107 @@ func buildAgentArguments(flags *pflag.FlagSet) ([]string, string) {
 	return result, configPath
 }
 
-func picardImage(output io.Writer) (string, error) {
+// Values of the --pull flag, setting when the build agent image is pulled.
+const (
+	PullAlways  = "always"
+	PullMissing = "missing"
+	PullNever   = "never"
+)
+
+// PullPolicies lists the values of the --pull flag.
+var PullPolicies = []string{PullAlways, PullMissing, PullNever}
 
-	fmt.Fprintf(output, "Fetching latest build environment...\n")
-	sha, err := findLatestPicardSha()
+// AddAgentImageFlags adds the flags choosing the build agent image.
+func AddAgentImageFlags(flags *pflag.FlagSet) {
+	flags.String("agent-image", "", fmt.Sprintf("build agent image to run, as an image, a tag or a digest (default %s)", picardRepo))
+	flags.String("pull", PullAlways, fmt.Sprintf("when to pull the build agent image, one of: %s", strings.Join(PullPolicies, ", ")))
+}
 
-	if err != nil {
-		return "", err
+func picardImage(output io.Writer, runtime containerRuntime, flags *pflag.FlagSet) (string, error) {
+	image, _ := flags.GetString("agent-image")
+	policy, _ := flags.GetString("pull")
+
+	cache := &settings.AgentImage{}
+	if err := cache.Load(); err != nil {
+		return "", errors.Wrap(err, "failed to read the cached digests of the build agent image")
 	}
 
-	_, _ = fmt.Fprintf(output, "Docker image digest: %s\n", sha)
-	return fmt.Sprintf("%s@%s", picardRepo, sha), nil
+	return resolveAgentImage(output, runtime, cache, image, policy)
 }
 
-func ensureDockerIsAvailable() (string, error) {
-
-	dockerPath, err := exec.LookPath("docker")
+// resolveAgentImage returns the build agent image pinned to a digest. Unless
+// the image is already pinned, its digest is read from the local image after
+// pulling it according to the policy. When the image can't be pulled, or
+// isn't available locally, the digest it was last resolved to is used.
+func resolveAgentImage(output io.Writer, runtime containerRuntime, cache *settings.AgentImage, image, policy string) (string, error) {
+	switch policy {
+	case PullAlways, PullMissing, PullNever:
+	default:
+		return "", fmt.Errorf("unknown pull policy `%s`, expected one of: %s", policy, strings.Join(PullPolicies, ", "))
+	}
 
-	if err != nil {
-		return "", errors.New("could not find `docker` on the PATH; please ensure that docker is installed")
+	if image == "" {
+		image = picardRepo
+	} else if strings.HasPrefix(image, "sha256:") {
+		image = fmt.Sprintf("%s@%s", picardRepo, image)
 	}
 
-	dockerRunning := exec.Command(dockerPath, "version").Run() == nil // #nosec
+	repo, tag := splitTag(image)
+	_, inspectErr := runtime.repoDigests(image)
 
-	if !dockerRunning {
-		return "", errors.New("failed to connect to docker; please ensure that docker is running, and that `docker version` succeeds")
+	if strings.HasPrefix(tag, "sha256:") {
+		if inspectErr != nil && policy != PullNever {
+			fmt.Fprintf(output, "Fetching build environment %s...\n", image)
+			if err := runtime.pull(image); err != nil {
+				return "", err
+			}
+		}
+		return image, nil
 	}
 
-	return dockerPath, nil
-}
+	var pullErr error
+	if policy == PullAlways || policy == PullMissing && inspectErr != nil {
+		fmt.Fprintf(output, "Fetching latest build environment...\n")
+		if pullErr = runtime.pull(image); pullErr != nil {
+			fmt.Fprintf(output, "Warning: %s\n", pullErr)
+		}
+	}
 
-// Still depends on a function in cmd/build.go
-func findLatestPicardSha() (string, error) {
+	digests, err := runtime.repoDigests(image)
+	if err == nil {
+		var digest string
+		if digest, err = digestOf(repo, digests); err == nil {
+			if err := cacheDigest(cache, image, digest); err != nil {
+				return "", err
+			}
+			_, _ = fmt.Fprintf(output, "Docker image digest: %s\n", digest)
+			return fmt.Sprintf("%s@%s", repo, digest), nil
+		}
+	}
 
-	if _, err := ensureDockerIsAvailable(); err != nil {
-		return "", err
+	digest, ok := cache.Digests[image]
+	if !ok {
+		if pullErr != nil {
+			return "", pullErr
+		}
+		return "", errors.Wrapf(err, "%s is not available locally", image)
 	}
 
-	outputBytes, err := exec.Command("docker", "pull", picardRepo).CombinedOutput() // #nosec
+	_, _ = fmt.Fprintf(output, "Using the cached docker image digest: %s\n", digest)
+	return fmt.Sprintf("%s@%s", repo, digest), nil
+}
 
-	if err != nil {
-		return "", errors.Wrap(err, "failed to pull latest docker image")
+func cacheDigest(cache *settings.AgentImage, image, digest string) error {
+	if cache.Digests[image] == digest {
+		return nil
 	}
 
-	output := string(outputBytes)
-	sha256 := regexp.MustCompile("(?m)sha256:[0-9a-f]+")
-	latest := sha256.FindString(output)
-
-	if latest == "" {
-		return "", fmt.Errorf("failed to parse sha256 from docker pull output")
+	if cache.Digests == nil {
+		cache.Digests = map[string]string{}
 	}
+	cache.Digests[image] = digest
 
-	return latest, nil
+	return errors.Wrap(cache.WriteToDisk(), "failed to cache the digest of the build agent image")
 }
 
 // Write data to a temp file, and return the path to that file.
@@ -216,16 +565,27 @@ func writeStringToTempFile(data string) (string, error) {
 	return f.Name(), nil
 }
 
-func generateDockerCommand(configPath, image, pwd string, arguments ...string) []string {
+func generateContainerConfig(configPath, image, pwd, socketBind string, tty bool, arguments ...string) containerConfig {
 	const configPathInsideContainer = "/tmp/local_build_config.yml"
-	core := []string{"docker", "run", "--interactive", "--tty", "--rm",
-		"--volume", "/var/run/docker.sock:/var/run/docker.sock",
-		"--volume", fmt.Sprintf("%s:%s", configPath, configPathInsideContainer),
-		"--volume", fmt.Sprintf("%s:%s", pwd, pwd),
-		"--volume", fmt.Sprintf("%s:/root/.circleci", settings.SettingsPath()),
-		"--workdir", pwd,
-		image, "circleci", "build", "--config", configPathInsideContainer}
-	return append(core, arguments...)
+	return containerConfig{
+		Image:        image,
+		Cmd:          append([]string{"circleci", "build", "--config", configPathInsideContainer}, arguments...),
+		WorkingDir:   pwd,
+		Tty:          tty,
+		OpenStdin:    true,
+		StdinOnce:    true,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		HostConfig: hostConfig{
+			Binds: []string{
+				socketBind,
+				fmt.Sprintf("%s:%s", configPath, configPathInsideContainer),
+				fmt.Sprintf("%s:%s", pwd, pwd),
+				fmt.Sprintf("%s:/root/.circleci", settings.SettingsPath()),
+			},
+		},
+	}
 }
 
 // Convert the given flag back into a list of strings suitable to be passed on
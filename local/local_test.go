@@ -14,23 +14,23 @@ var _ = Describe("build", func() {
 
 	Describe("invoking docker", func() {
 
-		It("can generate a command line", func() {
+		It("can generate a container config", func() {
 			home, err := os.UserHomeDir()
 			Expect(err).NotTo(HaveOccurred())
-			Expect(generateDockerCommand("/config/path", "docker-image-name", "/current/directory", "extra-1", "extra-2")).To(ConsistOf(
-				"docker",
-				"run",
-				"--interactive",
-				"--tty",
-				"--rm",
-				"--volume", "/var/run/docker.sock:/var/run/docker.sock",
-				"--volume", "/config/path:/tmp/local_build_config.yml",
-				"--volume", "/current/directory:/current/directory",
-				"--volume", home+"/.circleci:/root/.circleci",
-				"--workdir", "/current/directory",
-				"docker-image-name", "circleci", "build",
+			config := generateContainerConfig("/config/path", "docker-image-name", "/current/directory", "/var/run/docker.sock:/var/run/docker.sock", true, "extra-1", "extra-2")
+			Expect(config.Image).To(Equal("docker-image-name"))
+			Expect(config.Cmd).To(Equal([]string{
+				"circleci", "build",
 				"--config", "/tmp/local_build_config.yml",
 				"extra-1", "extra-2",
+			}))
+			Expect(config.WorkingDir).To(Equal("/current/directory"))
+			Expect(config.Tty).To(BeTrue())
+			Expect(config.HostConfig.Binds).To(ConsistOf(
+				"/var/run/docker.sock:/var/run/docker.sock",
+				"/config/path:/tmp/local_build_config.yml",
+				"/current/directory:/current/directory",
+				home+"/.circleci:/root/.circleci",
 			))
 		})
 
@@ -47,6 +47,8 @@ var _ = Describe("build", func() {
 		makeFlags := func(args []string) (*pflag.FlagSet, error) {
 			flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
 			AddFlagsForDocumentation(flags)
+			AddAgentImageFlags(flags)
+			AddEnvironmentFlags(flags)
 			// add a 'debug' flag - the build command will inherit this from the
 			// root command when not testing in isolation.
 			flags.Bool("debug", false, "Enable debug logging.")
@@ -97,6 +99,12 @@ var _ = Describe("build", func() {
 				expectedArgs:       []string{"--index", "9", "--job", "horse", "d"},
 			}),
 
+			Entry("agent image and env files", TestCase{
+				input:              []string{"--agent-image", "sha256:abc", "--pull=never", "--env-file", ".env", "--job", "horse"},
+				expectedConfigPath: ".circleci/config.yml",
+				expectedArgs:       []string{"--job", "horse"},
+			}),
+
 			Entry("many args, multiple envs", TestCase{
 				input:              []string{"--env", "foo", "--env", "bar", "--env", "baz"},
 				expectedConfigPath: ".circleci/config.yml",
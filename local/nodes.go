@@ -0,0 +1,111 @@
+package local
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// jobParallelism reads the number of parallel nodes of a job from a compiled
+// config.
+func jobParallelism(compiled, job string) (int, error) {
+	var config struct {
+		Jobs map[string]struct {
+			Parallelism int `yaml:"parallelism"`
+		} `yaml:"jobs"`
+	}
+	if err := yaml.Unmarshal([]byte(compiled), &config); err != nil {
+		return 0, errors.Wrap(err, "Unable to parse the compiled config")
+	}
+
+	definition, ok := config.Jobs[job]
+	if !ok {
+		return 0, fmt.Errorf("no job named `%s` in the config", job)
+	}
+
+	if definition.Parallelism < 1 {
+		return 1, nil
+	}
+	return definition.Parallelism, nil
+}
+
+// withoutFlags removes the given flags, and their values, from build-agent
+// arguments.
+func withoutFlags(arguments []string, names ...string) []string {
+	result := []string{}
+	for i := 0; i < len(arguments); i++ {
+		removed := false
+		for _, name := range names {
+			if arguments[i] == "--"+name {
+				removed = true
+			}
+		}
+
+		if removed {
+			i++
+			continue
+		}
+		result = append(result, arguments[i])
+	}
+	return result
+}
+
+// runAllNodes runs every node of a parallel job at the same time, each with
+// its own `CIRCLE_NODE_INDEX`. Their output is prefixed with the node index.
+// The exit code is the one of the first node that failed.
+func runAllNodes(total int, stdout, stderr io.Writer, run func(index int, stdout, stderr io.Writer) (int, error)) error {
+	var output sync.Mutex
+	var wait sync.WaitGroup
+
+	codes := make([]int, total)
+	errs := make([]error, total)
+	results := make([]*jobResult, total)
+
+	for index := 0; index < total; index++ {
+		wait.Add(1)
+		go func(index int) {
+			defer wait.Done()
+
+			name := fmt.Sprintf("node %d", index)
+			nodeStdout := newPrefixWriter(stdout, name, &output)
+			nodeStderr := newPrefixWriter(stderr, name, &output)
+
+			start := time.Now()
+			codes[index], errs[index] = run(index, nodeStdout, nodeStderr)
+			_ = nodeStdout.Flush()
+			_ = nodeStderr.Flush()
+
+			status := statusSuccess
+			if errs[index] != nil || codes[index] != 0 {
+				status = statusFailed
+			}
+			results[index] = &jobResult{name: name, status: status, duration: time.Since(start)}
+		}(index)
+	}
+	wait.Wait()
+
+	printWorkflowSummary(stdout, results)
+
+	var failures []string
+	for index, err := range errs {
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("node %d: %s", index, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to run all the nodes:\n%s", strings.Join(failures, "\n"))
+	}
+
+	for _, code := range codes {
+		if code != 0 {
+			return &ExitError{Code: code}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,61 @@
+package local
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("parallel nodes", func() {
+	It("reads the parallelism of the job", func() {
+		compiled := `jobs:
+  test:
+    parallelism: 4
+  lint: {}
+`
+		Expect(jobParallelism(compiled, "test")).To(Equal(4))
+		Expect(jobParallelism(compiled, "lint")).To(Equal(1))
+
+		_, err := jobParallelism(compiled, "build")
+		Expect(err).To(MatchError("no job named `build` in the config"))
+	})
+
+	It("removes flags from the build-agent arguments", func() {
+		Expect(withoutFlags(
+			[]string{"--env", "A=1", "--index", "2", "--job", "test", "--node-total", "3", "extra"},
+			"index", "node-total",
+		)).To(Equal([]string{"--env", "A=1", "--job", "test", "extra"}))
+	})
+
+	It("runs every node and aggregates their exit codes", func() {
+		var stdout, stderr bytes.Buffer
+		err := runAllNodes(3, &stdout, &stderr, func(index int, stdout, stderr io.Writer) (int, error) {
+			fmt.Fprintf(stdout, "running tests of node %d\n", index)
+			if index == 1 {
+				fmt.Fprintln(stderr, "1 test failed")
+				return 2, nil
+			}
+			return 0, nil
+		})
+
+		Expect(err).To(MatchError("the job exited with code 2"))
+		Expect(stdout.String()).To(ContainSubstring("[node 0] running tests of node 0\n"))
+		Expect(stdout.String()).To(ContainSubstring("[node 2] running tests of node 2\n"))
+		Expect(stdout.String()).To(MatchRegexp(`node 1 +\| failed`))
+		Expect(stderr.String()).To(Equal("[node 1] 1 test failed\n"))
+	})
+
+	It("reports nodes that could not run", func() {
+		err := runAllNodes(2, io.Discard, io.Discard, func(index int, _, _ io.Writer) (int, error) {
+			if index == 0 {
+				return 0, fmt.Errorf("failed to create the container")
+			}
+			return 1, nil
+		})
+
+		Expect(err).To(MatchError("failed to run all the nodes:\nnode 0: failed to create the container"))
+	})
+})
@@ -0,0 +1,209 @@
+package local
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+)
+
+// outputMount is where the output directory is mounted in the container of
+// the job.
+const outputMount = "/tmp/circleci-output"
+
+// slowestTests is the number of tests listed by the summary of the test results.
+const slowestTests = 5
+
+// emulateOutput replaces the store_artifacts and store_test_results steps of
+// the compiled config, which picard skips, with steps copying their paths to
+// the output directory. They run even when the job fails, as the results of
+// failing tests matter most.
+func emulateOutput(compiled string) (string, error) {
+	return rewriteSteps(compiled, nil, func(name string, options map[string]interface{}) (map[string]interface{}, error) {
+		source, _ := options["path"].(string)
+
+		var step map[string]interface{}
+		switch name {
+		case "store_artifacts":
+			destination, _ := options["destination"].(string)
+			if destination == "" {
+				destination = path.Base(source)
+			}
+			step = runStep("Uploading artifacts", copyOutCommand(source, path.Join(outputMount, "artifacts", destination)))
+		case "store_test_results":
+			step = runStep("Uploading test results", copyOutCommand(source, path.Join(outputMount, "test-results", path.Base(source))))
+		default:
+			return nil, nil
+		}
+
+		step["run"].(map[string]interface{})["when"] = "always"
+		return step, nil
+	})
+}
+
+func copyOutCommand(source, destination string) string {
+	return fmt.Sprintf(`src=%s
+dest=%s
+if [ -d "$src" ]; then
+  mkdir -p "$dest" && cp -R "$src"/. "$dest"
+elif [ -e "$src" ]; then
+  mkdir -p "$(dirname "$dest")" && cp "$src" "$dest"
+else
+  echo "$src does not exist, skipping"
+fi`, shellPath(source), quote(destination))
+}
+
+// outputArguments returns the build-agent arguments mounting dir, created
+// when missing, as the output directory of the job.
+func outputArguments(dir string) ([]string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(abs, 0755); err != nil {
+		return nil, errors.Wrap(err, "Error creating the output directory")
+	}
+
+	return []string{"--volume", fmt.Sprintf("%s:%s", abs, outputMount)}, nil
+}
+
+type testCase struct {
+	Name      string    `xml:"name,attr"`
+	Classname string    `xml:"classname,attr"`
+	Time      float64   `xml:"time,attr"`
+	Failure   *struct{} `xml:"failure"`
+	Error     *struct{} `xml:"error"`
+	Skipped   *struct{} `xml:"skipped"`
+}
+
+func (t testCase) String() string {
+	if t.Classname == "" {
+		return t.Name
+	}
+	return fmt.Sprintf("%s %s", t.Classname, t.Name)
+}
+
+func (t testCase) failed() bool {
+	return t.Failure != nil || t.Error != nil
+}
+
+// readTestResults reads the test cases of the JUnit reports copied under dir.
+func readTestResults(dir string) ([]testCase, error) {
+	var tests []testCase
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		// Only the reports, artifacts may hold any XML file.
+		rel, _ := filepath.Rel(dir, path)
+		if info.IsDir() || filepath.Ext(path) != ".xml" || !strings.Contains(filepath.ToSlash(rel), "test-results/") {
+			return nil
+		}
+
+		found, err := readJUnit(path)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to parse the test results in %s", path)
+		}
+		tests = append(tests, found...)
+		return nil
+	})
+
+	return tests, err
+}
+
+// readJUnit reads the test cases of a report, however deeply they are nested
+// in test suites.
+func readJUnit(path string) ([]testCase, error) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var tests []testCase
+	decoder := xml.NewDecoder(file)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return tests, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if start, ok := token.(xml.StartElement); ok && start.Name.Local == "testcase" {
+			var test testCase
+			if err := decoder.DecodeElement(&test, &start); err != nil {
+				return nil, err
+			}
+			tests = append(tests, test)
+		}
+	}
+}
+
+// printTestSummary prints the number of tests, those that failed and the
+// slowest ones.
+func printTestSummary(w io.Writer, tests []testCase) {
+	var failed []testCase
+	skipped := 0
+	for _, test := range tests {
+		if test.failed() {
+			failed = append(failed, test)
+		} else if test.Skipped != nil {
+			skipped++
+		}
+	}
+
+	fmt.Fprintf(w, "\nTest results: %d tests, %d failed, %d skipped\n", len(tests), len(failed), skipped)
+	if len(tests) == 0 {
+		return
+	}
+
+	if len(failed) > 0 {
+		fmt.Fprintln(w, "\nFailed tests:")
+		for _, test := range failed {
+			fmt.Fprintf(w, "  %s\n", test)
+		}
+	}
+
+	slowest := append([]testCase{}, tests...)
+	sort.SliceStable(slowest, func(i, j int) bool {
+		return slowest[i].Time > slowest[j].Time
+	})
+	if len(slowest) > slowestTests {
+		slowest = slowest[:slowestTests]
+	}
+
+	fmt.Fprintln(w, "\nSlowest tests:")
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Test", "Time"})
+	for _, test := range slowest {
+		table.Append([]string{test.String(), fmt.Sprintf("%.3fs", test.Time)})
+	}
+	table.Render()
+}
+
+// summarizeOutput prints where the output of the job was copied to, and the
+// summary of its test results.
+func summarizeOutput(w io.Writer, dir string) error {
+	tests, err := readTestResults(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "\nArtifacts and test results were copied to %s\n", dir)
+	printTestSummary(w, tests)
+	return nil
+}
@@ -0,0 +1,102 @@
+package local
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("output", func() {
+	It("replaces the store steps with copies to the output directory", func() {
+		emulated, err := emulateOutput(`jobs:
+  test:
+    steps:
+      - run:
+          command: make test
+      - store_test_results:
+          path: test-results
+      - store_artifacts:
+          path: ~/project/coverage.html
+          destination: reports/coverage.html
+`)
+		Expect(err).NotTo(HaveOccurred())
+
+		var config struct {
+			Jobs map[string]struct {
+				Steps []map[string]map[string]string `yaml:"steps"`
+			} `yaml:"jobs"`
+		}
+		Expect(yaml.Unmarshal([]byte(emulated), &config)).To(Succeed())
+
+		steps := config.Jobs["test"].Steps
+		Expect(steps).To(HaveLen(3))
+
+		Expect(steps[1]["run"]["when"]).To(Equal("always"))
+		Expect(steps[1]["run"]["command"]).To(HavePrefix("src='test-results'\ndest='/tmp/circleci-output/test-results/test-results'\n"))
+
+		Expect(steps[2]["run"]["name"]).To(Equal("Uploading artifacts"))
+		Expect(steps[2]["run"]["command"]).To(HavePrefix("src=\"$HOME\"'/project/coverage.html'\ndest='/tmp/circleci-output/artifacts/reports/coverage.html'\n"))
+	})
+
+	Describe("test results", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "circleci-output")
+			Expect(err).NotTo(HaveOccurred())
+
+			results := filepath.Join(dir, "node-0", "test-results", "jest")
+			Expect(os.MkdirAll(results, 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(results, "results.xml"), []byte(`<?xml version="1.0"?>
+<testsuites>
+  <testsuite name="api">
+    <testcase classname="api" name="lists users" time="0.5"/>
+    <testcase classname="api" name="creates users" time="2.25">
+      <failure message="expected 201">stack</failure>
+    </testcase>
+    <testsuite name="nested">
+      <testcase classname="api.nested" name="is skipped" time="0"><skipped/></testcase>
+    </testsuite>
+  </testsuite>
+</testsuites>
+`), 0600)).To(Succeed())
+
+			artifacts := filepath.Join(dir, "node-0", "artifacts")
+			Expect(os.MkdirAll(artifacts, 0700)).To(Succeed())
+			Expect(ioutil.WriteFile(filepath.Join(artifacts, "sitemap.xml"), []byte("not a report <"), 0600)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(os.RemoveAll(dir)).To(Succeed())
+		})
+
+		It("reads the test cases of the reports", func() {
+			tests, err := readTestResults(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(tests).To(HaveLen(3))
+			Expect(tests[1].failed()).To(BeTrue())
+			Expect(tests[2].Skipped).NotTo(BeNil())
+		})
+
+		It("summarizes the test results", func() {
+			var out bytes.Buffer
+			Expect(summarizeOutput(&out, dir)).To(Succeed())
+
+			Expect(out.String()).To(ContainSubstring("Test results: 3 tests, 1 failed, 1 skipped"))
+			Expect(out.String()).To(ContainSubstring("Failed tests:\n  api creates users\n"))
+			Expect(out.String()).To(MatchRegexp(`(?s)Slowest tests:.*api creates users +\| 2\.250s.*api lists users +\| 0\.500s`))
+		})
+
+		It("copes with jobs that stored no test results", func() {
+			var out bytes.Buffer
+			Expect(summarizeOutput(&out, filepath.Join(dir, "missing"))).To(Succeed())
+			Expect(out.String()).To(ContainSubstring("Test results: 0 tests, 0 failed, 0 skipped"))
+		})
+	})
+})
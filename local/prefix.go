@@ -0,0 +1,52 @@
+package local
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// prefixWriter prefixes each line written to it, so that the output of jobs
+// running side by side can be told apart. Writers sharing a lock never
+// interleave their lines.
+type prefixWriter struct {
+	w      io.Writer
+	prefix []byte
+	lock   *sync.Mutex
+	buf    bytes.Buffer
+}
+
+func newPrefixWriter(w io.Writer, prefix string, lock *sync.Mutex) *prefixWriter {
+	return &prefixWriter{w: w, prefix: []byte("[" + prefix + "] "), lock: lock}
+}
+
+func (p *prefixWriter) Write(data []byte) (int, error) {
+	p.buf.Write(data)
+
+	for {
+		i := bytes.IndexByte(p.buf.Bytes(), '\n')
+		if i < 0 {
+			return len(data), nil
+		}
+
+		if err := p.writeLine(p.buf.Next(i + 1)); err != nil {
+			return len(data), err
+		}
+	}
+}
+
+// Flush writes what is left of an unterminated last line.
+func (p *prefixWriter) Flush() error {
+	if p.buf.Len() == 0 {
+		return nil
+	}
+	return p.writeLine(append(p.buf.Next(p.buf.Len()), '\n'))
+}
+
+func (p *prefixWriter) writeLine(line []byte) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	_, err := p.w.Write(append(append([]byte{}, p.prefix...), line...))
+	return err
+}
@@ -0,0 +1,335 @@
+package local
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Names of the supported container runtimes.
+const (
+	Docker  = "docker"
+	Podman  = "podman"
+	Nerdctl = "nerdctl"
+)
+
+// Runtimes lists the supported container runtimes, in the order they are
+// looked for when none is chosen.
+var Runtimes = []string{Docker, Podman, Nerdctl}
+
+// containerRuntime runs the picard container, which in turn starts the
+// containers of the job through the runtime socket mounted into it.
+type containerRuntime interface {
+	name() string
+	// socketBind is the volume mounting the runtime socket into picard.
+	socketBind() string
+	// pull fetches the image from its registry.
+	pull(image string) error
+	// repoDigests returns the digests of an image present locally, as
+	// `repo@sha256:...`.
+	repoDigests(image string) ([]string, error)
+	run(container containerConfig, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+	// exec runs a command in a running container, with the given streams
+	// attached to it, and returns its exit code.
+	exec(container string, cmd []string, tty bool, stdin io.Reader, stdout, stderr io.Writer) (int, error)
+}
+
+// newRuntime returns the runtime with the given name, or the first one
+// available when name is empty.
+func newRuntime(name string) (containerRuntime, error) {
+	switch name {
+	case Docker:
+		return dockerRuntime()
+	case Podman:
+		return podmanRuntime()
+	case Nerdctl:
+		return nerdctlRuntime()
+	case "":
+	default:
+		return nil, fmt.Errorf("unknown runtime `%s`, expected one of: %s", name, strings.Join(Runtimes, ", "))
+	}
+
+	for _, detect := range []func() (containerRuntime, error){dockerRuntime, podmanRuntime, nerdctlRuntime} {
+		if runtime, err := detect(); err == nil {
+			return runtime, nil
+		}
+	}
+
+	return nil, errors.New("could not find a container runtime; please ensure that docker, podman or nerdctl is installed and running, or choose one with --runtime")
+}
+
+// engineRuntime is a runtime serving the Docker Engine API, which Podman
+// also implements.
+type engineRuntime struct {
+	runtimeName string
+	client      *dockerClient
+	// socket is the path of the API socket on the host of the daemon, which
+	// is mounted into picard.
+	socket string
+	// securityOpt is added to the picard container.
+	securityOpt []string
+}
+
+func dockerRuntime() (containerRuntime, error) {
+	endpoint, err := findDockerEndpoint()
+	if err != nil {
+		return nil, err
+	}
+
+	// Volumes are mounted from the host of the daemon, where the daemon
+	// listens on the standard socket. Only a socket chosen with DOCKER_HOST,
+	// such as the one of a rootless daemon, is known to be on that host too;
+	// the socket of a context is often forwarded from a VM.
+	socket := defaultDockerSocket
+
+	var client *dockerClient
+	switch {
+	case strings.HasPrefix(endpoint.host, "unix://"):
+		client = newDockerClient(strings.TrimPrefix(endpoint.host, "unix://"))
+		if endpoint.fromEnv {
+			socket = client.address
+		}
+	case strings.HasPrefix(endpoint.host, "tcp://") && !endpoint.tls:
+		client = newDockerTCPClient(strings.TrimPrefix(endpoint.host, "tcp://"))
+	default:
+		// SSH and TLS endpoints are left to the docker CLI.
+		return dockerCLIRuntime()
+	}
+
+	if err := client.ping(); err != nil {
+		return nil, errors.Wrap(err, "failed to connect to docker; please ensure that docker is running")
+	}
+
+	return &engineRuntime{runtimeName: Docker, client: client, socket: socket}, nil
+}
+
+func dockerCLIRuntime() (containerRuntime, error) {
+	path, err := exec.LookPath("docker")
+	if err != nil {
+		return nil, errors.New("could not find `docker` on the PATH, which is needed to reach a daemon over SSH or TLS")
+	}
+
+	if err := exec.Command(path, "version").Run(); err != nil { // #nosec
+		return nil, errors.Wrap(err, "failed to connect to docker; please ensure that docker is running")
+	}
+
+	return &cliRuntime{
+		runtimeName: Docker,
+		path:        path,
+		bind:        fmt.Sprintf("%s:%s", defaultDockerSocket, defaultDockerSocket),
+	}, nil
+}
+
+func podmanRuntime() (containerRuntime, error) {
+	for _, socket := range podmanSockets() {
+		client := newDockerClient(socket)
+		if client.ping() == nil {
+			return &engineRuntime{
+				runtimeName: Podman,
+				client:      client,
+				socket:      socket,
+				// Otherwise SELinux denies picard access to the socket.
+				securityOpt: []string{"label=disable"},
+			}, nil
+		}
+	}
+
+	return nil, errors.New("failed to connect to podman; please ensure that its API socket is running, for example with `systemctl --user start podman.socket`")
+}
+
+// podmanSockets lists the places the Podman API socket is found at, rootless
+// ones first.
+func podmanSockets() []string {
+	var sockets []string
+
+	if host := os.Getenv("CONTAINER_HOST"); strings.HasPrefix(host, "unix://") {
+		sockets = append(sockets, strings.TrimPrefix(host, "unix://"))
+	}
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sockets = append(sockets, filepath.Join(dir, "podman", "podman.sock"))
+	}
+
+	return append(sockets,
+		fmt.Sprintf("/run/user/%d/podman/podman.sock", os.Getuid()),
+		"/run/podman/podman.sock",
+	)
+}
+
+func nerdctlRuntime() (containerRuntime, error) {
+	path, err := exec.LookPath("nerdctl")
+	if err != nil {
+		return nil, errors.New("could not find `nerdctl` on the PATH")
+	}
+
+	if err := exec.Command(path, "version").Run(); err != nil { // #nosec
+		return nil, errors.Wrap(err, "failed to connect to containerd; please ensure that it is running")
+	}
+
+	// containerd serves no Docker Engine API, which picard needs to start the
+	// containers of the job, so it is reached through nerdctld.
+	for _, socket := range nerdctlSockets() {
+		if newDockerClient(socket).ping() == nil {
+			return &cliRuntime{
+				runtimeName: Nerdctl,
+				path:        path,
+				bind:        fmt.Sprintf("%s:%s", socket, defaultDockerSocket),
+			}, nil
+		}
+	}
+
+	return nil, errors.New("failed to connect to nerdctld, which serves the Docker Engine API the build agent needs; please ensure that it is running, for example with `systemctl --user start nerdctld.socket`")
+}
+
+// nerdctlSockets lists the places the nerdctld socket is found at, rootless
+// ones first.
+func nerdctlSockets() []string {
+	var sockets []string
+
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		sockets = append(sockets, filepath.Join(dir, "nerdctl.sock"))
+	}
+
+	return append(sockets,
+		fmt.Sprintf("/run/user/%d/nerdctl.sock", os.Getuid()),
+		"/var/run/nerdctl.sock",
+	)
+}
+
+func (r *engineRuntime) name() string {
+	return r.runtimeName
+}
+
+func (r *engineRuntime) socketBind() string {
+	return fmt.Sprintf("%s:%s", r.socket, defaultDockerSocket)
+}
+
+func (r *engineRuntime) pull(image string) error {
+	return errors.Wrapf(r.client.pull(image), "failed to pull %s", image)
+}
+
+func (r *engineRuntime) repoDigests(image string) ([]string, error) {
+	return r.client.repoDigests(image)
+}
+
+func (r *engineRuntime) run(container containerConfig, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	container.HostConfig.SecurityOpt = r.securityOpt
+	return runContainer(r.client, container, stdin, stdout, stderr)
+}
+
+func (r *engineRuntime) exec(container string, cmd []string, tty bool, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	return runExec(r.client, container, cmd, tty, stdin, stdout, stderr)
+}
+
+// cliRuntime drives a runtime through its docker-compatible command line,
+// which reaches daemons the API client does not.
+type cliRuntime struct {
+	runtimeName string
+	path        string
+	// bind mounts the runtime socket into picard.
+	bind string
+}
+
+func (c *cliRuntime) name() string {
+	return c.runtimeName
+}
+
+func (c *cliRuntime) socketBind() string {
+	return c.bind
+}
+
+func (c *cliRuntime) pull(image string) error {
+	if output, err := exec.Command(c.path, "pull", "--quiet", image).CombinedOutput(); err != nil { // #nosec
+		return errors.Wrapf(err, "failed to pull %s: %s", image, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func (c *cliRuntime) repoDigests(image string) ([]string, error) {
+	output, err := exec.Command(c.path, "image", "inspect", "--format", "{{json .RepoDigests}}", image).Output() // #nosec
+	if err != nil {
+		return nil, err
+	}
+
+	var digests []string
+	if err := json.Unmarshal(output, &digests); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse the digests of %s", image)
+	}
+	return digests, nil
+}
+
+func (c *cliRuntime) run(container containerConfig, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	cmd := exec.Command(c.path, cliArguments(container)...) // #nosec
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	// The container shares the terminal, so it receives signals like any
+	// other process in the foreground.
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to execute %s", c.runtimeName)
+	}
+
+	return 0, nil
+}
+
+func (c *cliRuntime) exec(container string, command []string, tty bool, stdin io.Reader, stdout, stderr io.Writer) (int, error) {
+	arguments := []string{"exec", "--interactive"}
+	if tty {
+		arguments = append(arguments, "--tty")
+	}
+
+	cmd := exec.Command(c.path, append(append(arguments, container), command...)...) // #nosec
+	cmd.Stdin = stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	err := cmd.Run()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to execute %s", c.runtimeName)
+	}
+
+	return 0, nil
+}
+
+func cliArguments(container containerConfig) []string {
+	arguments := []string{"run", "--rm", "--interactive"}
+	if container.Tty {
+		arguments = append(arguments, "--tty")
+	}
+	for _, bind := range container.HostConfig.Binds {
+		arguments = append(arguments, "--volume", bind)
+	}
+	arguments = append(arguments, "--workdir", container.WorkingDir, container.Image)
+	return append(arguments, container.Cmd...)
+}
+
+// digestOf finds the digest of repo among the `repo@sha256:...` digests of an
+// image. Runtimes may qualify the repository with its registry.
+func digestOf(repo string, digests []string) (string, error) {
+	for _, digest := range digests {
+		parts := strings.SplitN(digest, "@", 2)
+		if len(parts) == 2 && (parts[0] == repo || strings.HasSuffix(parts[0], "/"+repo)) {
+			return parts[1], nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to find the sha256 digest of %s", repo)
+}
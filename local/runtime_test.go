@@ -0,0 +1,74 @@
+package local
+
+import (
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("runtime", func() {
+	It("rejects unknown runtimes", func() {
+		_, err := newRuntime("rkt")
+		Expect(err).To(MatchError("unknown runtime `rkt`, expected one of: docker, podman, nerdctl"))
+	})
+
+	It("looks for the rootless podman socket first", func() {
+		previous, set := os.LookupEnv("XDG_RUNTIME_DIR")
+		Expect(os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")).To(Succeed())
+		defer func() {
+			if set {
+				os.Setenv("XDG_RUNTIME_DIR", previous)
+			} else {
+				os.Unsetenv("XDG_RUNTIME_DIR")
+			}
+		}()
+
+		sockets := podmanSockets()
+		Expect(sockets[0]).To(Equal("/run/user/1000/podman/podman.sock"))
+		Expect(sockets[len(sockets)-1]).To(Equal("/run/podman/podman.sock"))
+	})
+
+	It("mounts the podman socket where picard expects the docker one", func() {
+		runtime := &engineRuntime{runtimeName: Podman, socket: "/run/user/1000/podman/podman.sock"}
+		Expect(runtime.socketBind()).To(Equal("/run/user/1000/podman/podman.sock:/var/run/docker.sock"))
+	})
+
+	It("looks for the rootless nerdctld socket first", func() {
+		previous, set := os.LookupEnv("XDG_RUNTIME_DIR")
+		Expect(os.Setenv("XDG_RUNTIME_DIR", "/run/user/1000")).To(Succeed())
+		defer func() {
+			if set {
+				os.Setenv("XDG_RUNTIME_DIR", previous)
+			} else {
+				os.Unsetenv("XDG_RUNTIME_DIR")
+			}
+		}()
+
+		sockets := nerdctlSockets()
+		Expect(sockets[0]).To(Equal("/run/user/1000/nerdctl.sock"))
+		Expect(sockets[len(sockets)-1]).To(Equal("/var/run/nerdctl.sock"))
+	})
+
+	It("can generate a command line", func() {
+		container := generateContainerConfig("/config/path", "docker-image-name", "/current/directory", "/var/run/docker.sock:/var/run/docker.sock", false, "extra-1")
+		Expect(cliArguments(container)).To(Equal([]string{
+			"run", "--rm", "--interactive",
+			"--volume", "/var/run/docker.sock:/var/run/docker.sock",
+			"--volume", "/config/path:/tmp/local_build_config.yml",
+			"--volume", "/current/directory:/current/directory",
+			"--volume", container.HostConfig.Binds[3],
+			"--workdir", "/current/directory",
+			"docker-image-name", "circleci", "build",
+			"--config", "/tmp/local_build_config.yml",
+			"extra-1",
+		}))
+	})
+
+	It("finds digests qualified with a registry", func() {
+		Expect(digestOf("circleci/picard", []string{"docker.io/circleci/picard@sha256:abc"})).To(Equal("sha256:abc"))
+
+		_, err := digestOf("circleci/picard", []string{"example.com/other@sha256:abc"})
+		Expect(err).To(MatchError("failed to find the sha256 digest of circleci/picard"))
+	})
+})
@@ -0,0 +1,534 @@
+package local
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Values of the --executor flag.
+const (
+	ExecutorContainer = "container"
+	ExecutorShell     = "shell"
+)
+
+// defaultNoOutputTimeout is how long a step may run without output by default.
+const defaultNoOutputTimeout = 10 * time.Minute
+
+// defaultWorkingDirectory is the working directory of jobs setting none, as
+// on CircleCI.
+const defaultWorkingDirectory = "~/project"
+
+// shellJob is a job run by the shell executor.
+type shellJob struct {
+	name        string
+	steps       []interface{}
+	shell       string
+	environment map[string]string
+	// dir is the directory on the host standing for workingDirectory, the
+	// working directory of the job as set in the config.
+	dir              string
+	workingDirectory string
+	cacheDir         string
+	stdout           io.Writer
+	stderr           io.Writer
+}
+
+// shellStep holds the options of a `run` step.
+type shellStep struct {
+	Name             string            `yaml:"name"`
+	Command          string            `yaml:"command"`
+	Shell            string            `yaml:"shell"`
+	Environment      map[string]string `yaml:"environment"`
+	WorkingDirectory string            `yaml:"working_directory"`
+	When             string            `yaml:"when"`
+	NoOutputTimeout  string            `yaml:"no_output_timeout"`
+	Background       bool              `yaml:"background"`
+}
+
+// executeShell runs a job of the compiled config on the host, in the current
+// directory. The variables of env are set after those of the job.
+func executeShell(compiled, job string, env []string) error {
+	pwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	shellJob, err := newShellJob(compiled, job, pwd, env)
+	if err != nil {
+		return err
+	}
+
+	exitCode, err := shellJob.run()
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return &ExitError{Code: exitCode}
+	}
+	return nil
+}
+
+// shellEnvironment returns the variables the flags of build-agent set for the
+// job, after those of the contexts and env files.
+func shellEnvironment(flags *pflag.FlagSet, environment []string) []string {
+	var env []string
+	for i := 0; i+1 < len(environment); i += 2 {
+		env = append(env, environment[i+1])
+	}
+
+	for flag, variable := range map[string]string{
+		"branch":     "CIRCLE_BRANCH",
+		"revision":   "CIRCLE_SHA1",
+		"repo-url":   "CIRCLE_REPOSITORY_URL",
+		"index":      "CIRCLE_NODE_INDEX",
+		"node-total": "CIRCLE_NODE_TOTAL",
+	} {
+		if flags.Changed(flag) {
+			value := flags.Lookup(flag).Value.String()
+			env = append(env, fmt.Sprintf("%s=%s", variable, value))
+		}
+	}
+
+	values, _ := flags.GetStringArray("env")
+	return append(env, values...)
+}
+
+// newShellJob reads a job of the compiled config, whose working directory is
+// resolved against dir. The variables of env are set after those of the job.
+func newShellJob(compiled, name, dir string, env []string) (*shellJob, error) {
+	var config struct {
+		Jobs map[string]struct {
+			Shell            string            `yaml:"shell"`
+			WorkingDirectory string            `yaml:"working_directory"`
+			Environment      map[string]string `yaml:"environment"`
+			Steps            []interface{}     `yaml:"steps"`
+		} `yaml:"jobs"`
+	}
+	if err := yaml.Unmarshal([]byte(compiled), &config); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the compiled config")
+	}
+
+	definition, ok := config.Jobs[name]
+	if !ok {
+		return nil, fmt.Errorf("no job named `%s` in the config", name)
+	}
+
+	// The checkout in dir stands for the working directory of the job, since
+	// the home directory of the job isn't the one of the host. Only relative
+	// working directories are resolved under it.
+	workingDirectory := definition.WorkingDirectory
+	if workingDirectory == "" {
+		workingDirectory = defaultWorkingDirectory
+	}
+	if isRelative(workingDirectory) {
+		dir = filepath.Join(dir, workingDirectory)
+	}
+
+	environment := map[string]string{
+		"CI":                       "true",
+		"CIRCLECI":                 "true",
+		"CIRCLE_JOB":               name,
+		"CIRCLE_WORKING_DIRECTORY": dir,
+		"CIRCLE_NODE_INDEX":        "0",
+		"CIRCLE_NODE_TOTAL":        "1",
+	}
+	for name, value := range definition.Environment {
+		environment[name] = value
+	}
+	for _, variable := range env {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) == 2 {
+			environment[parts[0]] = parts[1]
+		}
+	}
+
+	return &shellJob{
+		name:             name,
+		steps:            definition.Steps,
+		shell:            definition.Shell,
+		environment:      environment,
+		dir:              dir,
+		workingDirectory: workingDirectory,
+		cacheDir:         CacheDir(),
+		stdout:           os.Stdout,
+		stderr:           os.Stderr,
+	}, nil
+}
+
+// isRelative tells whether a path of the config is relative to the working
+// directory, rather than absolute or under `~`.
+func isRelative(path string) bool {
+	return path != "~" && !strings.HasPrefix(path, "~/") && !filepath.IsAbs(path)
+}
+
+// jobPath maps a path of the config that is within the working directory of
+// the job to the host, where dir stands for it. ok is false for paths
+// outside of it.
+func (j *shellJob) jobPath(path string) (string, bool) {
+	if isRelative(path) {
+		return filepath.Join(j.dir, path), true
+	}
+
+	rel, err := filepath.Rel(j.workingDirectory, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.Join(j.dir, rel), true
+}
+
+// hostPath maps a path of the config to the host: paths within the working
+// directory of the job are found under dir, and others on the host, such as
+// those under its home directory.
+func (j *shellJob) hostPath(path string) string {
+	if local, ok := j.jobPath(path); ok {
+		return local
+	}
+	return resolvePath(path, j.dir)
+}
+
+// defaultShell is the shell of run steps, as on CircleCI when bash is available.
+func defaultShell() string {
+	if _, err := exec.LookPath("bash"); err == nil {
+		return "bash -eo pipefail"
+	}
+	return "sh -e"
+}
+
+// run runs the steps of the job in order, and returns the exit code of the
+// first one that failed.
+func (j *shellJob) run() (int, error) {
+	// Lets steps export variables to the next ones, as on CircleCI.
+	bashEnv, err := ioutil.TempFile("", "circleci-bash-env-")
+	if err != nil {
+		return 0, errors.Wrap(err, "Error creating BASH_ENV")
+	}
+	bashEnv.Close()
+	defer os.Remove(bashEnv.Name())
+	j.environment["BASH_ENV"] = bashEnv.Name()
+
+	// Background steps and the processes of timed out steps write concurrently
+	// with the job, and may outlive it.
+	output := &jobOutput{}
+	stdout, stderr := j.stdout, j.stderr
+	j.stdout, j.stderr = output.writer(stdout), output.writer(stderr)
+	defer func() {
+		output.close()
+		j.stdout, j.stderr = stdout, stderr
+	}()
+
+	var background []*exec.Cmd
+	defer func() {
+		for _, cmd := range background {
+			_ = cmd.Process.Kill()
+		}
+	}()
+
+	exitCode := 0
+	for _, step := range j.steps {
+		name, options := stepParts(step)
+
+		if name != "run" {
+			settings, _ := options.(map[string]interface{})
+			when, _ := settings["when"].(string)
+			if !shouldRun(when, exitCode) {
+				continue
+			}
+			if err := j.runBuiltin(name, settings); err != nil {
+				fmt.Fprintf(j.stderr, "Error: %s\n", err)
+				if exitCode == 0 {
+					exitCode = 1
+				}
+			}
+			continue
+		}
+
+		run, err := runOptions(options)
+		if err != nil {
+			return 0, err
+		}
+
+		if !shouldRun(run.When, exitCode) {
+			continue
+		}
+
+		title := run.Name
+		if title == "" {
+			title = run.Command
+		}
+		fmt.Fprintf(j.stdout, "====>> %s\n", title)
+
+		cmd := j.command(run)
+		// Created when missing, as on CircleCI.
+		if err := os.MkdirAll(cmd.Dir, 0755); err != nil {
+			return 0, errors.Wrapf(err, "failed to create the working directory of `%s`", title)
+		}
+
+		if run.Background {
+			cmd.Stdout = j.stdout
+			cmd.Stderr = j.stderr
+			if err := cmd.Start(); err != nil {
+				return 0, errors.Wrapf(err, "failed to start `%s`", title)
+			}
+			background = append(background, cmd)
+			continue
+		}
+
+		code, err := runWithTimeout(cmd, run.NoOutputTimeout, j.stdout, j.stderr)
+		if err != nil {
+			return 0, errors.Wrapf(err, "failed to run `%s`", title)
+		}
+		if code != 0 && exitCode == 0 {
+			fmt.Fprintf(j.stdout, "Exited with code %d\n", code)
+			exitCode = code
+		}
+	}
+
+	return exitCode, nil
+}
+
+// shouldRun reports whether a step runs, given its `when` attribute and the
+// exit code of the job so far.
+func shouldRun(when string, exitCode int) bool {
+	switch when {
+	case "always":
+		return true
+	case "on_fail":
+		return exitCode != 0
+	default:
+		return exitCode == 0
+	}
+}
+
+// stepParts returns the type of a step and its options.
+func stepParts(step interface{}) (string, interface{}) {
+	switch step := step.(type) {
+	case string:
+		return step, nil
+	case map[string]interface{}:
+		for name, options := range step {
+			return name, options
+		}
+	}
+	return "", nil
+}
+
+func runOptions(options interface{}) (shellStep, error) {
+	var step shellStep
+	if command, ok := options.(string); ok {
+		step.Command = command
+		return step, nil
+	}
+
+	encoded, err := yaml.Marshal(options)
+	if err != nil {
+		return step, err
+	}
+	err = yaml.Unmarshal(encoded, &step)
+	return step, errors.Wrap(err, "Unable to parse a run step")
+}
+
+// command prepares the process of a run step.
+func (j *shellJob) command(run shellStep) *exec.Cmd {
+	shell := run.Shell
+	if shell == "" {
+		shell = j.shell
+	}
+	if shell == "" {
+		shell = defaultShell()
+	}
+
+	words := strings.Fields(shell)
+	cmd := exec.Command(words[0], append(words[1:], "-c", run.Command)...) // #nosec
+	cmd.Dir = j.dir
+	// Directories outside of the one of the job don't exist on the host
+	// either, so the checkout stands for them too.
+	if dir, ok := j.jobPath(run.WorkingDirectory); ok {
+		cmd.Dir = dir
+	}
+
+	environment := map[string]string{}
+	for name, value := range j.environment {
+		environment[name] = value
+	}
+	for name, value := range run.Environment {
+		environment[name] = value
+	}
+
+	cmd.Env = os.Environ()
+	names := make([]string, 0, len(environment))
+	for name := range environment {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", name, environment[name]))
+	}
+
+	return cmd
+}
+
+func (j *shellJob) getenv(name string) string {
+	if value, ok := j.environment[name]; ok {
+		return value
+	}
+	return os.Getenv(name)
+}
+
+// runBuiltin runs the steps other than `run` that make sense on the host.
+func (j *shellJob) runBuiltin(name string, settings map[string]interface{}) error {
+	switch name {
+	case "checkout":
+		fmt.Fprintf(j.stdout, "====>> Checkout code\nSkipping checkout, using %s as is\n", j.dir)
+		return nil
+	case "save_cache":
+		fmt.Fprintf(j.stdout, "====>> %s\n", stepName(settings, "Saving Cache"))
+		template, _ := settings["key"].(string)
+		key, err := evalCacheKey(template, j.getenv, j.hostPath)
+		if err != nil {
+			return err
+		}
+
+		var paths []string
+		list, _ := settings["paths"].([]interface{})
+		for _, path := range list {
+			paths = append(paths, j.hostPath(fmt.Sprint(path)))
+		}
+		return saveCache(j.stdout, j.cacheDir, key, paths)
+	case "restore_cache":
+		fmt.Fprintf(j.stdout, "====>> %s\n", stepName(settings, "Restoring Cache"))
+		var templates []string
+		if key, ok := settings["key"].(string); ok {
+			templates = append(templates, key)
+		}
+		if list, ok := settings["keys"].([]interface{}); ok {
+			for _, key := range list {
+				templates = append(templates, fmt.Sprint(key))
+			}
+		}
+
+		var keys []string
+		for _, template := range templates {
+			key, err := evalCacheKey(template, j.getenv, j.hostPath)
+			if err != nil {
+				return err
+			}
+			keys = append(keys, key)
+		}
+		return restoreCache(j.stdout, j.cacheDir, keys)
+	}
+
+	fmt.Fprintf(j.stdout, "====>> %s\nSkipping %s, which the shell executor doesn't run\n", name, name)
+	return nil
+}
+
+// runWithTimeout runs the command, killing it when it doesn't output
+// anything for longer than timeout, and returns its exit code.
+func runWithTimeout(cmd *exec.Cmd, timeout string, stdout, stderr io.Writer) (int, error) {
+	limit := defaultNoOutputTimeout
+	if timeout != "" {
+		var err error
+		if limit, err = parseTimeout(timeout); err != nil {
+			return 0, err
+		}
+	}
+
+	lastOutput := time.Now().UnixNano()
+	cmd.Stdout = &activityWriter{w: stdout, last: &lastOutput}
+	cmd.Stderr = &activityWriter{w: stderr, last: &lastOutput}
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	ticker := time.NewTicker(limit / 10)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				return exitErr.ExitCode(), nil
+			}
+			return 0, err
+		case <-ticker.C:
+			if time.Since(time.Unix(0, atomic.LoadInt64(&lastOutput))) > limit {
+				// Not waiting for the output to end, as the processes the
+				// command started may hold on to it.
+				_ = cmd.Process.Kill()
+				fmt.Fprintf(stderr, "Too long with no output (exceeded %s): context deadline exceeded\n", limit)
+				return 1, nil
+			}
+		}
+	}
+}
+
+// parseTimeout reads a timeout like `10m` or `1h30m`, where a plain number
+// is in seconds.
+func parseTimeout(timeout string) (time.Duration, error) {
+	if duration, err := time.ParseDuration(timeout); err == nil && duration > 0 {
+		return duration, nil
+	}
+	if duration, err := time.ParseDuration(timeout + "s"); err == nil && duration > 0 {
+		return duration, nil
+	}
+	return 0, fmt.Errorf("invalid no_output_timeout `%s`", timeout)
+}
+
+// jobOutput serializes the writes to the output of a job, and discards those
+// happening once it is closed.
+type jobOutput struct {
+	mu     sync.Mutex
+	closed bool
+}
+
+func (o *jobOutput) writer(w io.Writer) io.Writer {
+	return &jobOutputWriter{output: o, w: w}
+}
+
+func (o *jobOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.closed = true
+}
+
+type jobOutputWriter struct {
+	output *jobOutput
+	w      io.Writer
+}
+
+func (o *jobOutputWriter) Write(p []byte) (int, error) {
+	o.output.mu.Lock()
+	defer o.output.mu.Unlock()
+	if o.output.closed {
+		return len(p), nil
+	}
+	return o.w.Write(p)
+}
+
+// activityWriter records the time of the last write.
+type activityWriter struct {
+	w    io.Writer
+	last *int64
+}
+
+func (a *activityWriter) Write(p []byte) (int, error) {
+	atomic.StoreInt64(a.last, time.Now().UnixNano())
+	return a.w.Write(p)
+}
@@ -0,0 +1,273 @@
+package local
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// The shell executor saves and restores caches itself, in the same format as
+// the steps emulating them in containers.
+
+// evalCacheKey expands the templates of a cache key, reading variables from
+// getenv and checksummed files from the host paths returned by resolve.
+func evalCacheKey(key string, getenv func(string) string, resolve func(string) string) (string, error) {
+	var expanded strings.Builder
+	last := 0
+
+	for _, match := range cacheTemplate.FindAllStringSubmatchIndex(key, -1) {
+		expanded.WriteString(key[last:match[0]])
+		last = match[1]
+
+		expression := key[match[2]:match[3]]
+		switch {
+		case expression == ".Branch":
+			expanded.WriteString(getenv("CIRCLE_BRANCH"))
+		case expression == ".Revision":
+			expanded.WriteString(getenv("CIRCLE_SHA1"))
+		case strings.HasPrefix(expression, ".Environment."):
+			expanded.WriteString(getenv(strings.TrimPrefix(expression, ".Environment.")))
+		case expression == "epoch":
+			expanded.WriteString(fmt.Sprint(time.Now().Unix()))
+		case expression == "arch":
+			expanded.WriteString(cacheArch())
+		case checksumTemplate.MatchString(expression):
+			file := checksumTemplate.FindStringSubmatch(expression)[1]
+			sum, err := checksumFile(resolve(file))
+			if err != nil {
+				return "", err
+			}
+			expanded.WriteString(sum)
+		default:
+			return "", fmt.Errorf("unsupported template `{{ %s }}` in cache key `%s`", expression, key)
+		}
+	}
+	expanded.WriteString(key[last:])
+
+	return expanded.String(), nil
+}
+
+// cacheArch expands `{{ arch }}` on the host, like archCommand does in
+// containers.
+func cacheArch() string {
+	return fmt.Sprintf("%s-%s", runtime.GOOS, runtime.GOARCH)
+}
+
+func checksumFile(path string) (string, error) {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return "", errors.Wrap(err, "Unable to checksum the file")
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func checksumString(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// resolvePath expands the home directory of path, and makes it absolute
+// relative to dir.
+func resolvePath(path, dir string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		home, _ := os.UserHomeDir()
+		path = filepath.Join(home, strings.TrimPrefix(path, "~"))
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	return filepath.Clean(path)
+}
+
+// saveCache archives the paths that exist, unless a cache was already saved
+// with the key.
+func saveCache(w io.Writer, cacheDir, key string, paths []string) error {
+	entry := filepath.Join(cacheDir, cacheKeys, checksumString(key))
+	if _, err := os.Stat(entry); err == nil {
+		fmt.Fprintf(w, "Skipping cache generation, cache already exists for key: %s\n", key)
+		return nil
+	}
+
+	var existing []string
+	for _, path := range paths {
+		if _, err := os.Stat(path); err == nil {
+			existing = append(existing, path)
+		}
+	}
+	if len(existing) == 0 {
+		fmt.Fprintln(w, "None of the paths to cache exist, skipping")
+		return nil
+	}
+
+	if _, err := cacheArguments(cacheDir); err != nil {
+		return err
+	}
+
+	archive, err := ioutil.TempFile(filepath.Join(cacheDir, cacheObjects), "tmp.")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(archive.Name())
+
+	hash := sha256.New()
+	writer := tar.NewWriter(io.MultiWriter(archive, hash))
+	for _, path := range existing {
+		if err := archivePath(writer, path); err != nil {
+			archive.Close()
+			return errors.Wrapf(err, "Unable to archive %s", path)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		archive.Close()
+		return err
+	}
+	if err := archive.Close(); err != nil {
+		return err
+	}
+
+	object := hex.EncodeToString(hash.Sum(nil))
+	if err := os.Rename(archive.Name(), filepath.Join(cacheDir, cacheObjects, object+".tar")); err != nil {
+		return err
+	}
+
+	if err := ioutil.WriteFile(entry, []byte(fmt.Sprintf("%s\n%s\n", object, key)), 0644); err != nil { // #nosec
+		return err
+	}
+
+	fmt.Fprintf(w, "Stored cache for key: %s\n", key)
+	return nil
+}
+
+// archivePath adds a file or directory to the archive, named by its absolute
+// path without the leading separator.
+func archivePath(writer *tar.Writer, root string) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = archiveName(path)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+
+		if err := writer.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		file, err := os.Open(path) // #nosec
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = io.Copy(writer, file)
+		return err
+	})
+}
+
+func archiveName(path string) string {
+	path = strings.TrimPrefix(path, filepath.VolumeName(path))
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
+
+// restoreCache extracts the most recently saved cache matching one of the
+// keys, tried in order as prefixes.
+func restoreCache(w io.Writer, cacheDir string, keys []string) error {
+	entries, err := ListCache(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Key, key) {
+				continue
+			}
+
+			fmt.Fprintf(w, "Found a cache from key %s\n", entry.Key)
+			return extractArchive(entry.object)
+		}
+	}
+
+	fmt.Fprintln(w, "No cache is found for the keys")
+	return nil
+}
+
+func extractArchive(path string) error {
+	file, err := os.Open(path) // #nosec
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	root := string(filepath.Separator)
+	reader := tar.NewReader(file)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target := filepath.Join(root, filepath.FromSlash(header.Name))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, os.FileMode(header.Mode)|0700); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			_ = os.Remove(target)
+			if err := os.Symlink(header.Linkname, target); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode)) // #nosec
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(out, reader); err != nil { // #nosec
+				out.Close()
+				return err
+			}
+			if err := out.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package local
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/spf13/pflag"
+)
+
+var _ = Describe("shell executor", func() {
+	var (
+		dir    string
+		stdout bytes.Buffer
+		stderr bytes.Buffer
+	)
+
+	BeforeEach(func() {
+		if _, err := exec.LookPath("sh"); err != nil {
+			Skip("sh is not available")
+		}
+
+		var err error
+		dir, err = ioutil.TempDir("", "circleci-shell")
+		Expect(err).NotTo(HaveOccurred())
+		stdout.Reset()
+		stderr.Reset()
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	job := func(compiled string, env ...string) *shellJob {
+		j, err := newShellJob(compiled, "build", dir, env)
+		Expect(err).NotTo(HaveOccurred())
+		j.cacheDir = filepath.Join(dir, "cache")
+		j.stdout = &stdout
+		j.stderr = &stderr
+		return j
+	}
+
+	It("runs the steps with the environment of the job", func() {
+		code, err := job(`jobs:
+  build:
+    shell: sh -e
+    environment:
+      GREETING: hello
+    steps:
+      - checkout
+      - run: echo "$GREETING $NAME from $CIRCLE_JOB" > greeting
+      - run:
+          name: Export a variable
+          command: echo 'export EXPORTED=yes' >> "$BASH_ENV"
+      - run:
+          command: . "$BASH_ENV"; echo "exported=$EXPORTED"; pwd
+          working_directory: sub
+      - setup_remote_docker
+`, "NAME=world").run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(0))
+
+		Expect(ioutil.ReadFile(filepath.Join(dir, "greeting"))).To(BeEquivalentTo("hello world from build\n"))
+		Expect(stdout.String()).To(ContainSubstring("Skipping checkout, using " + dir))
+		Expect(stdout.String()).To(ContainSubstring("====>> Export a variable\n"))
+		Expect(stdout.String()).To(ContainSubstring("exported=yes\n" + filepath.Join(dir, "sub") + "\n"))
+		Expect(stdout.String()).To(ContainSubstring("Skipping setup_remote_docker, which the shell executor doesn't run"))
+	})
+
+	It("runs the steps in the working directory of the job", func() {
+		code, err := job(`jobs:
+  build:
+    shell: sh -e
+    working_directory: app
+    steps:
+      - run: echo "$CIRCLE_WORKING_DIRECTORY"; pwd
+`).run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(0))
+
+		app := filepath.Join(dir, "app")
+		Expect(stdout.String()).To(ContainSubstring(app + "\n" + app + "\n"))
+	})
+
+	It("runs jobs in the checkout rather than in the home directory", func() {
+		code, err := job(`jobs:
+  build:
+    shell: sh -e
+    working_directory: ~/project
+    steps:
+      - run: pwd
+      - run:
+          command: pwd
+          working_directory: ~/project/app
+      - run:
+          command: pwd
+          working_directory: /tmp
+`).run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(0))
+
+		Expect(stdout.String()).To(ContainSubstring(dir + "\n====>> pwd\n" + filepath.Join(dir, "app") + "\n====>> pwd\n" + dir + "\n"))
+	})
+
+	It("skips the remaining steps after a failure, but for those that always run", func() {
+		code, err := job(`jobs:
+  build:
+    shell: sh -e
+    steps:
+      - run: exit 3
+      - run: echo skipped
+      - run:
+          command: echo on failure
+          when: on_fail
+      - run:
+          command: echo always
+          when: always
+`).run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(3))
+		Expect(stdout.String()).NotTo(ContainSubstring("skipped"))
+		Expect(stdout.String()).To(ContainSubstring("Exited with code 3\n"))
+		Expect(stdout.String()).To(ContainSubstring("on failure\n"))
+		Expect(stdout.String()).To(ContainSubstring("always\n"))
+	})
+
+	It("stops steps that are too long without output", func() {
+		code, err := job(`jobs:
+  build:
+    shell: sh -e
+    steps:
+      - run:
+          command: echo started; sleep 5
+          no_output_timeout: 200ms
+`).run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(1))
+		Expect(stderr.String()).To(ContainSubstring("Too long with no output (exceeded 200ms)"))
+	})
+
+	It("saves and restores caches", func() {
+		Expect(ioutil.WriteFile(filepath.Join(dir, "go.sum"), []byte("sums"), 0600)).To(Succeed())
+		Expect(os.MkdirAll(filepath.Join(dir, "vendor", "pkg"), 0700)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "vendor", "pkg", "a.go"), []byte("package pkg"), 0600)).To(Succeed())
+
+		code, err := job(`jobs:
+  build:
+    shell: sh -e
+    steps:
+      - save_cache:
+          key: v1-{{ .Branch }}-{{ checksum "go.sum" }}
+          paths:
+            - vendor
+      - run: rm -r vendor
+      - restore_cache:
+          keys:
+            - v1-{{ .Branch }}-nothing
+            - v1-{{ .Branch }}-
+`, "CIRCLE_BRANCH=main").run()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(code).To(Equal(0))
+
+		Expect(stdout.String()).To(ContainSubstring("Stored cache for key: v1-main-" + checksumString("sums")))
+		Expect(stdout.String()).To(ContainSubstring("Found a cache from key v1-main-"))
+		Expect(ioutil.ReadFile(filepath.Join(dir, "vendor", "pkg", "a.go"))).To(BeEquivalentTo("package pkg"))
+
+		entries, err := ListCache(filepath.Join(dir, "cache"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(HaveLen(1))
+	})
+
+	It("sets the variables of the build-agent flags", func() {
+		flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+		AddFlagsForDocumentation(flags)
+		Expect(flags.Parse([]string{"--branch", "main", "--index", "2", "-e", "A=1"})).To(Succeed())
+
+		Expect(shellEnvironment(flags, []string{"--env", "B=2"})).To(ConsistOf(
+			"B=2", "CIRCLE_BRANCH=main", "CIRCLE_NODE_INDEX=2", "A=1",
+		))
+	})
+
+	It("reads timeouts", func() {
+		Expect(parseTimeout("20m")).To(Equal(20 * time.Minute))
+		Expect(parseTimeout("90")).To(Equal(90 * time.Second))
+
+		_, err := parseTimeout("soon")
+		Expect(err).To(MatchError("invalid no_output_timeout `soon`"))
+	})
+})
@@ -0,0 +1,545 @@
+package local
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CircleCI-Public/circleci-cli/prompt"
+	"github.com/CircleCI-Public/circleci-cli/settings"
+	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+)
+
+// workspaceMount is where the shared workspace directory is mounted in the
+// containers of the jobs.
+const workspaceMount = "/tmp/circleci-workspace"
+
+// Statuses of the jobs of a local workflow.
+const (
+	statusSuccess  = "success"
+	statusFailed   = "failed"
+	statusSkipped  = "skipped"
+	statusApproved = "approved"
+	statusRejected = "not approved"
+)
+
+// workflowNode is a job of a workflow. Approval jobs have no job definition.
+type workflowNode struct {
+	// name identifies the job within the workflow, and is what `requires` refers to.
+	name     string
+	job      string
+	requires []string
+	approval bool
+	contexts []string
+}
+
+type jobResult struct {
+	name     string
+	status   string
+	duration time.Duration
+}
+
+// ExecuteWorkflow runs the jobs of a workflow locally, in the order set by
+// their requirements.
+func ExecuteWorkflow(name string, flags *pflag.FlagSet, cfg *settings.Config) error {
+	configPath, _ := flags.GetString("config")
+
+	compiled, err := compileConfig(flags, cfg, configPath)
+	if err != nil {
+		return err
+	}
+
+	nodes, err := parseWorkflow(compiled, name)
+	if err != nil {
+		return err
+	}
+
+	// Read upfront, so that a missing context fails the workflow before any job runs.
+	environments := map[string][]string{}
+	for _, node := range nodes {
+		if environments[node.name], err = environmentArguments(flags, node.contexts); err != nil {
+			return err
+		}
+	}
+
+	compiled, err = emulateWorkspaces(compiled)
+	if err != nil {
+		return err
+	}
+
+	var arguments []string
+	if noCache, _ := flags.GetBool("no-cache"); !noCache {
+		jobs := make([]string, 0, len(nodes))
+		for _, node := range nodes {
+			if !node.approval {
+				jobs = append(jobs, node.job)
+			}
+		}
+		if compiled, err = emulateCache(os.Stderr, compiled, jobs); err != nil {
+			return err
+		}
+
+		if arguments, err = cacheArguments(CacheDir()); err != nil {
+			return err
+		}
+	}
+
+	processedConfigPath, err := writeStringToTempFile(compiled)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(processedConfigPath)
+
+	// Under /tmp for the same reason as the config, see writeStringToTempFile.
+	workspace, err := ioutil.TempDir("/tmp", "circleci-workspace-")
+	if err != nil {
+		return errors.Wrap(err, "Error creating the workspace directory")
+	}
+	// Best effort: the jobs may have left files only root can remove.
+	defer os.RemoveAll(workspace)
+
+	pwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	runtimeName, _ := flags.GetString("runtime")
+	runtime, err := newRuntime(runtimeName)
+	if err != nil {
+		return err
+	}
+
+	image, err := picardImage(os.Stdout, runtime, flags)
+	if err != nil {
+		return errors.Wrap(err, "Could not find picard image")
+	}
+
+	arguments = append(arguments, "--volume", fmt.Sprintf("%s:%s", workspace, workspaceMount))
+	for _, flag := range []string{"env", "volume"} {
+		values, _ := flags.GetStringArray(flag)
+		for _, value := range values {
+			arguments = append(arguments, "--"+flag, value)
+		}
+	}
+
+	maxParallel, _ := flags.GetInt("max-parallel")
+	autoApprove, _ := flags.GetBool("auto-approve")
+
+	var output sync.Mutex
+	run := func(node *workflowNode) error {
+		jobArguments := append([]string{"--job", node.job}, environments[node.name]...)
+		container := generateContainerConfig(processedConfigPath, image, pwd, runtime.socketBind(), false,
+			append(jobArguments, arguments...)...)
+
+		stdout := newPrefixWriter(os.Stdout, node.name, &output)
+		stderr := newPrefixWriter(os.Stderr, node.name, &output)
+		defer stdout.Flush()
+		defer stderr.Flush()
+
+		code, err := runtime.run(container, strings.NewReader(""), stdout, stderr)
+		if err != nil {
+			return err
+		}
+		if code != 0 {
+			return &ExitError{Code: code}
+		}
+		return nil
+	}
+
+	// Approvals are asked one at a time. The prompt doesn't hold the output
+	// lock, which would stall the jobs running meanwhile once their output
+	// fills the pipes of their containers.
+	var prompting sync.Mutex
+	approve := func(node *workflowNode) bool {
+		prompting.Lock()
+		defer prompting.Unlock()
+
+		if !autoApprove && term.IsTerminal(int(os.Stdin.Fd())) {
+			return prompt.AskUserToConfirm(fmt.Sprintf("Approve `%s`", node.name))
+		}
+
+		output.Lock()
+		defer output.Unlock()
+		if autoApprove {
+			fmt.Printf("Approving `%s`\n", node.name)
+		} else {
+			fmt.Printf("Not approving `%s`, use --auto-approve to approve jobs without a terminal\n", node.name)
+		}
+		return autoApprove
+	}
+
+	results := runWorkflow(nodes, maxParallel, run, approve)
+	printWorkflowSummary(os.Stdout, results)
+
+	return workflowError(name, results)
+}
+
+// workflowError reports the jobs of a workflow that failed, were not
+// approved, or were skipped because of either.
+func workflowError(name string, results []*jobResult) error {
+	unsuccessful := 0
+	for _, result := range results {
+		if result.status != statusSuccess && result.status != statusApproved {
+			unsuccessful++
+		}
+	}
+	if unsuccessful > 0 {
+		return fmt.Errorf("%d of the %d jobs of workflow `%s` did not succeed", unsuccessful, len(results), name)
+	}
+
+	return nil
+}
+
+// parseWorkflow reads the jobs of a workflow from a compiled config, in
+// topological order.
+func parseWorkflow(compiled, name string) ([]*workflowNode, error) {
+	var config struct {
+		Workflows map[string]yaml.Node `yaml:"workflows"`
+	}
+	if err := yaml.Unmarshal([]byte(compiled), &config); err != nil {
+		return nil, errors.Wrap(err, "Unable to parse the compiled config")
+	}
+
+	var names []string
+	for workflowName := range config.Workflows {
+		if workflowName != "version" {
+			names = append(names, workflowName)
+		}
+	}
+	sort.Strings(names)
+
+	definition, ok := config.Workflows[name]
+	if !ok || name == "version" {
+		return nil, fmt.Errorf("no workflow named `%s`, expected one of: %s", name, strings.Join(names, ", "))
+	}
+
+	nodes, err := workflowNodes(definition, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return sortWorkflow(nodes, name)
+}
+
+// workflowNodes reads the jobs of a workflow definition, in the order of the
+// config.
+func workflowNodes(definition yaml.Node, name string) ([]*workflowNode, error) {
+	var workflow struct {
+		Jobs []yaml.Node `yaml:"jobs"`
+	}
+	if err := definition.Decode(&workflow); err != nil {
+		return nil, errors.Wrapf(err, "Unable to parse workflow `%s`", name)
+	}
+
+	var nodes []*workflowNode
+	for _, entry := range workflow.Jobs {
+		node := &workflowNode{}
+
+		switch entry.Kind {
+		case yaml.ScalarNode:
+			node.job = entry.Value
+		case yaml.MappingNode:
+			var options struct {
+				Name     string    `yaml:"name"`
+				Type     string    `yaml:"type"`
+				Requires []string  `yaml:"requires"`
+				Context  yaml.Node `yaml:"context"`
+			}
+			if err := entry.Content[1].Decode(&options); err != nil {
+				return nil, errors.Wrapf(err, "Unable to parse job `%s` of workflow `%s`", entry.Content[0].Value, name)
+			}
+			contexts, err := contextNames(options.Context)
+			if err != nil {
+				return nil, errors.Wrapf(err, "Unable to parse the context of job `%s` of workflow `%s`", entry.Content[0].Value, name)
+			}
+			node.job = entry.Content[0].Value
+			node.name = options.Name
+			node.requires = options.Requires
+			node.approval = options.Type == "approval"
+			node.contexts = contexts
+		default:
+			return nil, fmt.Errorf("unexpected job in workflow `%s`", name)
+		}
+
+		if node.name == "" {
+			node.name = node.job
+		}
+		nodes = append(nodes, node)
+	}
+
+	return nodes, nil
+}
+
+// sortWorkflow orders the jobs so that each comes after those it requires,
+// keeping the order of the config otherwise.
+func sortWorkflow(nodes []*workflowNode, workflow string) ([]*workflowNode, error) {
+	byName := map[string]*workflowNode{}
+	for _, node := range nodes {
+		byName[node.name] = node
+	}
+
+	for _, node := range nodes {
+		for _, required := range node.requires {
+			if _, ok := byName[required]; !ok {
+				return nil, fmt.Errorf("job `%s` of workflow `%s` requires the unknown job `%s`", node.name, workflow, required)
+			}
+		}
+	}
+
+	var sorted []*workflowNode
+	placed := map[string]bool{}
+	for len(sorted) < len(nodes) {
+		progressed := false
+		for _, node := range nodes {
+			if placed[node.name] || !allIn(node.requires, placed) {
+				continue
+			}
+			placed[node.name] = true
+			sorted = append(sorted, node)
+			progressed = true
+		}
+
+		if !progressed {
+			var cycle []string
+			for _, node := range nodes {
+				if !placed[node.name] {
+					cycle = append(cycle, node.name)
+				}
+			}
+			return nil, fmt.Errorf("the requirements of jobs %s in workflow `%s` form a cycle", strings.Join(cycle, ", "), workflow)
+		}
+	}
+
+	return sorted, nil
+}
+
+func allIn(names []string, set map[string]bool) bool {
+	for _, name := range names {
+		if !set[name] {
+			return false
+		}
+	}
+	return true
+}
+
+// runWorkflow runs the jobs once their requirements succeeded, with at most
+// maxParallel of them at once. Approvals are asked while the other jobs keep
+// running. Jobs requiring a job that didn't succeed are skipped. Results are
+// in the order of nodes.
+func runWorkflow(nodes []*workflowNode, maxParallel int, run func(*workflowNode) error, approve func(*workflowNode) bool) []*jobResult {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+
+	results := map[string]*jobResult{}
+	started := map[string]bool{}
+	done := make(chan *jobResult)
+	running, approving := 0, 0
+
+	for len(results) < len(nodes) {
+		progressed := false
+
+		for _, node := range nodes {
+			if started[node.name] {
+				continue
+			}
+
+			ready, blocked := true, false
+			for _, required := range node.requires {
+				result, finished := results[required]
+				switch {
+				case !finished:
+					ready = false
+				case result.status != statusSuccess && result.status != statusApproved:
+					blocked = true
+				}
+			}
+
+			switch {
+			case blocked:
+				started[node.name] = true
+				results[node.name] = &jobResult{name: node.name, status: statusSkipped}
+				progressed = true
+			case !ready:
+			case node.approval:
+				started[node.name] = true
+				approving++
+				go func(node *workflowNode) {
+					status := statusRejected
+					if approve(node) {
+						status = statusApproved
+					}
+					done <- &jobResult{name: node.name, status: status}
+				}(node)
+			case running < maxParallel:
+				started[node.name] = true
+				running++
+				go func(node *workflowNode) {
+					start := time.Now()
+					status := statusSuccess
+					if err := run(node); err != nil {
+						status = statusFailed
+					}
+					done <- &jobResult{name: node.name, status: status, duration: time.Since(start)}
+				}(node)
+			}
+		}
+
+		if running+approving > 0 {
+			result := <-done
+			results[result.name] = result
+			if result.status == statusApproved || result.status == statusRejected {
+				approving--
+			} else {
+				running--
+			}
+		} else if !progressed {
+			break
+		}
+	}
+
+	ordered := make([]*jobResult, 0, len(nodes))
+	for _, node := range nodes {
+		ordered = append(ordered, results[node.name])
+	}
+	return ordered
+}
+
+func printWorkflowSummary(w io.Writer, results []*jobResult) {
+	table := tablewriter.NewWriter(w)
+	table.SetHeader([]string{"Job", "Status", "Duration"})
+	for _, result := range results {
+		duration := ""
+		if result.duration > 0 {
+			duration = result.duration.Round(time.Second).String()
+		}
+		table.Append([]string{result.name, result.status, duration})
+	}
+	table.Render()
+}
+
+// emulateWorkspaces replaces the workspace steps of the compiled config,
+// which picard can't run, with steps copying files to and from the workspace
+// directory shared by the jobs.
+func emulateWorkspaces(compiled string) (string, error) {
+	return rewriteSteps(compiled, nil, func(name string, options map[string]interface{}) (map[string]interface{}, error) {
+		switch name {
+		case "persist_to_workspace":
+			return runStep("Persisting to Workspace", persistCommand(options)), nil
+		case "attach_workspace":
+			return runStep("Attaching Workspace", attachCommand(options)), nil
+		}
+		return nil, nil
+	})
+}
+
+// rewriteSteps replaces the steps of the given jobs of a compiled config, or
+// of every job when jobs is nil, with the one returned by rewrite, given the
+// name and options of the step. Steps are kept when it returns nil.
+func rewriteSteps(compiled string, jobs []string, rewrite func(name string, options map[string]interface{}) (map[string]interface{}, error)) (string, error) {
+	var config map[string]interface{}
+	if err := yaml.Unmarshal([]byte(compiled), &config); err != nil {
+		return "", errors.Wrap(err, "Unable to parse the compiled config")
+	}
+
+	selected := map[string]bool{}
+	for _, name := range jobs {
+		selected[name] = true
+	}
+
+	definitions, _ := config["jobs"].(map[string]interface{})
+	for name, job := range definitions {
+		if jobs != nil && !selected[name] {
+			continue
+		}
+
+		job, ok := job.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		steps, _ := job["steps"].([]interface{})
+		for i, step := range steps {
+			step, ok := step.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			for name, options := range step {
+				options, ok := options.(map[string]interface{})
+				if !ok {
+					continue
+				}
+				rewritten, err := rewrite(name, options)
+				if err != nil {
+					return "", err
+				}
+				if rewritten != nil {
+					steps[i] = rewritten
+				}
+			}
+		}
+	}
+
+	out, err := yaml.Marshal(config)
+	return string(out), err
+}
+
+func runStep(name, command string) map[string]interface{} {
+	return map[string]interface{}{
+		"run": map[string]interface{}{"name": name, "command": command},
+	}
+}
+
+func persistCommand(options map[string]interface{}) string {
+	root, _ := options["root"].(string)
+	paths, _ := options["paths"].([]interface{})
+
+	words := make([]string, 0, len(paths))
+	for _, path := range paths {
+		words = append(words, shellPath(fmt.Sprint(path)))
+	}
+
+	return fmt.Sprintf("mkdir -p %s\ncd %s && tar -cf - %s | tar -xf - -C %s",
+		workspaceMount, shellPath(root), strings.Join(words, " "), workspaceMount)
+}
+
+func attachCommand(options map[string]interface{}) string {
+	at, _ := options["at"].(string)
+	return fmt.Sprintf("mkdir -p %s %s\ntar -cf - -C %s . | tar -xf - -C %s",
+		workspaceMount, shellPath(at), workspaceMount, shellPath(at))
+}
+
+// shellPath quotes a path for the shell, leaving the home directory and glob
+// patterns to be expanded.
+func shellPath(path string) string {
+	if path == "" {
+		return "."
+	}
+
+	if strings.ContainsAny(path, "*?[") {
+		return path
+	}
+
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		return `"$HOME"` + quote(strings.TrimPrefix(path, "~"))
+	}
+
+	return quote(path)
+}
+
+func quote(s string) string {
+	if s == "" {
+		return ""
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
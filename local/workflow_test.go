@@ -0,0 +1,256 @@
+package local
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("workflow", func() {
+	const compiled = `version: 2.1
+jobs:
+  build:
+    docker:
+      - image: cimg/base:stable
+    steps:
+      - checkout
+      - persist_to_workspace:
+          root: ~/project
+          paths:
+            - dist
+            - "*.tar"
+  deploy:
+    docker:
+      - image: cimg/base:stable
+    steps:
+      - attach_workspace:
+          at: /tmp/ws
+workflows:
+  version: 2
+  main:
+    jobs:
+      - deploy:
+          name: deploy-prod
+          context: aws
+          requires:
+            - hold
+      - build
+      - test:
+          requires:
+            - build
+      - hold:
+          type: approval
+          requires:
+            - test
+`
+
+	Describe("parsing", func() {
+		It("orders the jobs by their requirements", func() {
+			nodes, err := parseWorkflow(compiled, "main")
+			Expect(err).NotTo(HaveOccurred())
+
+			var names []string
+			for _, node := range nodes {
+				names = append(names, node.name)
+			}
+			Expect(names).To(Equal([]string{"build", "test", "hold", "deploy-prod"}))
+
+			Expect(nodes[2].approval).To(BeTrue())
+			Expect(nodes[3].job).To(Equal("deploy"))
+			Expect(nodes[3].requires).To(Equal([]string{"hold"}))
+			Expect(nodes[3].contexts).To(Equal([]string{"aws"}))
+		})
+
+		It("lists the workflows when the name is unknown", func() {
+			_, err := parseWorkflow(compiled, "version")
+			Expect(err).To(MatchError("no workflow named `version`, expected one of: main"))
+		})
+
+		It("reports requirements on unknown jobs", func() {
+			_, err := parseWorkflow(`workflows:
+  main:
+    jobs:
+      - test:
+          requires: [build]
+`, "main")
+			Expect(err).To(MatchError("job `test` of workflow `main` requires the unknown job `build`"))
+		})
+
+		It("reports cycles", func() {
+			_, err := parseWorkflow(`workflows:
+  main:
+    jobs:
+      - lint
+      - build:
+          requires: [test]
+      - test:
+          requires: [build]
+`, "main")
+			Expect(err).To(MatchError("the requirements of jobs build, test in workflow `main` form a cycle"))
+		})
+	})
+
+	Describe("running", func() {
+		var (
+			lock sync.Mutex
+			ran  []string
+		)
+
+		BeforeEach(func() {
+			ran = nil
+		})
+
+		record := func(fail ...string) func(*workflowNode) error {
+			return func(node *workflowNode) error {
+				lock.Lock()
+				defer lock.Unlock()
+				ran = append(ran, node.name)
+				for _, name := range fail {
+					if name == node.name {
+						return errors.New("failed")
+					}
+				}
+				return nil
+			}
+		}
+
+		statuses := func(results []*jobResult) map[string]string {
+			byName := map[string]string{}
+			for _, result := range results {
+				byName[result.name] = result.status
+			}
+			return byName
+		}
+
+		It("skips the jobs depending on a failed job", func() {
+			nodes, err := parseWorkflow(compiled, "main")
+			Expect(err).NotTo(HaveOccurred())
+
+			results := runWorkflow(nodes, 1, record("test"), func(*workflowNode) bool { return true })
+			Expect(ran).To(Equal([]string{"build", "test"}))
+			Expect(statuses(results)).To(Equal(map[string]string{
+				"build":       statusSuccess,
+				"test":        statusFailed,
+				"hold":        statusSkipped,
+				"deploy-prod": statusSkipped,
+			}))
+		})
+
+		It("skips the jobs after a rejected approval", func() {
+			nodes, err := parseWorkflow(compiled, "main")
+			Expect(err).NotTo(HaveOccurred())
+
+			results := runWorkflow(nodes, 1, record(), func(*workflowNode) bool { return false })
+			Expect(ran).To(Equal([]string{"build", "test"}))
+			Expect(statuses(results)).To(Equal(map[string]string{
+				"build":       statusSuccess,
+				"test":        statusSuccess,
+				"hold":        statusRejected,
+				"deploy-prod": statusSkipped,
+			}))
+		})
+
+		It("keeps running jobs while an approval is pending", func() {
+			nodes := []*workflowNode{{name: "hold", approval: true}, {name: "build"}}
+
+			built := make(chan struct{})
+			results := runWorkflow(nodes, 1, func(node *workflowNode) error {
+				close(built)
+				return nil
+			}, func(*workflowNode) bool {
+				select {
+				case <-built:
+					return true
+				case <-time.After(5 * time.Second):
+					return false
+				}
+			})
+
+			Expect(statuses(results)).To(Equal(map[string]string{
+				"hold":  statusApproved,
+				"build": statusSuccess,
+			}))
+		})
+
+		It("fails the workflow when an approval is rejected", func() {
+			nodes, err := parseWorkflow(compiled, "main")
+			Expect(err).NotTo(HaveOccurred())
+
+			results := runWorkflow(nodes, 1, record(), func(*workflowNode) bool { return false })
+			Expect(workflowError("main", results)).To(MatchError("2 of the 4 jobs of workflow `main` did not succeed"))
+
+			results = runWorkflow(nodes, 1, record(), func(*workflowNode) bool { return true })
+			Expect(workflowError("main", results)).To(Succeed())
+		})
+
+		It("runs no more than maxParallel jobs at once", func() {
+			nodes := []*workflowNode{{name: "a"}, {name: "b"}, {name: "c"}, {name: "d"}}
+
+			var running, most int
+			results := runWorkflow(nodes, 2, func(*workflowNode) error {
+				lock.Lock()
+				running++
+				if running > most {
+					most = running
+				}
+				lock.Unlock()
+
+				defer func() {
+					lock.Lock()
+					running--
+					lock.Unlock()
+				}()
+				return nil
+			}, nil)
+
+			Expect(most).To(BeNumerically("<=", 2))
+			Expect(statuses(results)).To(HaveLen(4))
+		})
+	})
+
+	It("replaces workspace steps with copies to the shared directory", func() {
+		emulated, err := emulateWorkspaces(compiled)
+		Expect(err).NotTo(HaveOccurred())
+
+		var config struct {
+			Jobs map[string]struct {
+				Steps []interface{} `yaml:"steps"`
+			} `yaml:"jobs"`
+		}
+		Expect(yaml.Unmarshal([]byte(emulated), &config)).To(Succeed())
+
+		Expect(config.Jobs["build"].Steps).To(Equal([]interface{}{
+			"checkout",
+			map[string]interface{}{"run": map[string]interface{}{
+				"name":    "Persisting to Workspace",
+				"command": "mkdir -p /tmp/circleci-workspace\ncd \"$HOME\"'/project' && tar -cf - 'dist' *.tar | tar -xf - -C /tmp/circleci-workspace",
+			}},
+		}))
+		Expect(config.Jobs["deploy"].Steps).To(Equal([]interface{}{
+			map[string]interface{}{"run": map[string]interface{}{
+				"name":    "Attaching Workspace",
+				"command": "mkdir -p /tmp/circleci-workspace '/tmp/ws'\ntar -cf - -C /tmp/circleci-workspace . | tar -xf - -C '/tmp/ws'",
+			}},
+		}))
+	})
+
+	It("prefixes each line of output", func() {
+		var lock sync.Mutex
+		var out bytes.Buffer
+		w := newPrefixWriter(&out, "build", &lock)
+
+		_, err := w.Write([]byte("one\ntw"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(out.String()).To(Equal("[build] one\n"))
+
+		_, err = w.Write([]byte("o\nthree"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(w.Flush()).To(Succeed())
+		Expect(out.String()).To(Equal("[build] one\n[build] two\n[build] three\n"))
+	})
+})
@@ -2,6 +2,7 @@ package prompt
 
 import (
 	"github.com/erikgeiser/promptkit/confirmation"
+	"github.com/erikgeiser/promptkit/selection"
 	"github.com/erikgeiser/promptkit/textinput"
 )
 
@@ -36,3 +37,13 @@ func AskUserToConfirm(message string) bool {
 	result, err := input.RunPrompt()
 	return err == nil && result
 }
+
+// SelectFromList will prompt the user to pick one of the provided options.
+func SelectFromList(message string, options []string) (string, error) {
+	input := selection.New(message, selection.Choices(options))
+	choice, err := input.RunPrompt()
+	if err != nil {
+		return "", err
+	}
+	return choice.String, nil
+}
@@ -0,0 +1,190 @@
+// Package scaffold generates starter CircleCI configs for the kind of project
+// found in a directory.
+package scaffold
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.yml
+var templates embed.FS
+
+// Stack is a kind of project that a starter config can be generated for.
+type Stack struct {
+	Name        string
+	Description string
+	// Marker is the file whose presence identifies the stack.
+	Marker string
+	// DefaultVersion is the image tag used when the project doesn't pin one.
+	DefaultVersion string
+	// detectVersion returns the tool version pinned by the project, if any.
+	detectVersion func(dir string) string
+}
+
+// Stacks lists the supported stacks, in order of precedence when a project
+// matches more than one of them.
+var Stacks = []Stack{
+	{Name: "go", Description: "Go modules", Marker: "go.mod", DefaultVersion: "1.19", detectVersion: goVersion},
+	{Name: "node", Description: "Node.js with npm or yarn", Marker: "package.json", DefaultVersion: "lts", detectVersion: nodeVersion},
+	{Name: "java", Description: "Java with Maven", Marker: "pom.xml", DefaultVersion: "17.0", detectVersion: noVersion},
+	{Name: "ruby", Description: "Ruby with Bundler", Marker: "Gemfile", DefaultVersion: "3.1", detectVersion: versionFile(".ruby-version")},
+	{Name: "python", Description: "Python with pip", Marker: "requirements.txt", DefaultVersion: "3.10", detectVersion: versionFile(".python-version")},
+	{Name: "docker", Description: "Docker image", Marker: "Dockerfile", DefaultVersion: "", detectVersion: noVersion},
+}
+
+// Values are made available to the templates, e.g. `[[ .Version ]]`.
+// Templates use square brackets so that CircleCI's own `{{ }}` syntax, as
+// used in cache keys, can appear in them unescaped.
+type Values struct {
+	ProjectName string
+	Version     string
+}
+
+// FindStack returns the stack with the given name.
+func FindStack(name string) (Stack, error) {
+	names := make([]string, 0, len(Stacks))
+	for _, stack := range Stacks {
+		if stack.Name == name {
+			return stack, nil
+		}
+		names = append(names, stack.Name)
+	}
+
+	return Stack{}, fmt.Errorf("unknown stack `%s`, expected one of: %s", name, strings.Join(names, ", "))
+}
+
+// Detect returns the stacks whose marker files are present in dir.
+func Detect(dir string) []Stack {
+	var found []Stack
+	for _, stack := range Stacks {
+		if _, err := os.Stat(filepath.Join(dir, stack.Marker)); err == nil {
+			found = append(found, stack)
+		}
+	}
+	return found
+}
+
+// DefaultValues returns the template values for a project in dir.
+func DefaultValues(stack Stack, dir string) Values {
+	values := Values{
+		ProjectName: "app",
+		Version:     stack.DefaultVersion,
+	}
+
+	if abs, err := filepath.Abs(dir); err == nil {
+		values.ProjectName = strings.ToLower(filepath.Base(abs))
+	}
+
+	if version := stack.detectVersion(dir); version != "" {
+		values.Version = version
+	}
+
+	return values
+}
+
+// Render produces the starter config for stack. A `<stack>.yml` file in
+// templateDir, when given, takes the place of the built-in template.
+func Render(stack Stack, values Values, templateDir string) (string, error) {
+	name := stack.Name + ".yml"
+
+	var (
+		raw []byte
+		err error
+	)
+
+	if templateDir != "" {
+		raw, err = ioutil.ReadFile(filepath.Join(templateDir, name))
+		if err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	if raw == nil {
+		raw, err = templates.ReadFile("templates/" + name)
+		if err != nil {
+			return "", fmt.Errorf("no template for stack `%s`", stack.Name)
+		}
+	}
+
+	tmpl, err := template.New(name).Delims("[[", "]]").Option("missingkey=error").Parse(string(raw))
+	if err != nil {
+		return "", fmt.Errorf("invalid template for stack `%s`: %s", stack.Name, err.Error())
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, values); err != nil {
+		return "", fmt.Errorf("unable to render template for stack `%s`: %s", stack.Name, err.Error())
+	}
+
+	return buf.String(), nil
+}
+
+func noVersion(string) string {
+	return ""
+}
+
+// goVersion reads the `go` directive of go.mod.
+func goVersion(dir string) string {
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		return ""
+	}
+
+	match := regexp.MustCompile(`(?m)^go\s+(\d+\.\d+)`).FindSubmatch(raw)
+	if match == nil {
+		return ""
+	}
+
+	return string(match[1])
+}
+
+// nodeVersion reads an exact major version from the `engines` field of
+// package.json. Ranges are ignored in favour of the LTS image.
+func nodeVersion(dir string) string {
+	raw, err := ioutil.ReadFile(filepath.Join(dir, "package.json"))
+	if err != nil {
+		return ""
+	}
+
+	var pkg struct {
+		Engines struct {
+			Node string `json:"node"`
+		} `json:"engines"`
+	}
+	if err := json.Unmarshal(raw, &pkg); err != nil {
+		return ""
+	}
+
+	match := regexp.MustCompile(`^[\^~=v]*(\d+(\.\d+)*)$`).FindStringSubmatch(strings.TrimSpace(pkg.Engines.Node))
+	if match == nil {
+		return ""
+	}
+
+	return match[1]
+}
+
+// versionFile reads a version manager file such as .ruby-version.
+func versionFile(name string) func(string) string {
+	return func(dir string) string {
+		raw, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return ""
+		}
+
+		version := strings.TrimSpace(string(raw))
+		if !regexp.MustCompile(`^\d+(\.\d+)*$`).MatchString(version) {
+			return ""
+		}
+
+		return version
+	}
+}
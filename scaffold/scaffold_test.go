@@ -0,0 +1,106 @@
+package scaffold_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/CircleCI-Public/circleci-cli/scaffold"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"gopkg.in/yaml.v3"
+)
+
+var _ = Describe("scaffold", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "circleci-scaffold")
+		Expect(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(os.RemoveAll(dir)).To(Succeed())
+	})
+
+	write := func(name, contents string) {
+		Expect(ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0600)).To(Succeed())
+	}
+
+	It("detects stacks in order of precedence", func() {
+		write("Dockerfile", "FROM scratch\n")
+		write("go.mod", "module example.com/app\n\ngo 1.18\n")
+
+		stacks := scaffold.Detect(dir)
+		Expect(stacks).To(HaveLen(2))
+		Expect(stacks[0].Name).To(Equal("go"))
+		Expect(stacks[1].Name).To(Equal("docker"))
+	})
+
+	It("detects the version pinned by the project", func() {
+		write("go.mod", "module example.com/app\n\ngo 1.18\n")
+		write("package.json", `{"engines": {"node": "^16"}}`)
+		write(".ruby-version", "3.0.4\n")
+
+		stack, err := scaffold.FindStack("go")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(scaffold.DefaultValues(stack, dir).Version).To(Equal("1.18"))
+
+		stack, _ = scaffold.FindStack("node")
+		Expect(scaffold.DefaultValues(stack, dir).Version).To(Equal("16"))
+
+		stack, _ = scaffold.FindStack("ruby")
+		Expect(scaffold.DefaultValues(stack, dir).Version).To(Equal("3.0.4"))
+
+		stack, _ = scaffold.FindStack("python")
+		Expect(scaffold.DefaultValues(stack, dir).Version).To(Equal("3.10"))
+	})
+
+	It("renders a valid YAML config for every stack", func() {
+		for _, stack := range scaffold.Stacks {
+			out, err := scaffold.Render(stack, scaffold.Values{ProjectName: "app", Version: "1.0"}, "")
+			Expect(err).ShouldNot(HaveOccurred())
+
+			var config map[string]interface{}
+			Expect(yaml.Unmarshal([]byte(out), &config)).To(Succeed())
+			Expect(config).To(HaveKey("workflows"))
+			Expect(config["workflows"]).To(HaveKey("build-test"))
+		}
+	})
+
+	It("tests the image built by the docker stack", func() {
+		stack, _ := scaffold.FindStack("docker")
+		out, err := scaffold.Render(stack, scaffold.Values{ProjectName: "app"}, "")
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(out).To(ContainSubstring("docker_layer_caching: true"))
+		Expect(out).To(ContainSubstring("store_test_results"))
+
+		var config struct {
+			Workflows map[string]struct {
+				Jobs []interface{} `yaml:"jobs"`
+			} `yaml:"workflows"`
+		}
+		Expect(yaml.Unmarshal([]byte(out), &config)).To(Succeed())
+		Expect(config.Workflows["build-test"].Jobs).To(HaveLen(2))
+	})
+
+	It("prefers templates from the template directory", func() {
+		write("go.yml", "version: 2.1\n# [[ .ProjectName ]] {{ checksum \"go.sum\" }}\n")
+
+		stack, _ := scaffold.FindStack("go")
+		out, err := scaffold.Render(stack, scaffold.Values{ProjectName: "app"}, dir)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(out).To(Equal("version: 2.1\n# app {{ checksum \"go.sum\" }}\n"))
+
+		stack, _ = scaffold.FindStack("node")
+		out, err = scaffold.Render(stack, scaffold.Values{Version: "16"}, dir)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(out).To(ContainSubstring(`tag: "16"`))
+	})
+
+	It("rejects unknown stacks", func() {
+		_, err := scaffold.FindStack("cobol")
+		Expect(err).To(MatchError("unknown stack `cobol`, expected one of: go, node, java, ruby, python, docker"))
+	})
+})
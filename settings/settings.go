@@ -35,6 +35,7 @@ type Config struct {
 	GitHubAPI       string            `yaml:"-"`
 	SkipUpdateCheck bool              `yaml:"-"`
 	OrbPublishing   OrbPublishingInfo `yaml:"orb_publishing"`
+	OrbMirrorDir    string            `yaml:"orb_mirror_dir,omitempty"`
 	ConfigAPIHost   string            `yaml:"-"`
 }
 
@@ -80,6 +81,41 @@ func (upd *UpdateCheck) WriteToDisk() error {
 	return err
 }
 
+// AgentImage records the digests the build agent images of local builds were
+// last resolved to, so that they can be used without pulling.
+type AgentImage struct {
+	Digests  map[string]string `yaml:"digests"`
+	FileUsed string            `yaml:"-"`
+}
+
+// Load will read the agent image digests from the user's disk and then deserialize them into the current instance.
+func (img *AgentImage) Load() error {
+	path := filepath.Join(SettingsPath(), agentImageFilename())
+
+	if err := ensureSettingsFileExists(path); err != nil {
+		return err
+	}
+
+	img.FileUsed = path
+
+	content, err := ioutil.ReadFile(path) // #nosec
+	if err != nil {
+		return err
+	}
+
+	return yaml.Unmarshal(content, &img)
+}
+
+// WriteToDisk will write the agent image digests to disk by serializing the YAML
+func (img *AgentImage) WriteToDisk() error {
+	enc, err := yaml.Marshal(&img)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(img.FileUsed, enc, 0600)
+}
+
 // Load will read the config from the user's disk and then evaluate possible configuration from the environment.
 func (cfg *Config) Load() error {
 	if err := cfg.LoadFromDisk(); err != nil {
@@ -142,6 +178,10 @@ func (cfg *Config) LoadFromEnv(prefix string) {
 	if token := ReadFromEnv(prefix, "token"); token != "" {
 		cfg.Token = token
 	}
+
+	if orbMirrorDir := ReadFromEnv(prefix, "orb_mirror_dir"); orbMirrorDir != "" {
+		cfg.OrbMirrorDir = orbMirrorDir
+	}
 }
 
 // ReadFromEnv takes a prefix and field to search the environment for after capitalizing and joining them with an underscore.
@@ -155,6 +195,11 @@ func updateCheckFilename() string {
 	return "update_check.yml"
 }
 
+// agentImageFilename returns the name of the file caching the build agent image digests
+func agentImageFilename() string {
+	return "agent_image.yml"
+}
+
 // configFilename returns the name of the cli config file
 func configFilename() string {
 	// TODO: Make this configurable